@@ -3,8 +3,14 @@ package main
 import (
 	"authentication-app/config"
 	_ "authentication-app/docs"
+	"authentication-app/internal/render"
 	server "authentication-app/internal/server"
+	"authentication-app/internal/upload"
+	"authentication-app/internal/workers"
 	database "authentication-app/pkg/database"
+	"authentication-app/pkg/scanner"
+	"authentication-app/pkg/storage"
+	"context"
 	"os"
 	"os/signal"
 	"path"
@@ -45,7 +51,46 @@ func main() {
 		golog.Panicf("Database connection failed: %v", err)
 	}
 
-	s := server.NewServer(cfg, db, server.Logger(appLogger))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Initialize file storage
+	storages, err := storage.New(ctx, cfg)
+	if err != nil {
+		appLogger.Errorf("Failed to initialize storage: %v", err)
+		golog.Panicf("Storage initialization failed: %v", err)
+	}
+
+	policies, err := upload.NewPolicies(cfg)
+	if err != nil {
+		appLogger.Errorf("Invalid upload policy: %v", err)
+		golog.Panicf("Upload policy configuration failed: %v", err)
+	}
+	malwareScanner, err := scanner.New(cfg)
+	if err != nil {
+		appLogger.Errorf("Invalid malware scanner: %v", err)
+		golog.Panicf("Malware scanner configuration failed: %v", err)
+	}
+	uploads := upload.NewService(cfg, appLogger, db, storages, policies, malwareScanner)
+
+	variants, err := workers.NewVariantGenerator(cfg, appLogger, db, storages)
+	if err != nil {
+		appLogger.Errorf("Invalid image variants: %v", err)
+		golog.Panicf("Image variant configuration failed: %v", err)
+	}
+	renderer, err := render.NewRenderer(cfg, appLogger, storages)
+	if err != nil {
+		appLogger.Errorf("Invalid image rendering: %v", err)
+		golog.Panicf("Image rendering configuration failed: %v", err)
+	}
+
+	// Background workers
+	go workers.NewTrashPurger(cfg, appLogger, db, uploads).Run(ctx)
+	go workers.NewTusExpirer(cfg, appLogger, uploads).Run(ctx)
+	go workers.NewRescanner(cfg, appLogger, uploads).Run(ctx)
+	go variants.Run(ctx)
+
+	s := server.NewServer(cfg, db, server.Logger(appLogger), server.Storage(storages), server.Uploads(uploads), server.Variants(variants), server.Renderer(renderer))
 
 	go func() {
 		defer server.HandlePanic("HTTP Service")
@@ -0,0 +1,258 @@
+// Command uploadbench measures the throughput of POST /files/upload under concurrent large uploads
+// and, given the process ID of a local server, samples the server's resident memory while they run.
+// The content is pseudo-random, so uploads are not deduplicated, and generated while it is sent, so
+// the benchmark itself holds no file in memory either. With -image it sends JPEG photos of noise
+// instead, which the server buffers whole to sanitise; those are encoded before they are sent.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const megabyte = 1024 * 1024
+
+func main() {
+	url := flag.String("url", "http://localhost:8080/files/upload", "upload endpoint")
+	token := flag.String("token", os.Getenv("UPLOADBENCH_TOKEN"), "bearer token, defaults to $UPLOADBENCH_TOKEN")
+	sizeMB := flag.Int64("size", 256, "size of each upload in MB")
+	concurrency := flag.Int("concurrency", 8, "uploads in flight at once")
+	uploads := flag.Int("uploads", 0, "number of uploads, defaults to -concurrency")
+	imageMP := flag.Int("image", 0, "send JPEG images of this many megapixels instead of -size MB of bytes")
+	pid := flag.Int("pid", 0, "process ID of the server, to sample its resident memory (Linux only)")
+	flag.Parse()
+
+	if *token == "" || *sizeMB <= 0 || *concurrency <= 0 || *imageMP < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *uploads <= 0 {
+		*uploads = *concurrency
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var sent atomic.Int64
+	var failed atomic.Int64
+	monitor := newMonitor(*pid)
+	monitor.sample()
+
+	what := fmt.Sprintf("%dMB", *sizeMB)
+	if *imageMP > 0 {
+		what = fmt.Sprintf("%d megapixel JPEG images", *imageMP)
+	}
+	fmt.Printf("%d uploads of %s, %d at a time, to %s\n", *uploads, what, *concurrency, *url)
+	start := time.Now()
+	done := make(chan struct{})
+	go report(start, &sent, monitor, done)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				if err := upload(ctx, *url, *token, n, *sizeMB*megabyte, *imageMP, &sent); err != nil {
+					failed.Add(1)
+					fmt.Fprintf(os.Stderr, "upload %d: %v\n", n, err)
+				}
+			}
+		}()
+	}
+	for n := 0; n < *uploads && ctx.Err() == nil; n++ {
+		jobs <- n
+	}
+	close(jobs)
+	wg.Wait()
+	close(done)
+
+	elapsed := time.Since(start)
+	monitor.sample()
+	fmt.Printf("\n%d uploads, %d failed, %.0fMB in %s: %.1fMB/s\n",
+		*uploads, failed.Load(), float64(sent.Load())/megabyte, elapsed.Round(time.Millisecond), float64(sent.Load())/megabyte/elapsed.Seconds())
+	if monitor.enabled() {
+		fmt.Printf("server memory: %dMB before, %dMB at peak, %dMB after\n", monitor.first/megabyte, monitor.peak/megabyte, monitor.last/megabyte)
+	}
+	if failed.Load() > 0 {
+		os.Exit(1)
+	}
+}
+
+// upload sends one multipart upload of size bytes, or of a JPEG image of imageMP megapixels. The
+// form framing is built up front so the request carries a Content-Length, as browser uploads do.
+func upload(ctx context.Context, url, token string, n int, size int64, imageMP int, sent *atomic.Int64) error {
+	var seed [32]byte
+	binary.LittleEndian.PutUint64(seed[:], uint64(time.Now().UnixNano()))
+	binary.LittleEndian.PutUint64(seed[8:], uint64(n))
+	random := rand.NewChaCha8(seed)
+
+	filename := fmt.Sprintf("uploadbench-%d.bin", n)
+	content := io.LimitReader(random, size)
+	if imageMP > 0 {
+		photo, err := noiseJPEG(random, imageMP)
+		if err != nil {
+			return err
+		}
+		filename = fmt.Sprintf("uploadbench-%d.jpg", n)
+		content, size = bytes.NewReader(photo), int64(len(photo))
+	}
+
+	var head bytes.Buffer
+	form := multipart.NewWriter(&head)
+	if _, err := form.CreateFormFile("file", filename); err != nil {
+		return err
+	}
+	tail := "\r\n--" + form.Boundary() + "--\r\n"
+
+	body := &countingReader{r: io.MultiReader(&head, content, strings.NewReader(tail)), n: sent}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(head.Len()) + size + int64(len(tail))
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// noiseJPEG encodes a 4:3 image of about megapixels million random pixels. Noise does not
+// compress, so the file is about as large as a photo of the same size at a high quality.
+func noiseJPEG(random io.Reader, megapixels int) ([]byte, error) {
+	width := int(math.Sqrt(float64(megapixels) * 1e6 * 4 / 3))
+	img := image.NewRGBA(image.Rect(0, 0, width, width*3/4))
+	if _, err := io.ReadFull(random, img.Pix); err != nil {
+		return nil, err
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xFF
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// report prints progress every second until done is closed
+func report(start time.Time, sent *atomic.Int64, monitor *monitor, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		rss := monitor.sample()
+		elapsed := time.Since(start)
+		line := fmt.Sprintf("%6s  sent %8.0fMB  %7.1fMB/s", elapsed.Round(time.Second), float64(sent.Load())/megabyte, float64(sent.Load())/megabyte/elapsed.Seconds())
+		if monitor.enabled() {
+			line += fmt.Sprintf("  server rss %5dMB", rss/megabyte)
+		}
+		fmt.Println(line)
+	}
+}
+
+// monitor samples the resident memory of a process from /proc
+type monitor struct {
+	pid   int
+	first int64
+	peak  int64
+	last  int64
+}
+
+func newMonitor(pid int) *monitor {
+	return &monitor{pid: pid, first: -1}
+}
+
+func (m *monitor) enabled() bool {
+	return m.pid > 0
+}
+
+// sample reads the current resident memory, in bytes, and keeps the first, peak and last readings
+func (m *monitor) sample() int64 {
+	if !m.enabled() {
+		return 0
+	}
+	rss, err := residentMemory(m.pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sample memory of process %d: %v\n", m.pid, err)
+		m.pid = 0
+		return 0
+	}
+	if m.first < 0 {
+		m.first = rss
+	}
+	m.peak = max(m.peak, rss)
+	m.last = rss
+	return rss
+}
+
+func residentMemory(pid int) (int64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// VmRSS:	  123456 kB
+		value, ok := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no VmRSS in /proc/%d/status", pid)
+}
+
+// countingReader adds the bytes read through it to a counter shared by all uploads
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
+}
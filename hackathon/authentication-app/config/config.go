@@ -34,6 +34,88 @@ type Config struct {
 
 	JWTSecret        string `mapstructure:"jwt_secret"`
 	JWTExpireMinutes int    `mapstructure:"jwt_expire_minutes"`
+
+	AuthBackends string `mapstructure:"auth_backends"`
+
+	LDAPURL                string `mapstructure:"ldap_url"`
+	LDAPStartTLS           bool   `mapstructure:"ldap_start_tls"`
+	LDAPInsecureSkipVerify bool   `mapstructure:"ldap_insecure_skip_verify"`
+	LDAPCACertFile         string `mapstructure:"ldap_ca_cert_file"`
+	LDAPBindDN             string `mapstructure:"ldap_bind_dn"`
+	LDAPBindPassword       string `mapstructure:"ldap_bind_password"`
+	LDAPBaseDN             string `mapstructure:"ldap_base_dn"`
+	LDAPUserFilter         string `mapstructure:"ldap_user_filter"`
+	LDAPGroupAttribute     string `mapstructure:"ldap_group_attribute"`
+	LDAPGroupRoleMap       string `mapstructure:"ldap_group_role_map"`
+	LDAPDefaultRole        string `mapstructure:"ldap_default_role"`
+	LDAPTimeout            int    `mapstructure:"ldap_timeout"`
+
+	WebAuthnRPID           string `mapstructure:"webauthn_rp_id"`
+	WebAuthnRPDisplayName  string `mapstructure:"webauthn_rp_display_name"`
+	WebAuthnRPOrigins      string `mapstructure:"webauthn_rp_origins"`
+	WebAuthnTimeoutSeconds int    `mapstructure:"webauthn_timeout_seconds"`
+
+	SessionCookieName     string `mapstructure:"session_cookie_name"`
+	SessionCookieDomain   string `mapstructure:"session_cookie_domain"`
+	SessionCookieSecure   bool   `mapstructure:"session_cookie_secure"`
+	SessionCookieSameSite string `mapstructure:"session_cookie_same_site"`
+	CSRFCookieName        string `mapstructure:"csrf_cookie_name"`
+	CSRFHeaderName        string `mapstructure:"csrf_header_name"`
+
+	SCIMBearerToken string `mapstructure:"scim_bearer_token"`
+
+	TrashRetentionHours       int `mapstructure:"trash_retention_hours"`
+	TrashPurgeIntervalMinutes int `mapstructure:"trash_purge_interval_minutes"`
+
+	StorageBackend    string `mapstructure:"storage_backend"`
+	StorageLocalRoot  string `mapstructure:"storage_local_root"`
+	S3Endpoint        string `mapstructure:"s3_endpoint"`
+	S3Region          string `mapstructure:"s3_region"`
+	S3Bucket          string `mapstructure:"s3_bucket"`
+	S3AccessKeyID     string `mapstructure:"s3_access_key_id"`
+	S3SecretAccessKey string `mapstructure:"s3_secret_access_key"`
+	S3UseSSL          bool   `mapstructure:"s3_use_ssl"`
+	S3ForcePathStyle  bool   `mapstructure:"s3_force_path_style"`
+	S3CreateBucket    bool   `mapstructure:"s3_create_bucket"`
+
+	UploadMaxFileSizeMB     int64  `mapstructure:"upload_max_file_size_mb"`
+	UploadAllowedTypes      string `mapstructure:"upload_allowed_types"`
+	UploadAllowedExtensions string `mapstructure:"upload_allowed_extensions"`
+	UploadMaxFilesPerUser   int64  `mapstructure:"upload_max_files_per_user"`
+	UploadQuotaMBPerUser    int64  `mapstructure:"upload_quota_mb_per_user"`
+	UploadRolePolicies      string `mapstructure:"upload_role_policies"`
+	UploadStripMetadata     bool   `mapstructure:"upload_strip_metadata"`
+	UploadMaxImageWidth     int    `mapstructure:"upload_max_image_width"`
+	UploadMaxImageHeight    int    `mapstructure:"upload_max_image_height"`
+	UploadMaxImagePixels    int64  `mapstructure:"upload_max_image_pixels"`
+
+	FileVersionsKeep int `mapstructure:"file_versions_keep"`
+
+	ArchiveMaxSizeMB int64 `mapstructure:"archive_max_size_mb"`
+	ArchiveMaxFiles  int   `mapstructure:"archive_max_files"`
+
+	TusExpirationHours        int `mapstructure:"tus_expiration_hours"`
+	TusCleanupIntervalMinutes int `mapstructure:"tus_cleanup_interval_minutes"`
+
+	ScannerBackend           string `mapstructure:"scanner_backend"`
+	ClamdAddress             string `mapstructure:"clamd_address"`
+	ClamdTimeoutSeconds      int    `mapstructure:"clamd_timeout_seconds"`
+	ScanRetryIntervalMinutes int    `mapstructure:"scan_retry_interval_minutes"`
+
+	PresignSecret               string `mapstructure:"presign_secret"`
+	PresignDefaultExpiryMinutes int    `mapstructure:"presign_default_expiry_minutes"`
+	PresignMaxExpiryMinutes     int    `mapstructure:"presign_max_expiry_minutes"`
+
+	ImageVariants  string `mapstructure:"image_variants"`
+	ImageWorkers   int    `mapstructure:"image_workers"`
+	ImageQueueSize int    `mapstructure:"image_queue_size"`
+	ImageMaxPixels int64  `mapstructure:"image_max_pixels"`
+
+	RenderSizes       string `mapstructure:"render_sizes"`
+	RenderQualities   string `mapstructure:"render_qualities"`
+	RenderConcurrency int    `mapstructure:"render_concurrency"`
+	RenderCacheDir    string `mapstructure:"render_cache_dir"`
+	RenderCacheMaxMB  int64  `mapstructure:"render_cache_max_mb"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -72,6 +154,126 @@ func LoadConfig() (*Config, error) {
 	viper.BindEnv("jwt_secret", "JWT_SECRET")
 	viper.BindEnv("jwt_expire_minutes", "JWT_EXPIRE_MINUTES")
 
+	viper.BindEnv("auth_backends", "AUTH_BACKENDS")
+
+	viper.BindEnv("ldap_url", "LDAP_URL")
+	viper.BindEnv("ldap_start_tls", "LDAP_START_TLS")
+	viper.BindEnv("ldap_insecure_skip_verify", "LDAP_INSECURE_SKIP_VERIFY")
+	viper.BindEnv("ldap_ca_cert_file", "LDAP_CA_CERT_FILE")
+	viper.BindEnv("ldap_bind_dn", "LDAP_BIND_DN")
+	viper.BindEnv("ldap_bind_password", "LDAP_BIND_PASSWORD")
+	viper.BindEnv("ldap_base_dn", "LDAP_BASE_DN")
+	viper.BindEnv("ldap_user_filter", "LDAP_USER_FILTER")
+	viper.BindEnv("ldap_group_attribute", "LDAP_GROUP_ATTRIBUTE")
+	viper.BindEnv("ldap_group_role_map", "LDAP_GROUP_ROLE_MAP")
+	viper.BindEnv("ldap_default_role", "LDAP_DEFAULT_ROLE")
+	viper.BindEnv("ldap_timeout", "LDAP_TIMEOUT")
+
+	viper.BindEnv("webauthn_rp_id", "WEBAUTHN_RP_ID")
+	viper.BindEnv("webauthn_rp_display_name", "WEBAUTHN_RP_DISPLAY_NAME")
+	viper.BindEnv("webauthn_rp_origins", "WEBAUTHN_RP_ORIGINS")
+	viper.BindEnv("webauthn_timeout_seconds", "WEBAUTHN_TIMEOUT_SECONDS")
+
+	viper.BindEnv("session_cookie_name", "SESSION_COOKIE_NAME")
+	viper.BindEnv("session_cookie_domain", "SESSION_COOKIE_DOMAIN")
+	viper.BindEnv("session_cookie_secure", "SESSION_COOKIE_SECURE")
+	viper.BindEnv("session_cookie_same_site", "SESSION_COOKIE_SAME_SITE")
+	viper.BindEnv("csrf_cookie_name", "CSRF_COOKIE_NAME")
+	viper.BindEnv("csrf_header_name", "CSRF_HEADER_NAME")
+	viper.SetDefault("session_cookie_name", "auth_token")
+	viper.SetDefault("session_cookie_secure", true)
+	viper.SetDefault("session_cookie_same_site", "Strict")
+	viper.SetDefault("csrf_cookie_name", "csrf_token")
+	viper.SetDefault("csrf_header_name", "X-CSRF-Token")
+
+	viper.BindEnv("scim_bearer_token", "SCIM_BEARER_TOKEN")
+
+	viper.BindEnv("trash_retention_hours", "TRASH_RETENTION_HOURS")
+	viper.BindEnv("trash_purge_interval_minutes", "TRASH_PURGE_INTERVAL_MINUTES")
+	viper.SetDefault("trash_retention_hours", 720)
+	viper.SetDefault("trash_purge_interval_minutes", 60)
+
+	viper.BindEnv("storage_backend", "STORAGE_BACKEND")
+	viper.BindEnv("storage_local_root", "STORAGE_LOCAL_ROOT")
+	viper.BindEnv("s3_endpoint", "S3_ENDPOINT")
+	viper.BindEnv("s3_region", "S3_REGION")
+	viper.BindEnv("s3_bucket", "S3_BUCKET")
+	viper.BindEnv("s3_access_key_id", "S3_ACCESS_KEY_ID")
+	viper.BindEnv("s3_secret_access_key", "S3_SECRET_ACCESS_KEY")
+	viper.BindEnv("s3_use_ssl", "S3_USE_SSL")
+	viper.BindEnv("s3_force_path_style", "S3_FORCE_PATH_STYLE")
+	viper.BindEnv("s3_create_bucket", "S3_CREATE_BUCKET")
+	viper.SetDefault("storage_backend", "local")
+	viper.SetDefault("storage_local_root", "./tmp")
+	viper.SetDefault("s3_region", "us-east-1")
+	viper.SetDefault("s3_force_path_style", true)
+
+	viper.BindEnv("upload_max_file_size_mb", "UPLOAD_MAX_FILE_SIZE_MB")
+	viper.BindEnv("upload_allowed_types", "UPLOAD_ALLOWED_TYPES")
+	viper.BindEnv("upload_allowed_extensions", "UPLOAD_ALLOWED_EXTENSIONS")
+	viper.BindEnv("upload_max_files_per_user", "UPLOAD_MAX_FILES_PER_USER")
+	viper.BindEnv("upload_quota_mb_per_user", "UPLOAD_QUOTA_MB_PER_USER")
+	viper.BindEnv("upload_role_policies", "UPLOAD_ROLE_POLICIES")
+	viper.BindEnv("upload_strip_metadata", "UPLOAD_STRIP_METADATA")
+	viper.BindEnv("upload_max_image_width", "UPLOAD_MAX_IMAGE_WIDTH")
+	viper.BindEnv("upload_max_image_height", "UPLOAD_MAX_IMAGE_HEIGHT")
+	viper.BindEnv("upload_max_image_pixels", "UPLOAD_MAX_IMAGE_PIXELS")
+	viper.SetDefault("upload_max_file_size_mb", 8)
+	viper.SetDefault("upload_allowed_types", "image/jpeg,image/png,image/gif,image/webp")
+	viper.SetDefault("upload_allowed_extensions", ".jpg,.jpeg,.png,.gif,.webp")
+	viper.SetDefault("upload_strip_metadata", true)
+	viper.SetDefault("upload_max_image_width", 12000)
+	viper.SetDefault("upload_max_image_height", 12000)
+	viper.SetDefault("upload_max_image_pixels", 50000000)
+
+	viper.BindEnv("file_versions_keep", "FILE_VERSIONS_KEEP")
+	viper.SetDefault("file_versions_keep", 10)
+
+	viper.BindEnv("archive_max_size_mb", "ARCHIVE_MAX_SIZE_MB")
+	viper.BindEnv("archive_max_files", "ARCHIVE_MAX_FILES")
+	viper.SetDefault("archive_max_size_mb", 1024)
+	viper.SetDefault("archive_max_files", 1000)
+
+	viper.BindEnv("tus_expiration_hours", "TUS_EXPIRATION_HOURS")
+	viper.BindEnv("tus_cleanup_interval_minutes", "TUS_CLEANUP_INTERVAL_MINUTES")
+	viper.SetDefault("tus_expiration_hours", 24)
+	viper.SetDefault("tus_cleanup_interval_minutes", 60)
+
+	viper.BindEnv("scanner_backend", "SCANNER_BACKEND")
+	viper.BindEnv("clamd_address", "CLAMD_ADDRESS")
+	viper.BindEnv("clamd_timeout_seconds", "CLAMD_TIMEOUT_SECONDS")
+	viper.BindEnv("scan_retry_interval_minutes", "SCAN_RETRY_INTERVAL_MINUTES")
+	viper.SetDefault("scanner_backend", "none")
+	viper.SetDefault("clamd_address", "tcp://localhost:3310")
+	viper.SetDefault("clamd_timeout_seconds", 30)
+	viper.SetDefault("scan_retry_interval_minutes", 30)
+
+	viper.BindEnv("presign_secret", "PRESIGN_SECRET")
+	viper.BindEnv("presign_default_expiry_minutes", "PRESIGN_DEFAULT_EXPIRY_MINUTES")
+	viper.BindEnv("presign_max_expiry_minutes", "PRESIGN_MAX_EXPIRY_MINUTES")
+	viper.SetDefault("presign_default_expiry_minutes", 15)
+	viper.SetDefault("presign_max_expiry_minutes", 60)
+
+	viper.BindEnv("image_variants", "IMAGE_VARIANTS")
+	viper.BindEnv("image_workers", "IMAGE_WORKERS")
+	viper.BindEnv("image_queue_size", "IMAGE_QUEUE_SIZE")
+	viper.BindEnv("image_max_pixels", "IMAGE_MAX_PIXELS")
+	viper.SetDefault("image_variants", "thumb:128,preview:512,thumb_webp:128:webp,preview_webp:512:webp")
+	viper.SetDefault("image_workers", 2)
+	viper.SetDefault("image_queue_size", 100)
+	viper.SetDefault("image_max_pixels", 50000000)
+
+	viper.BindEnv("render_sizes", "RENDER_SIZES")
+	viper.BindEnv("render_qualities", "RENDER_QUALITIES")
+	viper.BindEnv("render_concurrency", "RENDER_CONCURRENCY")
+	viper.BindEnv("render_cache_dir", "RENDER_CACHE_DIR")
+	viper.BindEnv("render_cache_max_mb", "RENDER_CACHE_MAX_MB")
+	viper.SetDefault("render_sizes", "32,64,128,256,512,768,1024,1536,2048")
+	viper.SetDefault("render_qualities", "50,75,85,95")
+	viper.SetDefault("render_concurrency", 2)
+	viper.SetDefault("render_cache_dir", "./tmp/render-cache")
+	viper.SetDefault("render_cache_max_mb", 512)
+
 	if err := viper.Unmarshal(cfg); err != nil {
 		return nil, fmt.Errorf("unable to decode into struct: %w", err)
 	}
@@ -17,14 +17,23 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	User      UserInfo  `json:"user"`
+	Token          string     `json:"token,omitempty"`
+	CSRFToken      string     `json:"csrf_token,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	User           UserInfo   `json:"user"`
+	OrganizationID *uuid.UUID `json:"organization_id,omitempty"`
+}
+
+type SessionResponse struct {
+	User           UserInfo   `json:"user"`
+	CSRFToken      string     `json:"csrf_token,omitempty"`
+	OrganizationID *uuid.UUID `json:"organization_id,omitempty"`
 }
 
 type UserInfo struct {
 	ID       uuid.UUID `json:"id"`
 	Username string    `json:"username"`
+	Role     string    `json:"role"`
 }
 
 type RevokeTokenRequest struct {
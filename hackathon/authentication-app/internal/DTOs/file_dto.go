@@ -0,0 +1,97 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type FileResponse struct {
+	ID             uuid.UUID              `json:"id"`
+	UserID         uuid.UUID              `json:"user_id"`
+	OrganizationID *uuid.UUID             `json:"organization_id"`
+	FolderID       *uuid.UUID             `json:"folder_id"`
+	Filename       string                 `json:"filename"`
+	OriginalName   string                 `json:"original_name"`
+	ContentType    string                 `json:"content_type"`
+	Size           int64                  `json:"size"`
+	Width          *int                   `json:"width"`
+	Height         *int                   `json:"height"`
+	SHA256         *string                `json:"sha256"`
+	Version        int                    `json:"version"`
+	ScanStatus     string                 `json:"scan_status"`
+	ScanSignature  *string                `json:"scan_signature,omitempty"`
+	Tags           []string               `json:"tags"`
+	Metadata       map[string]interface{} `json:"metadata"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      *time.Time             `json:"updated_at"`
+	DeletedAt      *time.Time             `json:"deleted_at,omitempty"`
+	Variants       []FileVariantResponse  `json:"variants,omitempty"`
+}
+
+// FileVariantResponse describes a derived image, downloadable with ?variant=<name>
+type FileVariantResponse struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+}
+
+type FileListResponse struct {
+	Files    []FileResponse `json:"files"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
+	Total    int64          `json:"total"`
+}
+
+// QuotaResponse reports the caller's storage usage against their upload policy. Zero limits mean unlimited.
+type QuotaResponse struct {
+	UsedBytes         int64    `json:"used_bytes"`
+	QuotaBytes        int64    `json:"quota_bytes"`
+	FileCount         int64    `json:"file_count"`
+	MaxFiles          int64    `json:"max_files"`
+	MaxFileSize       int64    `json:"max_file_size"`
+	AllowedTypes      []string `json:"allowed_types"`
+	AllowedExtensions []string `json:"allowed_extensions"`
+}
+
+// PresignRequest asks for a signed URL. ExpiresIn is in seconds; zero picks the default.
+type PresignRequest struct {
+	ExpiresIn int    `json:"expires_in"`
+	Variant   string `json:"variant"`
+}
+
+// PresignResponse is a URL that acts on the caller's behalf until it expires. Uploads send the
+// file in the FormField field of a multipart body.
+type PresignResponse struct {
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	FormField string    `json:"form_field,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MoveFileRequest moves a file into a folder, or to the top level when FolderID is null
+type MoveFileRequest struct {
+	FolderID *uuid.UUID `json:"folder_id"`
+}
+
+// UpdateFileRequest changes the tags and metadata of a file. Tags replace the current list when
+// present; metadata is merged into the current object, and keys set to null are removed.
+type UpdateFileRequest struct {
+	Tags     *[]string              `json:"tags"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// FileSearchResponse is one page of search results. NextCursor is empty on the last page.
+type FileSearchResponse struct {
+	Files      []FileResponse `json:"files"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// CreateArchiveRequest names the files of a ZIP archive: either a list of files or a folder, whose
+// whole subtree is included
+type CreateArchiveRequest struct {
+	FileIDs  []uuid.UUID `json:"file_ids"`
+	FolderID *uuid.UUID  `json:"folder_id"`
+}
@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateFolderRequest creates a folder under ParentID, or at the top level when it is null
+type CreateFolderRequest struct {
+	Name     string     `json:"name"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+type RenameFolderRequest struct {
+	Name string `json:"name"`
+}
+
+// MoveFolderRequest moves a folder under ParentID, or to the top level when it is null
+type MoveFolderRequest struct {
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+type FolderResponse struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	OrganizationID *uuid.UUID `json:"organization_id"`
+	ParentID       *uuid.UUID `json:"parent_id"`
+	Name           string     `json:"name"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+// FolderPathEntry is one step of the path from the top level down to a folder
+type FolderPathEntry struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// FolderDetailResponse is a folder with its path, top level first and ending with the folder itself
+type FolderDetailResponse struct {
+	FolderResponse
+	Path []FolderPathEntry `json:"path"`
+}
+
+// FolderChildrenResponse pages through a folder's contents: its subfolders first, then its files,
+// each sorted by name. Folder is null and Path empty for the top level.
+type FolderChildrenResponse struct {
+	Folder       *FolderResponse   `json:"folder"`
+	Path         []FolderPathEntry `json:"path"`
+	Folders      []FolderResponse  `json:"folders"`
+	Files        []FileResponse    `json:"files"`
+	Page         int               `json:"page"`
+	PageSize     int               `json:"page_size"`
+	TotalFolders int64             `json:"total_folders"`
+	TotalFiles   int64             `json:"total_files"`
+}
+
+type FolderListResponse struct {
+	Folders  []FolderResponse `json:"folders"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+	Total    int64            `json:"total"`
+}
@@ -0,0 +1,49 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+type OrganizationResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrganizationMemberResponse struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type InviteMemberRequest struct {
+	Username string `json:"username" validate:"required"`
+	Role     string `json:"role" validate:"omitempty,oneof=owner admin member"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+type InvitationResponse struct {
+	ID               uuid.UUID  `json:"id"`
+	OrganizationID   uuid.UUID  `json:"organization_id"`
+	OrganizationName string     `json:"organization_name"`
+	Username         string     `json:"username"`
+	Role             string     `json:"role"`
+	Status           string     `json:"status"`
+	InvitedBy        *uuid.UUID `json:"invited_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type SwitchOrganizationRequest struct {
+	OrganizationID *uuid.UUID `json:"organization_id"`
+}
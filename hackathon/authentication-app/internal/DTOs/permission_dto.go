@@ -0,0 +1,39 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GrantPermissionRequest gives a user read or write access to a file, replacing any earlier grant
+type GrantPermissionRequest struct {
+	Username   string `json:"username"`
+	Permission string `json:"permission"`
+}
+
+type PermissionResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	FileID     uuid.UUID  `json:"file_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Username   string     `json:"username"`
+	Permission string     `json:"permission"`
+	GrantedBy  *uuid.UUID `json:"granted_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+}
+
+// SharedFileResponse is a file someone else granted me access to, with the permission I hold
+type SharedFileResponse struct {
+	FileResponse
+	Permission string     `json:"permission"`
+	GrantedBy  *uuid.UUID `json:"granted_by"`
+	SharedAt   time.Time  `json:"shared_at"`
+}
+
+type SharedFileListResponse struct {
+	Files    []SharedFileResponse `json:"files"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"page_size"`
+	Total    int64                `json:"total"`
+}
@@ -0,0 +1,31 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateShareRequest configures a share link. Every limit is optional.
+type CreateShareRequest struct {
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxDownloads *int       `json:"max_downloads"`
+	Password     string     `json:"password"`
+}
+
+// ShareResponse describes a share link. Token and URL are only returned when the share is created.
+type ShareResponse struct {
+	ID               uuid.UUID  `json:"id"`
+	FileID           uuid.UUID  `json:"file_id"`
+	Token            string     `json:"token,omitempty"`
+	URL              string     `json:"url,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	MaxDownloads     *int       `json:"max_downloads"`
+	DownloadCount    int        `json:"download_count"`
+	HasPassword      bool       `json:"has_password"`
+	Active           bool       `json:"active"`
+	LastDownloadedAt *time.Time `json:"last_downloaded_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedBy        uuid.UUID  `json:"created_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
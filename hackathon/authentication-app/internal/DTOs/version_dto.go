@@ -0,0 +1,30 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileVersionResponse is one entry of a file's history. Current marks the version the file serves.
+type FileVersionResponse struct {
+	Version       int        `json:"version"`
+	OriginalName  string     `json:"original_name"`
+	ContentType   string     `json:"content_type"`
+	Size          int64      `json:"size"`
+	Width         *int       `json:"width"`
+	Height        *int       `json:"height"`
+	SHA256        *string    `json:"sha256"`
+	ScanStatus    string     `json:"scan_status"`
+	ScanSignature *string    `json:"scan_signature,omitempty"`
+	UploadedBy    *uuid.UUID `json:"uploaded_by"`
+	Uploader      string     `json:"uploader,omitempty"`
+	Current       bool       `json:"current"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// FileVersionUploadResponse is the file after a new version became current, with that version
+type FileVersionUploadResponse struct {
+	File    FileResponse        `json:"file"`
+	Version FileVersionResponse `json:"version"`
+}
@@ -0,0 +1,35 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebAuthnRegisterBeginRequest struct {
+	Name string `json:"name" validate:"max=255"`
+}
+
+type WebAuthnLoginBeginRequest struct {
+	Username string `json:"username"`
+}
+
+type WebAuthnBeginResponse struct {
+	SessionID uuid.UUID   `json:"session_id"`
+	Options   interface{} `json:"options"`
+}
+
+type WebAuthnFinishRequest struct {
+	SessionID  uuid.UUID       `json:"session_id" validate:"required"`
+	Credential json.RawMessage `json:"credential" validate:"required" swaggertype:"object"`
+}
+
+type WebAuthnCredentialInfo struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	SignCount  uint32     `json:"sign_count"`
+	Synced     bool       `json:"synced"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
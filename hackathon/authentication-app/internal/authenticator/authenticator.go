@@ -0,0 +1,93 @@
+package authenticator
+
+import (
+	"authentication-app/config"
+	"authentication-app/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCredentials is returned when a backend does not recognise the username/password pair
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator verifies a username and password and returns the matching user
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*models.User, error)
+}
+
+// Chain tries each backend in order until one of them accepts the credentials
+type Chain struct {
+	logger   golog.Logger
+	backends []Authenticator
+}
+
+func NewChain(logger golog.Logger, backends ...Authenticator) *Chain {
+	return &Chain{
+		logger:   logger,
+		backends: backends,
+	}
+}
+
+func (ch *Chain) Name() string {
+	names := make([]string, 0, len(ch.backends))
+	for _, backend := range ch.backends {
+		names = append(names, backend.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Authenticate returns the first successful result. Backends that reject the credentials are
+// skipped silently, while backend failures are logged and only surfaced when no backend succeeds.
+func (ch *Chain) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	var lastErr error
+	for _, backend := range ch.backends {
+		user, err := backend.Authenticate(ctx, username, password)
+		if err == nil {
+			return user, nil
+		}
+		if errors.Is(err, ErrInvalidCredentials) {
+			continue
+		}
+		ch.logger.Warnf("Authentication backend %s failed: %v", backend.Name(), err)
+		lastErr = err
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// NewFromConfig builds the backend chain in the order listed in AUTH_BACKENDS
+func NewFromConfig(cfg *config.Config, logger golog.Logger, db *gorm.DB) (*Chain, error) {
+	names := strings.Split(cfg.AuthBackends, ",")
+	backends := make([]Authenticator, 0, len(names))
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+			continue
+		case models.AuthSourceLocal:
+			backends = append(backends, NewLocalAuthenticator(db))
+		case models.AuthSourceLDAP:
+			ldapAuth, err := NewLDAPAuthenticator(cfg, logger, db)
+			if err != nil {
+				return nil, fmt.Errorf("ldap authenticator: %w", err)
+			}
+			backends = append(backends, ldapAuth)
+		default:
+			return nil, fmt.Errorf("unknown authentication backend %q", name)
+		}
+	}
+
+	if len(backends) == 0 {
+		backends = append(backends, NewLocalAuthenticator(db))
+	}
+
+	return NewChain(logger, backends...), nil
+}
@@ -0,0 +1,274 @@
+package authenticator
+
+import (
+	"authentication-app/config"
+	"authentication-app/internal/models"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+// groupRole maps an LDAP group DN to an application role
+type groupRole struct {
+	groupDN string
+	role    string
+}
+
+// LDAPAuthenticator looks the user up with a service account, then binds as that user to verify
+// the password. Successful logins are shadowed into the users table so that foreign keys keep working.
+type LDAPAuthenticator struct {
+	cfg        *config.Config
+	logger     golog.Logger
+	db         *gorm.DB
+	tlsConfig  *tls.Config
+	groupRoles []groupRole
+	timeout    time.Duration
+}
+
+func NewLDAPAuthenticator(cfg *config.Config, logger golog.Logger, db *gorm.DB) (*LDAPAuthenticator, error) {
+	if cfg.LDAPURL == "" {
+		return nil, errors.New("LDAP_URL is required")
+	}
+	if cfg.LDAPBaseDN == "" {
+		return nil, errors.New("LDAP_BASE_DN is required")
+	}
+	if !strings.Contains(cfg.LDAPUserFilter, "%s") {
+		return nil, errors.New("LDAP_USER_FILTER must contain a %s placeholder for the username")
+	}
+
+	tlsConfig, err := buildLDAPTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	groupRoles, err := parseGroupRoleMap(cfg.LDAPGroupRoleMap)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(cfg.LDAPTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &LDAPAuthenticator{
+		cfg:        cfg,
+		logger:     logger,
+		db:         db,
+		tlsConfig:  tlsConfig,
+		groupRoles: groupRoles,
+		timeout:    timeout,
+	}, nil
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return models.AuthSourceLDAP
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	// An empty password would turn the user bind into an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.LDAPBindDN != "" {
+		if err := conn.Bind(a.cfg.LDAPBindDN, a.cfg.LDAPBindPassword); err != nil {
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user bind: %w", err)
+	}
+
+	role := a.mapRole(entry.GetAttributeValues(a.groupAttribute()))
+	return shadowUser(ctx, a.db, username, models.AuthSourceLDAP, role)
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.cfg.LDAPURL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: a.timeout}),
+		ldap.DialWithTLSConfig(a.tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", a.cfg.LDAPURL, err)
+	}
+	conn.SetTimeout(a.timeout)
+
+	if a.cfg.LDAPStartTLS {
+		if err := conn.StartTLS(a.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	request := ldap.NewSearchRequest(
+		a.cfg.LDAPBaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(a.timeout.Seconds()),
+		false,
+		fmt.Sprintf(a.cfg.LDAPUserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", a.groupAttribute()},
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, fmt.Errorf("search user: %w", err)
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, fmt.Errorf("search user: filter matched %d entries for %q", len(result.Entries), username)
+	}
+}
+
+func (a *LDAPAuthenticator) groupAttribute() string {
+	if a.cfg.LDAPGroupAttribute == "" {
+		return "memberOf"
+	}
+	return a.cfg.LDAPGroupAttribute
+}
+
+// mapRole returns the role of the first configured group the user belongs to
+func (a *LDAPAuthenticator) mapRole(groups []string) string {
+	for _, mapping := range a.groupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(strings.TrimSpace(group), mapping.groupDN) {
+				return mapping.role
+			}
+		}
+	}
+
+	if a.cfg.LDAPDefaultRole != "" {
+		return a.cfg.LDAPDefaultRole
+	}
+	return models.RoleUser
+}
+
+func buildLDAPTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.LDAPInsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if u, err := url.Parse(cfg.LDAPURL); err == nil {
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	if cfg.LDAPCACertFile != "" {
+		pem, err := os.ReadFile(cfg.LDAPCACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read LDAP CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("LDAP_CA_CERT_FILE contains no valid certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// parseGroupRoleMap parses "groupDN:role;groupDN:role". The role is taken after the last colon so
+// that group DNs may contain commas and equals signs.
+func parseGroupRoleMap(raw string) ([]groupRole, error) {
+	var mappings []groupRole
+	for _, item := range strings.Split(raw, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idx := strings.LastIndex(item, ":")
+		if idx <= 0 || idx == len(item)-1 {
+			return nil, fmt.Errorf("invalid LDAP_GROUP_ROLE_MAP entry %q, expected groupDN:role", item)
+		}
+		mappings = append(mappings, groupRole{
+			groupDN: strings.TrimSpace(item[:idx]),
+			role:    strings.TrimSpace(item[idx+1:]),
+		})
+	}
+	return mappings, nil
+}
+
+// shadowUser makes sure an externally authenticated user has a row in the users table
+func shadowUser(ctx context.Context, db *gorm.DB, username, source, role string) (*models.User, error) {
+	db = db.WithContext(ctx)
+
+	var user models.User
+	err := db.Where("username = ?", username).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user = models.User{
+			ID:         uuid.New(),
+			Username:   username,
+			AuthSource: source,
+			Role:       role,
+			Active:     true,
+			CreatedAt:  time.Now(),
+		}
+		if err := db.Create(&user).Error; err != nil {
+			return nil, fmt.Errorf("create shadow user: %w", err)
+		}
+		return &user, nil
+	}
+
+	// Never let a directory account take over a user that belongs to another backend
+	if user.AuthSource != source {
+		return nil, ErrInvalidCredentials
+	}
+
+	if user.Role != role {
+		now := time.Now()
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"role":       role,
+			"updated_at": now,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("update shadow user: %w", err)
+		}
+		user.Role = role
+		user.UpdatedAt = &now
+	}
+
+	return &user, nil
+}
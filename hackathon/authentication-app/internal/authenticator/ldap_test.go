@@ -0,0 +1,52 @@
+package authenticator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGroupRoleMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []groupRole
+		wantErr bool
+	}{
+		{name: "empty", raw: "", want: nil},
+		{name: "only separators", raw: " ; ;", want: nil},
+		{
+			name: "single",
+			raw:  "cn=admins,ou=groups,dc=example,dc=org:admin",
+			want: []groupRole{{groupDN: "cn=admins,ou=groups,dc=example,dc=org", role: "admin"}},
+		},
+		{
+			name: "several with spaces",
+			raw:  " cn=admins,dc=example:admin ; cn=staff,dc=example : user ;",
+			want: []groupRole{
+				{groupDN: "cn=admins,dc=example", role: "admin"},
+				{groupDN: "cn=staff,dc=example", role: "user"},
+			},
+		},
+		{
+			name: "role after the last colon",
+			raw:  "cn=team:a,dc=example:user",
+			want: []groupRole{{groupDN: "cn=team:a,dc=example", role: "user"}},
+		},
+		{name: "no colon", raw: "cn=admins,dc=example", wantErr: true},
+		{name: "no role", raw: "cn=admins,dc=example:", wantErr: true},
+		{name: "no group", raw: ":admin", wantErr: true},
+		{name: "one bad entry", raw: "cn=admins:admin;broken", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGroupRoleMap(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGroupRoleMap(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGroupRoleMap(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package authenticator
+
+import (
+	"authentication-app/internal/models"
+	"context"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// LocalAuthenticator checks passwords against the bcrypt hashes stored in the users table
+type LocalAuthenticator struct {
+	db *gorm.DB
+}
+
+func NewLocalAuthenticator(db *gorm.DB) *LocalAuthenticator {
+	return &LocalAuthenticator{
+		db: db,
+	}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return models.AuthSourceLocal
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	var user models.User
+	err := a.db.WithContext(ctx).
+		Where("username = ? AND auth_source = ?", username, models.AuthSourceLocal).
+		First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"authentication-app/internal/models"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fileAccess is what the caller may do with a file. Each level includes the ones below it.
+type fileAccess int
+
+const (
+	fileAccessNone fileAccess = iota
+	// fileAccessRead allows viewing and downloading the file
+	fileAccessRead
+	// fileAccessWrite also allows changing the file, and trashing and restoring it
+	fileAccessWrite
+	// fileAccessManage also allows moving the file and managing its share links and permissions
+	fileAccessManage
+)
+
+// authorizeFile loads the file named by the :id parameter and checks that the caller holds at least
+// the required access. Every route on a single file goes through it or authorizeTrashedFile.
+func authorizeFile(c *fiber.Ctx, db *gorm.DB, required fileAccess) (*models.FileUpload, error) {
+	return loadAuthorizedFile(c, db, db, required)
+}
+
+// authorizeTrashedFile is authorizeFile for a file that is in the trash
+func authorizeTrashedFile(c *fiber.Ctx, db *gorm.DB, required fileAccess) (*models.FileUpload, error) {
+	return loadAuthorizedFile(c, db, db.Unscoped().Where("deleted_at IS NOT NULL"), required)
+}
+
+func loadAuthorizedFile(c *fiber.Ctx, db *gorm.DB, query *gorm.DB, required fileAccess) (*models.FileUpload, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return authorizeFileID(c, db, query, id, required)
+}
+
+// authorizeFileID is authorizeFile for a file named elsewhere than the :id parameter, such as in
+// the body of a request on several files
+func authorizeFileID(c *fiber.Ctx, db *gorm.DB, query *gorm.DB, id uuid.UUID, required fileAccess) (*models.FileUpload, error) {
+	var file models.FileUpload
+	if err := query.Where("id = ?", id).First(&file).Error; err != nil {
+		return nil, err
+	}
+
+	access, err := callerFileAccess(c, db, &file)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case access == fileAccessNone:
+		return nil, gorm.ErrRecordNotFound
+	case access < required && required == fileAccessWrite:
+		return nil, fiber.NewError(fiber.StatusForbidden, "You do not have write access to this file")
+	case access < required:
+		return nil, fiber.NewError(fiber.StatusForbidden, "Only the uploader or an organization admin can do this")
+	}
+	return &file, nil
+}
+
+// callerFileAccess works out the caller's access to a file. Members of the file's tenant can read
+// it, and its uploader and the owners and admins of its organization manage it. Anyone else, or a
+// member needing more, relies on a permission granted on the file. The rules are those of
+// fileAccessCondition, so a single file and a folder's worth of files are checked alike.
+func callerFileAccess(c *fiber.Ctx, db *gorm.DB, file *models.FileUpload) (fileAccess, error) {
+	query := "SELECT CASE"
+	var args []interface{}
+	for _, level := range []fileAccess{fileAccessManage, fileAccessWrite, fileAccessRead} {
+		condition, conditionArgs := fileAccessCondition(c, level)
+		query += fmt.Sprintf(" WHEN %s THEN %d", condition, level)
+		args = append(args, conditionArgs...)
+	}
+	query += fmt.Sprintf(` ELSE %d END FROM "authentication-app"."file_uploads" WHERE file_uploads.id = ?`, fileAccessNone)
+	args = append(args, file.ID)
+
+	var access int
+	if err := db.Raw(query, args...).Scan(&access).Error; err != nil {
+		return fileAccessNone, err
+	}
+	return fileAccess(access), nil
+}
+
+// fileAccessCondition is the access rule of every file endpoint as a SQL condition on file_uploads,
+// for callerFileAccess and for statements on many files at once such as the files in a folder's
+// subtree. It holds for the files the caller has at least the required access to.
+func fileAccessCondition(c *fiber.Ctx, required fileAccess) (string, []interface{}) {
+	userID := c.Locals("user_id").(uuid.UUID)
+	orgID, _ := c.Locals("org_id").(uuid.UUID)
+	orgRole, _ := c.Locals("org_role").(string)
+
+	var conditions []string
+	var args []interface{}
+	switch {
+	case orgID == uuid.Nil:
+		conditions = append(conditions, "(file_uploads.organization_id IS NULL AND file_uploads.user_id = ?)")
+		args = append(args, userID)
+	case required == fileAccessRead || models.OrgRoleRank(orgRole) >= models.OrgRoleRank(models.OrgRoleAdmin):
+		conditions = append(conditions, "file_uploads.organization_id = ?")
+		args = append(args, orgID)
+	default:
+		conditions = append(conditions, "(file_uploads.organization_id = ? AND file_uploads.user_id = ?)")
+		args = append(args, orgID, userID)
+	}
+
+	if required <= fileAccessWrite {
+		permissions := []string{models.FilePermissionWrite}
+		if required == fileAccessRead {
+			permissions = append(permissions, models.FilePermissionRead)
+		}
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM "authentication-app"."file_permissions" p
+			WHERE p.file_id = file_uploads.id AND p.user_id = ? AND p.permission IN ?)`)
+		args = append(args, userID, permissions)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// allFilesAccessible reports whether the caller holds at least the required access to every file the
+// query selects. The query selects from file_uploads and ends in its WHERE clause, to which the access
+// condition is added.
+func allFilesAccessible(c *fiber.Ctx, db *gorm.DB, required fileAccess, query string, args ...interface{}) (bool, error) {
+	condition, conditionArgs := fileAccessCondition(c, required)
+	var denied bool
+	err := db.Raw("SELECT EXISTS ("+query+" AND NOT "+condition+")", append(args, conditionArgs...)...).Scan(&denied).Error
+	return !denied, err
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"archive/zip"
+	"authentication-app/config"
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"authentication-app/pkg/storage"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+// archiveEntry is a file to be written to an archive under a path inside it
+type archiveEntry struct {
+	file models.FileUpload
+	dir  string
+}
+
+type ArchiveController struct {
+	logger   golog.Logger
+	db       *gorm.DB
+	storage  *storage.Registry
+	maxSize  int64
+	maxFiles int
+}
+
+func NewArchiveController(cfg *config.Config, logger golog.Logger, db *gorm.DB, storage *storage.Registry) *ArchiveController {
+	return &ArchiveController{
+		logger:   logger,
+		db:       db,
+		storage:  storage,
+		maxSize:  cfg.ArchiveMaxSizeMB * 1024 * 1024,
+		maxFiles: cfg.ArchiveMaxFiles,
+	}
+}
+
+// @Summary Download files as a ZIP archive
+// @Description Stream a ZIP archive of several files, given either as a list of file IDs or as a folder whose whole subtree is included with its directory structure, leaving out the files the caller cannot read. Every listed file must be readable by the caller. Names that collide in a directory get a numbered suffix, and quarantined files are left out. The archive is limited in files and total size.
+// @Tags File
+// @Accept json
+// @Produce application/zip
+// @Param request body dto.CreateArchiveRequest true "File IDs or folder ID"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/archive [post]
+func (ac *ArchiveController) CreateArchive(c *fiber.Ctx) error {
+	var req dto.CreateArchiveRequest
+	if err := c.BodyParser(&req); err != nil || (len(req.FileIDs) == 0) == (req.FolderID == nil) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Either file_ids or folder_id is required",
+		})
+	}
+
+	var entries []archiveEntry
+	name := "files.zip"
+	if req.FolderID != nil {
+		folder, err := findTenantFolder(c, ac.db, *req.FolderID)
+		if err != nil {
+			return folderError(c, ac.logger, err)
+		}
+		if entries, err = ac.folderEntries(c, folder); err != nil {
+			ac.logger.Errorf("Failed to list files of folder %s: %v", folder.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		name = folder.Name + ".zip"
+	} else {
+		if len(req.FileIDs) > ac.maxFiles {
+			return ac.tooLarge(c)
+		}
+		seen := make(map[uuid.UUID]bool, len(req.FileIDs))
+		for _, id := range req.FileIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			file, err := authorizeFileID(c, ac.db, ac.db, id, fileAccessRead)
+			if err != nil {
+				return fileError(c, ac.logger, err)
+			}
+			entries = append(entries, archiveEntry{file: *file})
+		}
+	}
+
+	if len(entries) > ac.maxFiles {
+		return ac.tooLarge(c)
+	}
+
+	// Quarantined content cannot be downloaded, in an archive or otherwise
+	kept := entries[:0]
+	var total int64
+	for _, entry := range entries {
+		if entry.file.ScanStatus == models.ScanStatusInfected {
+			continue
+		}
+		kept = append(kept, entry)
+		total += entry.file.Size
+	}
+	entries = kept
+	if total > ac.maxSize {
+		return ac.tooLarge(c)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, contentDisposition("attachment", name))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+
+	// The archive is written while it is sent, one file at a time, after the handler has returned;
+	// the request context is gone by then
+	logger, registry := ac.logger, ac.storage
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := writeArchive(context.Background(), registry, w, entries); err != nil {
+			// The status is already sent; a truncated archive is how the client learns of the failure
+			logger.Errorf("Failed to stream archive: %v", err)
+		}
+	})
+	return nil
+}
+
+// folderEntries lists the files in a folder's subtree that are not in the trash and that the caller
+// can read, each under the path of its folder relative to the folder's parent
+func (ac *ArchiveController) folderEntries(c *fiber.Ctx, folder *models.Folder) ([]archiveEntry, error) {
+	readable, readableArgs := fileAccessCondition(c, fileAccessRead)
+	var rows []struct {
+		models.FileUpload
+		Dir string `gorm:"column:dir"`
+	}
+	err := ac.db.Raw(`WITH RECURSIVE subtree AS (
+			SELECT id, name::text AS dir FROM "authentication-app"."folders" WHERE id = ?
+			UNION ALL
+			SELECT f.id, s.dir || '/' || f.name FROM "authentication-app"."folders" f JOIN subtree s ON f.parent_id = s.id WHERE f.deleted_at IS NULL
+		)
+		SELECT file_uploads.*, subtree.dir FROM "authentication-app"."file_uploads"
+		JOIN subtree ON file_uploads.folder_id = subtree.id
+		WHERE file_uploads.deleted_at IS NULL AND `+readable+`
+		ORDER BY subtree.dir, file_uploads.original_name, file_uploads.id
+		LIMIT ?`, append(append([]interface{}{folder.ID}, readableArgs...), ac.maxFiles+1)...).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]archiveEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, archiveEntry{file: row.FileUpload, dir: row.Dir})
+	}
+	return entries, nil
+}
+
+func (ac *ArchiveController) tooLarge(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"error": fmt.Sprintf("An archive can hold at most %d files and %d MB", ac.maxFiles, ac.maxSize/(1024*1024)),
+	})
+}
+
+// writeArchive streams the entries into a ZIP archive, flushing after every file so nothing more
+// than a buffer is held in memory
+func writeArchive(ctx context.Context, registry *storage.Registry, w *bufio.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	names := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:     archiveName(names, entry.dir, entry.file.OriginalName),
+			Method:   zip.Deflate,
+			Modified: entry.file.CreatedAt,
+		}
+		if entry.file.UpdatedAt != nil {
+			header.Modified = *entry.file.UpdatedAt
+		}
+		// Images are compressed already
+		if strings.HasPrefix(entry.file.ContentType, "image/") {
+			header.Method = zip.Store
+		}
+
+		if err := writeArchiveEntry(ctx, registry, zw, header, &entry.file); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func writeArchiveEntry(ctx context.Context, registry *storage.Registry, zw *zip.Writer, header *zip.FileHeader, file *models.FileUpload) error {
+	backend, err := registry.Backend(file.StorageBackend)
+	if err != nil {
+		return err
+	}
+	src, err := backend.Get(ctx, file.StorageKey)
+	if err != nil {
+		return fmt.Errorf("open file %s: %w", file.ID, err)
+	}
+	defer src.Close()
+
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("write file %s: %w", file.ID, err)
+	}
+	return nil
+}
+
+// archiveName places a file name in a directory of the archive, numbering names that are taken
+// already, e.g. photo (1).jpg. Names are compared case-insensitively, as most file systems the
+// archive is extracted on do, and cannot leave their directory.
+func archiveName(taken map[string]bool, dir string, name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "file"
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := path.Join(dir, name)
+	for i := 1; taken[strings.ToLower(candidate)]; i++ {
+		candidate = path.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+	}
+	taken[strings.ToLower(candidate)] = true
+	return candidate
+}
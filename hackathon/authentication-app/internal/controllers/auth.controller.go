@@ -3,8 +3,11 @@ package controllers
 import (
 	"authentication-app/config"
 	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/authenticator"
+	"authentication-app/internal/middleware"
 	"authentication-app/internal/models"
 	"authentication-app/pkg/utils"
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -15,16 +18,18 @@ import (
 )
 
 type AuthController struct {
-	cfg    *config.Config
-	logger golog.Logger
-	db     *gorm.DB
+	cfg           *config.Config
+	logger        golog.Logger
+	db            *gorm.DB
+	authenticator authenticator.Authenticator
 }
 
-func NewAuthController(cfg *config.Config, logger golog.Logger, db *gorm.DB) *AuthController {
+func NewAuthController(cfg *config.Config, logger golog.Logger, db *gorm.DB, auth authenticator.Authenticator) *AuthController {
 	return &AuthController{
-		cfg:    cfg,
-		logger: logger,
-		db:     db,
+		cfg:           cfg,
+		logger:        logger,
+		db:            db,
+		authenticator: auth,
 	}
 }
 
@@ -34,6 +39,7 @@ func NewAuthController(cfg *config.Config, logger golog.Logger, db *gorm.DB) *Au
 // @Accept json
 // @Produce json
 // @Param request body dto.RegisterRequest true "Registration details"
+// @Param X-Session-Mode header string false "Set to 'cookie' to receive the token as an HttpOnly cookie"
 // @Success 201 {object} dto.AuthResponse
 // @Failure 400 {object} map[string]string
 // @Failure 409 {object} map[string]string
@@ -87,6 +93,9 @@ func (ac *AuthController) Register(c *fiber.Ctx) error {
 		ID:           uuid.New(),
 		Username:     req.Username,
 		PasswordHash: string(hashedPassword),
+		AuthSource:   models.AuthSourceLocal,
+		Role:         models.RoleUser,
+		Active:       true,
 		CreatedAt:    time.Now(),
 	}
 
@@ -97,31 +106,16 @@ func (ac *AuthController) Register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := utils.GenerateJWTToken(user.ID, user.Username, ac.cfg.JWTSecret, ac.cfg.JWTExpireMinutes)
-	if err != nil {
-		ac.logger.Errorf("Failed to generate token: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate token",
-		})
-	}
-
-	return c.Status(fiber.StatusCreated).JSON(dto.AuthResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
-		User: dto.UserInfo{
-			ID:       user.ID,
-			Username: user.Username,
-		},
-	})
+	return respondWithToken(c, ac.cfg, ac.logger, fiber.StatusCreated, &user, uuid.Nil)
 }
 
 // @Summary Login user
-// @Description Login with username and password
+// @Description Login with username and password against the configured authentication backends
 // @Tags Auth
 // @Accept json
 // @Produce json
 // @Param request body dto.LoginRequest true "Login credentials"
+// @Param X-Session-Mode header string false "Set to 'cookie' to receive the token as an HttpOnly cookie"
 // @Success 200 {object} dto.AuthResponse
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
@@ -134,44 +128,60 @@ func (ac *AuthController) Login(c *fiber.Ctx) error {
 		})
 	}
 
-	// Find user
-	var user models.User
-	if err := ac.db.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	user, err := ac.authenticator.Authenticate(c.UserContext(), req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, authenticator.ErrInvalidCredentials) {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid credentials",
 			})
 		}
-		ac.logger.Errorf("Database error: %v", err)
+		ac.logger.Errorf("Authentication error: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
-	// Check password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+	return respondWithToken(c, ac.cfg, ac.logger, fiber.StatusOK, user, uuid.Nil)
+}
+
+// respondWithToken signs a JWT for the user, optionally scoped to an active organization,
+// and writes the standard auth response
+func respondWithToken(c *fiber.Ctx, cfg *config.Config, logger golog.Logger, status int, user *models.User, orgID uuid.UUID) error {
+	// Deprovisioned accounts keep their row but may not start new sessions
+	if !user.Active {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid credentials",
+			"error": "Account is disabled",
 		})
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := utils.GenerateJWTToken(user.ID, user.Username, ac.cfg.JWTSecret, ac.cfg.JWTExpireMinutes)
+	token, expiresAt, err := utils.GenerateJWTToken(user.ID, user.Username, user.Role, orgID, cfg.JWTSecret, cfg.JWTExpireMinutes)
 	if err != nil {
-		ac.logger.Errorf("Failed to generate token: %v", err)
+		logger.Errorf("Failed to generate token: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
-	return c.JSON(dto.AuthResponse{
+	resp := dto.AuthResponse{
 		Token:     token,
 		ExpiresAt: expiresAt,
 		User: dto.UserInfo{
 			ID:       user.ID,
 			Username: user.Username,
+			Role:     user.Role,
 		},
-	})
+	}
+	if orgID != uuid.Nil {
+		resp.OrganizationID = &orgID
+	}
+
+	// Browser sessions keep the JWT in an HttpOnly cookie, out of reach of page scripts
+	if middleware.WantsCookieSession(c) {
+		resp.CSRFToken = middleware.SetSessionCookies(c, cfg, token, expiresAt)
+		resp.Token = ""
+	}
+
+	return c.Status(status).JSON(resp)
 }
 
 // @Summary Revoke token
@@ -184,6 +194,84 @@ func (ac *AuthController) Login(c *fiber.Ctx) error {
 // @Security BearerAuth
 // @Router /auth/revoke [post]
 func (ac *AuthController) RevokeToken(c *fiber.Ctx) error {
+	if err := ac.revokeCurrentToken(c); err != nil {
+		ac.logger.Errorf("Failed to revoke token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke token",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Token revoked successfully",
+	})
+}
+
+// @Summary Logout
+// @Description Revoke the current token and clear the browser session cookies
+// @Tags Auth
+// @Produce json
+// @Param X-CSRF-Token header string false "CSRF token, required when authenticating with the session cookie"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/logout [post]
+func (ac *AuthController) Logout(c *fiber.Ctx) error {
+	if err := ac.revokeCurrentToken(c); err != nil {
+		ac.logger.Errorf("Failed to revoke token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to logout",
+		})
+	}
+
+	middleware.ClearSessionCookies(c, ac.cfg)
+
+	return c.JSON(fiber.Map{
+		"message": "Logged out successfully",
+	})
+}
+
+// @Summary Current session
+// @Description Return the authenticated user, plus the CSRF token when the session comes from a cookie
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} dto.SessionResponse
+// @Failure 401 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/me [get]
+func (ac *AuthController) Me(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var user models.User
+	if err := ac.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		ac.logger.Errorf("Database error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	resp := dto.SessionResponse{
+		User: dto.UserInfo{
+			ID:       user.ID,
+			Username: user.Username,
+			Role:     user.Role,
+		},
+	}
+	if orgID := c.Locals("org_id").(uuid.UUID); orgID != uuid.Nil {
+		resp.OrganizationID = &orgID
+	}
+	if c.Locals("cookie_session").(bool) {
+		resp.CSRFToken = utils.GenerateCSRFToken(c.Locals("session_token").(string), ac.cfg.JWTSecret)
+	}
+
+	return c.JSON(resp)
+}
+
+func (ac *AuthController) revokeCurrentToken(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uuid.UUID)
 	tokenID := c.Locals("token_id").(string)
 
@@ -194,14 +282,5 @@ func (ac *AuthController) RevokeToken(c *fiber.Ctx) error {
 		RevokedAt: time.Now(),
 	}
 
-	if err := ac.db.Create(&revokedToken).Error; err != nil {
-		ac.logger.Errorf("Failed to revoke token: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to revoke token",
-		})
-	}
-
-	return c.JSON(fiber.Map{
-		"message": "Token revoked successfully",
-	})
+	return ac.db.Create(&revokedToken).Error
 }
@@ -1,12 +1,27 @@
 package controllers
 
 import (
+	dto "authentication-app/internal/DTOs"
 	"authentication-app/internal/models"
-	"authentication-app/pkg/utils"
+	"authentication-app/internal/upload"
+	"authentication-app/internal/workers"
+	"authentication-app/pkg/storage"
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"os"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -14,137 +29,832 @@ import (
 	"gorm.io/gorm"
 )
 
+// Limits on the tags and metadata of a file
+const (
+	maxTags              = 32
+	maxTagLength         = 64
+	maxMetadataKeys      = 64
+	maxMetadataKeyLength = 64
+	maxMetadataBytes     = 16 << 10
+)
+
 type FileController struct {
-	logger golog.Logger
-	db     *gorm.DB
+	logger   golog.Logger
+	db       *gorm.DB
+	storage  *storage.Registry
+	uploads  *upload.Service
+	variants *workers.VariantGenerator
 }
 
-func NewFileController(logger golog.Logger, db *gorm.DB) *FileController {
+func NewFileController(logger golog.Logger, db *gorm.DB, storage *storage.Registry, uploads *upload.Service, variants *workers.VariantGenerator) *FileController {
 	return &FileController{
-		logger: logger,
-		db:     db,
+		logger:   logger,
+		db:       db,
+		storage:  storage,
+		uploads:  uploads,
+		variants: variants,
 	}
 }
 
 // @Summary Upload file
-// @Description Upload an image file (max 8MB)
+// @Description Upload a file. Size, content type, extension, file count and storage quota are limited by the upload policy of the caller's role; the content must match the declared Content-Type. Images are checked against the dimension limits and stripped of metadata. Files are scanned for malware when a scanner is configured; infected files are quarantined and refused with 422. The form is read while it arrives, so folder_id must be sent before the file. A URL from POST /files/upload/presign can be used instead of a token.
 // @Tags File
 // @Accept multipart/form-data
 // @Produce json
-// @Param file formData file true "Image file to upload"
+// @Param file formData file true "File to upload"
+// @Param folder_id formData string false "Folder to upload into, sent before the file"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 503 {object} map[string]string
 // @Security BearerAuth
 // @Router /files/upload [post]
 func (ac *FileController) UploadFile(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uuid.UUID)
+	role, _ := c.Locals("role").(string)
 
-	// Get file from form
-	file, err := c.FormFile("file")
+	// The form is parsed while it arrives and the file streamed on to storage from the body
+	form, err := readMultipartUpload(c, "file")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "No file provided or invalid form data",
 		})
 	}
+	defer form.finish(c)
+
+	var folderID *uuid.UUID
+	if value := form.fields["folder_id"]; value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return folderError(c, ac.logger, gorm.ErrRecordNotFound)
+		}
+		if _, err := findTenantFolder(c, ac.db, id); err != nil {
+			return folderError(c, ac.logger, err)
+		}
+		folderID = &id
+	}
+
+	// Parts carry no length; the size limit is enforced while the content is read
+	request := upload.Request{
+		UserID:       userID,
+		FolderID:     folderID,
+		Role:         role,
+		Filename:     form.file.FileName(),
+		DeclaredType: form.file.Header.Get("Content-Type"),
+		Size:         -1,
+		Body:         form.file,
+		UserAgent:    c.Get("User-Agent"),
+		IPAddress:    c.IP(),
+	}
+
+	// Files uploaded while an organization is active belong to that organization
+	if orgID, ok := c.Locals("org_id").(uuid.UUID); ok && orgID != uuid.Nil {
+		request.OrganizationID = &orgID
+	}
 
-	// Check file size (8MB = 8 * 1024 * 1024 bytes)
-	maxSize := int64(8 * 1024 * 1024)
-	if file.Size > maxSize {
-		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
-			"error": "File size exceeds 8MB limit",
+	fileUpload, err := ac.uploads.Ingest(c.UserContext(), request)
+	if err != nil {
+		var violation *upload.Violation
+		if errors.As(err, &violation) {
+			return c.Status(violationStatus(violation)).JSON(fiber.Map{
+				"error": violation.Message,
+			})
+		}
+		if errors.Is(err, upload.ErrScanUnavailable) {
+			ac.logger.Errorf("Failed to upload file: %v", err)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "File could not be scanned for malware, please try again later",
+			})
+		}
+		ac.logger.Errorf("Failed to upload file: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save file",
 		})
 	}
+	ac.variants.Enqueue(fileUpload.ID)
 
-	// Check if file is an image
-	if !utils.IsImageContentType(file.Header.Get("Content-Type")) {
+	return c.JSON(fiber.Map{
+		"message":         "File uploaded successfully",
+		"file_id":         fileUpload.ID,
+		"filename":        fileUpload.Filename,
+		"original_name":   fileUpload.OriginalName,
+		"content_type":    fileUpload.ContentType,
+		"size":            fileUpload.Size,
+		"width":           fileUpload.Width,
+		"height":          fileUpload.Height,
+		"sha256":          fileUpload.SHA256,
+		"scan_status":     fileUpload.ScanStatus,
+		"uploaded_at":     fileUpload.CreatedAt,
+		"organization_id": fileUpload.OrganizationID,
+		"folder_id":       fileUpload.FolderID,
+	})
+}
+
+// @Summary Get upload quota
+// @Description Get my storage usage and the upload policy that applies to me. Trashed files count until they are purged; zero limits mean unlimited.
+// @Tags File
+// @Produce json
+// @Success 200 {object} dto.QuotaResponse
+// @Security BearerAuth
+// @Router /files/quota [get]
+func (ac *FileController) GetQuota(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+	role, _ := c.Locals("role").(string)
+
+	usage, err := ac.uploads.Usage(c.UserContext(), userID)
+	if err != nil {
+		ac.logger.Errorf("Failed to compute storage usage: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	policy := ac.uploads.Policy(role)
+	return c.JSON(dto.QuotaResponse{
+		UsedBytes:         usage.Bytes,
+		QuotaBytes:        policy.QuotaBytes,
+		FileCount:         usage.Files,
+		MaxFiles:          policy.MaxFiles,
+		MaxFileSize:       policy.MaxFileSize,
+		AllowedTypes:      policy.AllowedTypes,
+		AllowedExtensions: policy.AllowedExtensions,
+	})
+}
+
+// @Summary List files
+// @Description List the files of the active tenant: my personal files, or the active organization's files
+// @Tags File
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Param sort query string false "Sort field (created_at or size)" default(created_at)
+// @Param order query string false "Sort order (asc or desc)" default(desc)
+// @Param content_type query string false "Content type filter, e.g. image/png or image/*"
+// @Success 200 {object} dto.FileListResponse
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /files [get]
+func (ac *FileController) ListFiles(c *fiber.Ctx) error {
+	sort := c.Query("sort", "created_at")
+	if sort != "created_at" && sort != "size" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "sort must be created_at or size",
+		})
+	}
+
+	order := strings.ToLower(c.Query("order", "desc"))
+	if order != "asc" && order != "desc" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "File must be an image (JPEG, PNG, GIF, WebP)",
+			"error": "order must be asc or desc",
+		})
+	}
+
+	page, pageSize := pagination(c)
+	query := ac.db.Model(&models.FileUpload{}).Scopes(tenantFiles(c))
+
+	if contentType := c.Query("content_type"); contentType != "" {
+		if prefix, ok := strings.CutSuffix(contentType, "/*"); ok {
+			query = query.Where("content_type LIKE ?", prefix+"/%")
+		} else {
+			query = query.Where("content_type = ?", contentType)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		ac.logger.Errorf("Failed to count files: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
 		})
 	}
 
-	// Open file to verify content type
-	src, err := file.Open()
+	var files []models.FileUpload
+	// The id tiebreaker keeps pages stable when several files share a sort value
+	if err := query.Order(fmt.Sprintf("%s %s, id %s", sort, order, order)).Offset((page - 1) * pageSize).Limit(pageSize).Find(&files).Error; err != nil {
+		ac.logger.Errorf("Failed to list files: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	resp := dto.FileListResponse{
+		Files:    make([]dto.FileResponse, 0, len(files)),
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}
+	for _, file := range files {
+		resp.Files = append(resp.Files, toFileResponse(file))
+	}
+
+	return c.JSON(resp)
+}
+
+// @Summary Get file
+// @Description Get the metadata of a file
+// @Tags File
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {object} dto.FileResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id} [get]
+func (ac *FileController) GetFile(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, ac.db, fileAccessRead)
 	if err != nil {
-		ac.logger.Errorf("Failed to open uploaded file: %v", err)
+		return fileError(c, ac.logger, err)
+	}
+
+	if err := ac.db.Where("file_id = ?", file.ID).Order("name").Find(&file.Variants).Error; err != nil {
+		ac.logger.Errorf("Failed to load variants of file %s: %v", file.ID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process file",
+			"error": "Internal server error",
 		})
 	}
-	defer src.Close()
 
-	// Read first 512 bytes to detect content type
-	buffer := make([]byte, 512)
-	_, err = src.Read(buffer)
-	if err != nil && err != io.EOF {
-		ac.logger.Errorf("Failed to read file header: %v", err)
+	return c.JSON(toFileResponse(*file))
+}
+
+// @Summary Update file
+// @Description Change the tags and metadata of a file. Tags replace the current list and are stored in lower case; metadata is merged into the current object, and keys set to null are removed. Requires write access.
+// @Tags File
+// @Accept json
+// @Produce json
+// @Param id path string true "File ID"
+// @Param request body dto.UpdateFileRequest true "Tags and metadata"
+// @Success 200 {object} dto.FileResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id} [patch]
+func (ac *FileController) UpdateFile(c *fiber.Ctx) error {
+	var req dto.UpdateFileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	file, err := authorizeFile(c, ac.db, fileAccessWrite)
+	if err != nil {
+		return fileError(c, ac.logger, err)
+	}
+
+	updates := map[string]interface{}{}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		file.Tags = tags
+		updates["tags"] = file.Tags
+	}
+	if req.Metadata != nil {
+		metadata, err := mergeMetadata(file.Metadata, req.Metadata)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		file.Metadata = metadata
+		updates["metadata"] = file.Metadata
+	}
+
+	if len(updates) > 0 {
+		now := time.Now()
+		updates["updated_at"] = now
+		if err := ac.db.Model(file).Updates(updates).Error; err != nil {
+			ac.logger.Errorf("Failed to update file %s: %v", file.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update file",
+			})
+		}
+		file.UpdatedAt = &now
+	}
+
+	return c.JSON(toFileResponse(*file))
+}
+
+// @Summary Download file
+// @Description Stream the content of a file, or of one of its image variants, as an attachment named after its original name. The original carries its SHA-256 in a Repr-Digest header and as its strong ETag. Range requests get 206 with a single part or multipart/byteranges, conditional on If-Range; If-None-Match and If-Modified-Since get 304. A URL from POST /files/{id}/presign can be used instead of a token. Quarantined files answer 403.
+// @Tags File
+// @Produce octet-stream
+// @Param id path string true "File ID"
+// @Param variant query string false "Variant name, e.g. thumb"
+// @Param Range header string false "Byte ranges, e.g. bytes=0-1023"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 416 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/content [get]
+func (ac *FileController) DownloadFile(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, ac.db, fileAccessRead)
+	if err != nil {
+		return fileError(c, ac.logger, err)
+	}
+
+	content := originalContent(file)
+	if name := c.Query("variant"); name != "" {
+		var variant models.FileVariant
+		if err := ac.db.Where("file_id = ? AND name = ?", file.ID, name).First(&variant).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Variant not found",
+				})
+			}
+			ac.logger.Errorf("Failed to load variant %s of file %s: %v", name, file.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		content = variantContent(file, &variant)
+	}
+
+	return streamContent(c, ac.logger, ac.storage, file, content, nil)
+}
+
+// @Summary Delete file
+// @Description Move a file to the trash. It can be restored until the trash retention period ends. Requires write access.
+// @Tags File
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id} [delete]
+func (ac *FileController) DeleteFile(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, ac.db, fileAccessWrite)
+	if err != nil {
+		return fileError(c, ac.logger, err)
+	}
+
+	if err := ac.db.Delete(file).Error; err != nil {
+		ac.logger.Errorf("Failed to delete file %s: %v", file.ID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process file",
+			"error": "Failed to delete file",
 		})
 	}
 
-	// Reset file pointer
-	src.Close()
-	src, err = file.Open()
+	return c.JSON(fiber.Map{
+		"message": "File moved to trash",
+	})
+}
+
+// @Summary Restore file
+// @Description Restore a file from the trash. Requires write access.
+// @Tags File
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {object} dto.FileResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/restore [post]
+func (ac *FileController) RestoreFile(c *fiber.Ctx) error {
+	file, err := authorizeTrashedFile(c, ac.db, fileAccessWrite)
 	if err != nil {
-		ac.logger.Errorf("Failed to reopen uploaded file: %v", err)
+		return fileError(c, ac.logger, err)
+	}
+
+	// A file whose folder is still in the trash comes back at the top level
+	if file.FolderID != nil {
+		live, err := folderExists(ac.db, *file.FolderID)
+		if err != nil {
+			return fileError(c, ac.logger, err)
+		}
+		if !live {
+			file.FolderID = nil
+		}
+	}
+
+	now := time.Now()
+	if err := ac.db.Unscoped().Model(file).Updates(map[string]interface{}{
+		"folder_id":  file.FolderID,
+		"deleted_at": nil,
+		"updated_at": now,
+	}).Error; err != nil {
+		ac.logger.Errorf("Failed to restore file %s: %v", file.ID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process file",
+			"error": "Failed to restore file",
 		})
 	}
-	defer src.Close()
+	file.DeletedAt = gorm.DeletedAt{}
+	file.UpdatedAt = &now
 
-	// Generate unique filename
-	filename := utils.GenerateUniqueFilename(file.Filename)
-	filePath := filepath.Join("./tmp", filename)
+	return c.JSON(toFileResponse(*file))
+}
+
+// @Summary Move file
+// @Description Move a file into a folder of the same tenant, or to the top level when folder_id is null
+// @Tags File
+// @Accept json
+// @Produce json
+// @Param id path string true "File ID"
+// @Param request body dto.MoveFileRequest true "Target folder"
+// @Success 200 {object} dto.FileResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/move [post]
+func (ac *FileController) MoveFile(c *fiber.Ctx) error {
+	var req dto.MoveFileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
 
-	// Save file to /tmp
-	dst, err := os.Create(filePath)
+	file, err := authorizeFile(c, ac.db, fileAccessManage)
 	if err != nil {
-		ac.logger.Errorf("Failed to create temp file: %v", err)
+		return fileError(c, ac.logger, err)
+	}
+
+	if req.FolderID != nil {
+		if _, err := findTenantFolder(c, ac.db, *req.FolderID); err != nil {
+			return folderError(c, ac.logger, err)
+		}
+	}
+
+	now := time.Now()
+	if err := ac.db.Model(file).Updates(map[string]interface{}{
+		"folder_id":  req.FolderID,
+		"updated_at": now,
+	}).Error; err != nil {
+		ac.logger.Errorf("Failed to move file %s: %v", file.ID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to save file",
+			"error": "Failed to move file",
 		})
 	}
-	defer dst.Close()
+	file.FolderID = req.FolderID
+	file.UpdatedAt = &now
 
-	if _, err := io.Copy(dst, src); err != nil {
-		ac.logger.Errorf("Failed to copy file data: %v", err)
-		os.Remove(filePath)
+	return c.JSON(toFileResponse(*file))
+}
+
+// @Summary List trash
+// @Description List the trashed files of the active tenant, most recently deleted first
+// @Tags File
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} dto.FileListResponse
+// @Security BearerAuth
+// @Router /files/trash [get]
+func (ac *FileController) ListTrash(c *fiber.Ctx) error {
+	page, pageSize := pagination(c)
+	query := ac.db.Unscoped().Model(&models.FileUpload{}).Scopes(tenantFiles(c)).Where("deleted_at IS NOT NULL")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		ac.logger.Errorf("Failed to count trashed files: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to save file",
+			"error": "Internal server error",
 		})
 	}
 
-	// Save file metadata to database
-	fileUpload := models.FileUpload{
-		ID:           uuid.New(),
-		UserID:       userID,
-		Filename:     filename,
-		OriginalName: file.Filename,
-		ContentType:  file.Header.Get("Content-Type"),
-		Size:         file.Size,
-		FilePath:     filePath,
-		UserAgent:    c.Get("User-Agent"),
-		IPAddress:    c.IP(),
-		CreatedAt:    time.Now(),
+	var files []models.FileUpload
+	if err := query.Order("deleted_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&files).Error; err != nil {
+		ac.logger.Errorf("Failed to list trashed files: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	resp := dto.FileListResponse{
+		Files:    make([]dto.FileResponse, 0, len(files)),
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}
+	for _, file := range files {
+		resp.Files = append(resp.Files, toFileResponse(file))
+	}
+
+	return c.JSON(resp)
+}
+
+// violationStatus maps an upload policy violation to its HTTP status
+func violationStatus(violation *upload.Violation) int {
+	switch {
+	case errors.Is(violation, upload.ErrFileTooLarge):
+		return fiber.StatusRequestEntityTooLarge
+	case errors.Is(violation, upload.ErrFileLimitReached), errors.Is(violation, upload.ErrQuotaExceeded):
+		return fiber.StatusForbidden
+	case errors.Is(violation, upload.ErrInfected):
+		return fiber.StatusUnprocessableEntity
+	default:
+		return fiber.StatusBadRequest
+	}
+}
+
+// normalizeTags trims and lower-cases tags, drops duplicates and checks the limits
+func normalizeTags(tags []string) (models.Tags, error) {
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("A file can have at most %d tags", maxTags)
+	}
+	normalized := make(models.Tags, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case tag == "":
+			return nil, errors.New("Tags must not be empty")
+		case utf8.RuneCountInString(tag) > maxTagLength:
+			return nil, fmt.Errorf("Tags must be at most %d characters", maxTagLength)
+		case strings.Contains(tag, ","):
+			return nil, errors.New("Tags must not contain commas")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// mergeMetadata applies a patch to a file's metadata: keys set to null are removed, others are set
+func mergeMetadata(current models.Metadata, patch map[string]interface{}) (models.Metadata, error) {
+	merged := make(models.Metadata, len(current)+len(patch))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		if key == "" || utf8.RuneCountInString(key) > maxMetadataKeyLength {
+			return nil, fmt.Errorf("Metadata keys must be 1 to %d characters", maxMetadataKeyLength)
+		}
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+
+	if len(merged) > maxMetadataKeys {
+		return nil, fmt.Errorf("A file can have at most %d metadata keys", maxMetadataKeys)
+	}
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return nil, errors.New("Metadata must be a JSON object")
+	}
+	if len(encoded) > maxMetadataBytes {
+		return nil, fmt.Errorf("Metadata must be at most %d bytes", maxMetadataBytes)
+	}
+	return merged, nil
+}
+
+// streamContent answers a download: conditional requests, the content headers and the stream of
+// the whole content, a single range or several as multipart/byteranges. A non-nil claim runs once
+// the content is known to be sent; when it refuses, it has written the response itself.
+func streamContent(c *fiber.Ctx, logger golog.Logger, registry *storage.Registry, file *models.FileUpload, content storedContent, claim func() (bool, error)) error {
+	if content.quarantined {
+		return quarantinedError(c)
+	}
+
+	c.Set(fiber.HeaderETag, content.etag)
+	c.Set(fiber.HeaderLastModified, content.modified.UTC().Format(http.TimeFormat))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	// A signed URL is its own credential, so caches in front of the app may keep the response
+	// for as long as the URL is valid
+	if until, ok := c.Locals("presigned_until").(time.Time); ok {
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d, immutable", max(int(time.Until(until).Seconds()), 0)))
+	}
+	if notModified(c, content) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	ranges, err := requestedRanges(c, content)
+	if err != nil {
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", content.size))
+		return c.Status(fiber.StatusRequestedRangeNotSatisfiable).JSON(fiber.Map{
+			"error": "Requested range not satisfiable",
+		})
 	}
 
-	if err := ac.db.Create(&fileUpload).Error; err != nil {
-		ac.logger.Errorf("Failed to save file metadata: %v", err)
-		os.Remove(filePath)
+	// The first part is opened before anything is sent, so a missing object still gets a 404
+	whole := byteRange{start: 0, length: content.size}
+	first := whole
+	if len(ranges) > 0 {
+		first = ranges[0]
+	}
+	src, err := openContent(c.UserContext(), registry, content, first)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			logger.Warnf("Content %s of file %s is missing from %s", content.key, file.ID, content.backend)
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "File content not found",
+			})
+		}
+		logger.Errorf("Failed to open file %s: %v", file.ID, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to save file metadata",
+			"error": "Failed to read file",
 		})
 	}
+	if claim != nil {
+		if ok, err := claim(); !ok {
+			src.Close()
+			return err
+		}
+	}
 
-	return c.JSON(fiber.Map{
-		"message":       "File uploaded successfully",
-		"file_id":       fileUpload.ID,
-		"filename":      filename,
-		"original_name": file.Filename,
-		"content_type":  file.Header.Get("Content-Type"),
-		"size":          file.Size,
-		"uploaded_at":   fileUpload.CreatedAt,
+	c.Set(fiber.HeaderContentDisposition, contentDisposition("attachment", content.filename))
+	// The stored content type was detected from the bytes at upload; nosniff keeps browsers from
+	// second-guessing it and rendering the file as something more dangerous, such as HTML
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	if content.digest != "" {
+		c.Set("Repr-Digest", content.digest)
+	}
+
+	switch len(ranges) {
+	case 0:
+		c.Set(fiber.HeaderContentType, content.contentType)
+		// fasthttp closes the reader once the stream has been written
+		return c.SendStream(src, int(content.size))
+	case 1:
+		c.Set(fiber.HeaderContentType, content.contentType)
+		c.Set(fiber.HeaderContentRange, first.contentRange(content.size))
+		return c.Status(fiber.StatusPartialContent).SendStream(src, int(first.length))
+	}
+
+	parts := multipart.NewWriter(io.Discard)
+	c.Set(fiber.HeaderContentType, "multipart/byteranges; boundary="+parts.Boundary())
+	c.Status(fiber.StatusPartialContent)
+	// The parts are written after the handler has returned; the request context is gone by then
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := writeByteRanges(w, parts.Boundary(), registry, content, ranges, src); err != nil {
+			logger.Errorf("Failed to stream ranges of file %s: %v", file.ID, err)
+		}
 	})
+	return nil
+}
+
+// writeByteRanges writes a multipart/byteranges body. first is the opened first range.
+func writeByteRanges(w *bufio.Writer, boundary string, registry *storage.Registry, content storedContent, ranges []byteRange, first io.ReadCloser) error {
+	parts := multipart.NewWriter(w)
+	if err := parts.SetBoundary(boundary); err != nil {
+		first.Close()
+		return err
+	}
+
+	for i, r := range ranges {
+		src := first
+		if i > 0 {
+			var err error
+			if src, err = openContent(context.Background(), registry, content, r); err != nil {
+				return err
+			}
+		}
+
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			fiber.HeaderContentType:  {content.contentType},
+			fiber.HeaderContentRange: {r.contentRange(content.size)},
+		})
+		if err == nil {
+			_, err = io.Copy(part, src)
+		}
+		src.Close()
+		if err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func quarantinedError(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "File is quarantined because malware was detected",
+	})
+}
+
+// openContent opens a range of the object in the backend its row records
+func openContent(ctx context.Context, registry *storage.Registry, content storedContent, r byteRange) (io.ReadCloser, error) {
+	backend, err := registry.Backend(content.backend)
+	if err != nil {
+		return nil, err
+	}
+	if r.start == 0 && r.length == content.size {
+		return backend.Get(ctx, content.key)
+	}
+	return backend.GetRange(ctx, content.key, r.start, r.length)
+}
+
+// storedContent is what a download streams: the current content of a file, one of its earlier
+// versions or one of its variants
+type storedContent struct {
+	backend     string
+	key         string
+	contentType string
+	size        int64
+	filename    string
+	etag        string
+	digest      string
+	modified    time.Time
+	quarantined bool
+}
+
+// The file changes when a version is promoted, but also when its tags or name change, so its
+// modification time only ever errs towards sending the content again
+func originalContent(file *models.FileUpload) storedContent {
+	modified := file.CreatedAt
+	if file.UpdatedAt != nil {
+		modified = *file.UpdatedAt
+	}
+	return storedContent{
+		backend:     file.StorageBackend,
+		key:         file.StorageKey,
+		contentType: file.ContentType,
+		size:        file.Size,
+		filename:    file.OriginalName,
+		etag:        contentETag(file.SHA256, fmt.Sprintf("%s-%d-%d", file.ID, file.Version, file.Size)),
+		digest:      reprDigest(file.SHA256),
+		modified:    modified,
+		quarantined: file.ScanStatus == models.ScanStatusInfected,
+	}
+}
+
+func versionContent(file *models.FileUpload, version *models.FileVersion) storedContent {
+	return storedContent{
+		backend:     version.StorageBackend,
+		key:         version.StorageKey,
+		contentType: version.ContentType,
+		size:        version.Size,
+		filename:    version.OriginalName,
+		etag:        contentETag(version.SHA256, fmt.Sprintf("%s-%d-%d", file.ID, version.Version, version.Size)),
+		digest:      reprDigest(version.SHA256),
+		modified:    version.CreatedAt,
+		quarantined: version.ScanStatus == models.ScanStatusInfected,
+	}
+}
+
+// contentETag is a strong entity tag for stored bytes: their SHA-256, or for content uploaded
+// before hashing a fallback that identifies it, since stored content never changes
+func contentETag(sha *string, fallback string) string {
+	if sha != nil {
+		return `"` + *sha + `"`
+	}
+	return `"` + fallback + `"`
+}
+
+// variantContent is named after the original, e.g. photo_thumb.webp for photo.png
+func variantContent(file *models.FileUpload, variant *models.FileVariant) storedContent {
+	base := strings.TrimSuffix(file.OriginalName, filepath.Ext(file.OriginalName))
+	return storedContent{
+		backend:     variant.StorageBackend,
+		key:         variant.StorageKey,
+		contentType: variant.ContentType,
+		size:        variant.Size,
+		filename:    base + "_" + variant.Name + filepath.Ext(variant.StorageKey),
+		etag:        fmt.Sprintf(`"%s-%d-%s-%d"`, file.ID, file.Version, variant.Name, variant.Size),
+		modified:    variant.CreatedAt,
+		quarantined: file.ScanStatus == models.ScanStatusInfected,
+	}
+}
+
+// reprDigest builds an RFC 9530 Repr-Digest header from the stored SHA-256, so clients can verify
+// what they downloaded. Content uploaded before hashing and quarantined content have none.
+func reprDigest(sha *string) string {
+	if sha == nil {
+		return ""
+	}
+	sum, err := hex.DecodeString(*sha)
+	if err != nil {
+		return ""
+	}
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+}
+
+// contentDisposition builds a Content-Disposition header, encoding non-ASCII names per RFC 2231
+func contentDisposition(disposition, filename string) string {
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// etagMatches reports whether an If-None-Match header lists the given entity tag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,616 @@
+package controllers
+
+import (
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+// rootFolder stands for the top level wherever a folder ID is expected in a path
+const rootFolder = "root"
+
+const maxFolderNameLength = 255
+
+var (
+	errFolderNameTaken = errors.New("folder name taken")
+	errFolderCycle     = errors.New("folder cycle")
+)
+
+type FolderController struct {
+	logger golog.Logger
+	db     *gorm.DB
+}
+
+func NewFolderController(logger golog.Logger, db *gorm.DB) *FolderController {
+	return &FolderController{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// @Summary Create folder
+// @Description Create a folder in the active tenant, at the top level or under parent_id. Names are unique among siblings, ignoring case.
+// @Tags Folder
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateFolderRequest true "Folder name and parent"
+// @Success 201 {object} dto.FolderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /folders [post]
+func (fc *FolderController) CreateFolder(c *fiber.Ctx) error {
+	var req dto.CreateFolderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	name, err := folderName(req.Name)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if req.ParentID != nil {
+		if _, err := findTenantFolder(c, fc.db, *req.ParentID); err != nil {
+			return folderError(c, fc.logger, err)
+		}
+	}
+
+	folder := models.Folder{
+		ID:        uuid.New(),
+		UserID:    c.Locals("user_id").(uuid.UUID),
+		ParentID:  req.ParentID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+	if orgID, ok := c.Locals("org_id").(uuid.UUID); ok && orgID != uuid.Nil {
+		folder.OrganizationID = &orgID
+	}
+
+	if err := fc.db.Create(&folder).Error; err != nil {
+		if isDuplicateKey(err) {
+			return folderError(c, fc.logger, errFolderNameTaken)
+		}
+		fc.logger.Errorf("Failed to create folder: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create folder",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toFolderResponse(folder))
+}
+
+// @Summary Get folder
+// @Description Get a folder with its path from the top level
+// @Tags Folder
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Success 200 {object} dto.FolderDetailResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /folders/{id} [get]
+func (fc *FolderController) GetFolder(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return folderError(c, fc.logger, gorm.ErrRecordNotFound)
+	}
+	folder, err := findTenantFolder(c, fc.db, id)
+	if err != nil {
+		return folderError(c, fc.logger, err)
+	}
+
+	path, err := folderPath(fc.db, folder.ID)
+	if err != nil {
+		return folderError(c, fc.logger, err)
+	}
+
+	return c.JSON(dto.FolderDetailResponse{
+		FolderResponse: toFolderResponse(*folder),
+		Path:           path,
+	})
+}
+
+// @Summary List folder contents
+// @Description List the subfolders and files of a folder, or of the top level with the ID "root". Subfolders come first, then files, each sorted by name; pages run across both.
+// @Tags Folder
+// @Produce json
+// @Param id path string true "Folder ID or root"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} dto.FolderChildrenResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /folders/{id}/children [get]
+func (fc *FolderController) ListChildren(c *fiber.Ctx) error {
+	resp := dto.FolderChildrenResponse{
+		Path:    []dto.FolderPathEntry{},
+		Folders: []dto.FolderResponse{},
+		Files:   []dto.FileResponse{},
+	}
+
+	folderQuery := fc.db.Model(&models.Folder{}).Scopes(tenantFolders(c))
+	fileQuery := fc.db.Model(&models.FileUpload{}).Scopes(tenantFiles(c))
+	if c.Params("id") == rootFolder {
+		folderQuery = folderQuery.Where("parent_id IS NULL")
+		fileQuery = fileQuery.Where("folder_id IS NULL")
+	} else {
+		id, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return folderError(c, fc.logger, gorm.ErrRecordNotFound)
+		}
+		folder, err := findTenantFolder(c, fc.db, id)
+		if err != nil {
+			return folderError(c, fc.logger, err)
+		}
+		if resp.Path, err = folderPath(fc.db, folder.ID); err != nil {
+			return folderError(c, fc.logger, err)
+		}
+		folderResp := toFolderResponse(*folder)
+		resp.Folder = &folderResp
+		folderQuery = folderQuery.Where("parent_id = ?", folder.ID)
+		fileQuery = fileQuery.Where("folder_id = ?", folder.ID)
+	}
+
+	if err := folderQuery.Count(&resp.TotalFolders).Error; err != nil {
+		return folderError(c, fc.logger, err)
+	}
+	if err := fileQuery.Count(&resp.TotalFiles).Error; err != nil {
+		return folderError(c, fc.logger, err)
+	}
+
+	// One page runs over the folders and then on into the files
+	page, pageSize := pagination(c)
+	offset := (page - 1) * pageSize
+	var folders []models.Folder
+	if err := folderQuery.Order("LOWER(name), id").Offset(offset).Limit(pageSize).Find(&folders).Error; err != nil {
+		return folderError(c, fc.logger, err)
+	}
+	var files []models.FileUpload
+	if remaining := pageSize - len(folders); remaining > 0 {
+		fileOffset := max(offset-int(resp.TotalFolders), 0)
+		if err := fileQuery.Order("LOWER(original_name), id").Offset(fileOffset).Limit(remaining).Find(&files).Error; err != nil {
+			return folderError(c, fc.logger, err)
+		}
+	}
+
+	resp.Page = page
+	resp.PageSize = pageSize
+	for _, folder := range folders {
+		resp.Folders = append(resp.Folders, toFolderResponse(folder))
+	}
+	for _, file := range files {
+		resp.Files = append(resp.Files, toFileResponse(file))
+	}
+	return c.JSON(resp)
+}
+
+// @Summary Rename folder
+// @Description Rename a folder
+// @Tags Folder
+// @Accept json
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Param request body dto.RenameFolderRequest true "New name"
+// @Success 200 {object} dto.FolderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /folders/{id} [patch]
+func (fc *FolderController) RenameFolder(c *fiber.Ctx) error {
+	var req dto.RenameFolderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	name, err := folderName(req.Name)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	folder, err := fc.modifiableFolder(c)
+	if err != nil {
+		return folderError(c, fc.logger, err)
+	}
+
+	now := time.Now()
+	if err := fc.db.Model(folder).Updates(map[string]interface{}{
+		"name":       name,
+		"updated_at": now,
+	}).Error; err != nil {
+		if isDuplicateKey(err) {
+			return folderError(c, fc.logger, errFolderNameTaken)
+		}
+		return folderError(c, fc.logger, err)
+	}
+	folder.Name = name
+	folder.UpdatedAt = &now
+
+	return c.JSON(toFolderResponse(*folder))
+}
+
+// @Summary Move folder
+// @Description Move a folder, with everything in it, under another folder or to the top level when parent_id is null
+// @Tags Folder
+// @Accept json
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Param request body dto.MoveFolderRequest true "New parent"
+// @Success 200 {object} dto.FolderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /folders/{id}/move [post]
+func (fc *FolderController) MoveFolder(c *fiber.Ctx) error {
+	var req dto.MoveFolderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	folder, err := fc.modifiableFolder(c)
+	if err != nil {
+		return folderError(c, fc.logger, err)
+	}
+
+	now := time.Now()
+	err = fc.db.Transaction(func(tx *gorm.DB) error {
+		// Serialize moves within the tenant, so two concurrent moves cannot close a cycle
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", "folders:"+tenantKey(folder).String()).Error; err != nil {
+			return err
+		}
+
+		if req.ParentID != nil {
+			if _, err := findTenantFolder(c, tx, *req.ParentID); err != nil {
+				return err
+			}
+			var ancestors []dto.FolderPathEntry
+			if ancestors, err = folderPath(tx, *req.ParentID); err != nil {
+				return err
+			}
+			for _, ancestor := range ancestors {
+				if ancestor.ID == folder.ID {
+					return errFolderCycle
+				}
+			}
+		}
+
+		return tx.Model(folder).Updates(map[string]interface{}{
+			"parent_id":  req.ParentID,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		if isDuplicateKey(err) {
+			err = errFolderNameTaken
+		}
+		return folderError(c, fc.logger, err)
+	}
+	folder.ParentID = req.ParentID
+	folder.UpdatedAt = &now
+
+	return c.JSON(toFolderResponse(*folder))
+}
+
+// @Summary Delete folder
+// @Description Move a folder to the trash together with its subfolders and the files in them. Everything can be restored with the folder until the trash retention period ends. Requires write access to every file in the folder.
+// @Tags Folder
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /folders/{id} [delete]
+func (fc *FolderController) DeleteFolder(c *fiber.Ctx) error {
+	folder, err := fc.modifiableFolder(c)
+	if err != nil {
+		return folderError(c, fc.logger, err)
+	}
+
+	// Everything is stamped with the same time, which is how a restore finds what went with the folder
+	now := time.Now()
+	err = fc.db.Transaction(func(tx *gorm.DB) error {
+		subtree := `WITH RECURSIVE subtree AS (
+				SELECT id FROM "authentication-app"."folders" WHERE id = ?
+				UNION
+				SELECT f.id FROM "authentication-app"."folders" f JOIN subtree s ON f.parent_id = s.id WHERE f.deleted_at IS NULL
+			) `
+		// Trashing the folder trashes its files, which needs the access that trashing them one by one does
+		allowed, err := allFilesAccessible(c, tx, fileAccessWrite, subtree+`SELECT 1 FROM "authentication-app"."file_uploads"
+			WHERE folder_id IN (SELECT id FROM subtree) AND deleted_at IS NULL`, folder.ID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fiber.NewError(fiber.StatusForbidden, "You do not have write access to every file in this folder")
+		}
+
+		if err := tx.Exec(subtree+`UPDATE "authentication-app"."file_uploads" SET deleted_at = ?
+			WHERE folder_id IN (SELECT id FROM subtree) AND deleted_at IS NULL`, folder.ID, now).Error; err != nil {
+			return err
+		}
+		return tx.Exec(subtree+`UPDATE "authentication-app"."folders" SET deleted_at = ?
+			WHERE id IN (SELECT id FROM subtree) AND deleted_at IS NULL`, folder.ID, now).Error
+	})
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return folderError(c, fc.logger, err)
+	}
+	if err != nil {
+		fc.logger.Errorf("Failed to delete folder %s: %v", folder.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete folder",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Folder moved to trash",
+	})
+}
+
+// @Summary Restore folder
+// @Description Restore a folder from the trash with the subfolders and files that were deleted with it. Files and folders trashed separately before stay in the trash. A folder whose parent is still in the trash is restored to the top level. Requires write access to every file restored.
+// @Tags Folder
+// @Produce json
+// @Param id path string true "Folder ID"
+// @Success 200 {object} dto.FolderResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /folders/{id}/restore [post]
+func (fc *FolderController) RestoreFolder(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return folderError(c, fc.logger, gorm.ErrRecordNotFound)
+	}
+
+	var folder models.Folder
+	if err := fc.db.Unscoped().Scopes(tenantFolders(c)).Where("id = ? AND deleted_at IS NOT NULL", id).First(&folder).Error; err != nil {
+		return folderError(c, fc.logger, err)
+	}
+	if !canModifyFolder(c, &folder) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You are not allowed to restore this folder",
+		})
+	}
+
+	now := time.Now()
+	err = fc.db.Transaction(func(tx *gorm.DB) error {
+		if folder.ParentID != nil {
+			live, err := folderExists(tx, *folder.ParentID)
+			if err != nil {
+				return err
+			}
+			if !live {
+				folder.ParentID = nil
+			}
+		}
+
+		// The subtree is what was trashed in the same operation as the folder
+		subtree := `WITH RECURSIVE root AS (
+				SELECT id, deleted_at FROM "authentication-app"."folders" WHERE id = ?
+			), subtree AS (
+				SELECT id FROM root
+				UNION
+				SELECT f.id FROM "authentication-app"."folders" f JOIN subtree s ON f.parent_id = s.id JOIN root r ON f.deleted_at = r.deleted_at
+			) `
+		allowed, err := allFilesAccessible(c, tx, fileAccessWrite, subtree+`SELECT 1 FROM "authentication-app"."file_uploads"
+			WHERE folder_id IN (SELECT id FROM subtree) AND deleted_at = (SELECT deleted_at FROM root)`, folder.ID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fiber.NewError(fiber.StatusForbidden, "You do not have write access to every file in this folder")
+		}
+
+		if err := tx.Exec(subtree+`UPDATE "authentication-app"."file_uploads" SET deleted_at = NULL, updated_at = ?
+			WHERE folder_id IN (SELECT id FROM subtree) AND deleted_at = (SELECT deleted_at FROM root)`, folder.ID, now).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(subtree+`UPDATE "authentication-app"."folders" SET deleted_at = NULL, updated_at = ?
+			WHERE id IN (SELECT id FROM subtree) AND id <> ?`, folder.ID, now, folder.ID).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&folder).Updates(map[string]interface{}{
+			"parent_id":  folder.ParentID,
+			"deleted_at": nil,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		if isDuplicateKey(err) {
+			err = errFolderNameTaken
+		}
+		return folderError(c, fc.logger, err)
+	}
+	folder.DeletedAt = gorm.DeletedAt{}
+	folder.UpdatedAt = &now
+
+	return c.JSON(toFolderResponse(folder))
+}
+
+// @Summary List trashed folders
+// @Description List the trashed folders of the active tenant, most recently deleted first
+// @Tags Folder
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} dto.FolderListResponse
+// @Security BearerAuth
+// @Router /folders/trash [get]
+func (fc *FolderController) ListTrash(c *fiber.Ctx) error {
+	page, pageSize := pagination(c)
+	query := fc.db.Unscoped().Model(&models.Folder{}).Scopes(tenantFolders(c)).Where("deleted_at IS NOT NULL")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return folderError(c, fc.logger, err)
+	}
+
+	var folders []models.Folder
+	if err := query.Order("deleted_at DESC, id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&folders).Error; err != nil {
+		return folderError(c, fc.logger, err)
+	}
+
+	resp := dto.FolderListResponse{
+		Folders:  make([]dto.FolderResponse, 0, len(folders)),
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}
+	for _, folder := range folders {
+		resp.Folders = append(resp.Folders, toFolderResponse(folder))
+	}
+	return c.JSON(resp)
+}
+
+// modifiableFolder loads the folder named by the :id parameter and checks the caller may change it
+func (fc *FolderController) modifiableFolder(c *fiber.Ctx) (*models.Folder, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	folder, err := findTenantFolder(c, fc.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canModifyFolder(c, folder) {
+		return nil, fiber.NewError(fiber.StatusForbidden, "You are not allowed to change this folder")
+	}
+	return folder, nil
+}
+
+// tenantFolders scopes folder queries to the caller's active tenant, see models.FoldersInTenant
+func tenantFolders(c *fiber.Ctx) func(db *gorm.DB) *gorm.DB {
+	userID := c.Locals("user_id").(uuid.UUID)
+	orgID, _ := c.Locals("org_id").(uuid.UUID)
+	return models.FoldersInTenant(userID, orgID)
+}
+
+// findTenantFolder loads a folder of the active tenant that is not in the trash
+func findTenantFolder(c *fiber.Ctx, db *gorm.DB, id uuid.UUID) (*models.Folder, error) {
+	var folder models.Folder
+	if err := db.Scopes(tenantFolders(c)).Where("id = ?", id).First(&folder).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// folderExists reports whether a folder exists outside the trash, whatever its tenant
+func folderExists(db *gorm.DB, id uuid.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&models.Folder{}).Where("id = ?", id).Count(&count).Error
+	return count > 0, err
+}
+
+// folderPath returns the path from the top level down to a folder, the folder itself included
+func folderPath(db *gorm.DB, id uuid.UUID) ([]dto.FolderPathEntry, error) {
+	var path []dto.FolderPathEntry
+	err := db.Raw(`WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id, name, 0 AS depth FROM "authentication-app"."folders" WHERE id = ?
+			UNION ALL
+			SELECT f.id, f.parent_id, f.name, a.depth + 1 FROM "authentication-app"."folders" f JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT id, name FROM ancestors ORDER BY depth DESC`, id).Scan(&path).Error
+	return path, err
+}
+
+// canModifyFolder allows the folder's creator, and in an organization also its owners and admins
+func canModifyFolder(c *fiber.Ctx, folder *models.Folder) bool {
+	if folder.UserID == c.Locals("user_id").(uuid.UUID) {
+		return true
+	}
+	orgRole, _ := c.Locals("org_role").(string)
+	return folder.OrganizationID != nil && models.OrgRoleRank(orgRole) >= models.OrgRoleRank(models.OrgRoleAdmin)
+}
+
+// tenantKey identifies the tenant a folder belongs to: its organization, or its owner
+func tenantKey(folder *models.Folder) uuid.UUID {
+	if folder.OrganizationID != nil {
+		return *folder.OrganizationID
+	}
+	return folder.UserID
+}
+
+// folderName trims a folder name and checks it can be shown as a path segment
+func folderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "", errors.New("Folder name is required")
+	case utf8.RuneCountInString(name) > maxFolderNameLength:
+		return "", errors.New("Folder name must be at most 255 characters")
+	case name == "." || name == ".." || strings.ContainsAny(name, "/\\"):
+		return "", errors.New("Folder name must not be . or .. or contain slashes")
+	}
+	return name, nil
+}
+
+func toFolderResponse(folder models.Folder) dto.FolderResponse {
+	resp := dto.FolderResponse{
+		ID:             folder.ID,
+		UserID:         folder.UserID,
+		OrganizationID: folder.OrganizationID,
+		ParentID:       folder.ParentID,
+		Name:           folder.Name,
+		CreatedAt:      folder.CreatedAt,
+		UpdatedAt:      folder.UpdatedAt,
+	}
+	if folder.DeletedAt.Valid {
+		resp.DeletedAt = &folder.DeletedAt.Time
+	}
+	return resp
+}
+
+// folderError answers 404 for folders outside the caller's tenant so their existence is not revealed
+func folderError(c *fiber.Ctx, logger golog.Logger, err error) error {
+	var fiberErr *fiber.Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Folder not found",
+		})
+	case errors.Is(err, errFolderNameTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A folder with this name already exists here",
+		})
+	case errors.Is(err, errFolderCycle):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A folder cannot be moved into itself or one of its subfolders",
+		})
+	case errors.As(err, &fiberErr):
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"error": fiberErr.Message,
+		})
+	}
+	logger.Errorf("Database error: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
+
+// isDuplicateKey reports whether err is a unique constraint violation
+func isDuplicateKey(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "duplicate key")
+}
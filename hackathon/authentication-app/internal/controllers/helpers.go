@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pagination reads the page and page_size query parameters, clamped to sane bounds
+func pagination(c *fiber.Ctx) (page int, pageSize int) {
+	page = c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	pageSize = c.QueryInt("page_size", defaultPageSize)
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	return page, pageSize
+}
+
+// tenantFiles scopes file queries to the caller's active tenant, see models.FilesInTenant
+func tenantFiles(c *fiber.Ctx) func(db *gorm.DB) *gorm.DB {
+	userID := c.Locals("user_id").(uuid.UUID)
+	orgID, _ := c.Locals("org_id").(uuid.UUID)
+	return models.FilesInTenant(userID, orgID)
+}
+
+func toFileResponse(file models.FileUpload) dto.FileResponse {
+	resp := dto.FileResponse{
+		ID:             file.ID,
+		UserID:         file.UserID,
+		OrganizationID: file.OrganizationID,
+		FolderID:       file.FolderID,
+		Filename:       file.Filename,
+		OriginalName:   file.OriginalName,
+		ContentType:    file.ContentType,
+		Size:           file.Size,
+		Width:          file.Width,
+		Height:         file.Height,
+		SHA256:         file.SHA256,
+		Version:        file.Version,
+		ScanStatus:     file.ScanStatus,
+		ScanSignature:  file.ScanSignature,
+		Tags:           file.Tags,
+		Metadata:       file.Metadata,
+		CreatedAt:      file.CreatedAt,
+		UpdatedAt:      file.UpdatedAt,
+	}
+	if resp.Tags == nil {
+		resp.Tags = []string{}
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]interface{}{}
+	}
+	if file.DeletedAt.Valid {
+		resp.DeletedAt = &file.DeletedAt.Time
+	}
+	for _, variant := range file.Variants {
+		resp.Variants = append(resp.Variants, dto.FileVariantResponse{
+			Name:        variant.Name,
+			ContentType: variant.ContentType,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			Size:        variant.Size,
+		})
+	}
+	return resp
+}
+
+// fileError answers 404 for files the caller cannot see so their existence is not revealed, and
+// 403 for files they may see but not change
+func fileError(c *fiber.Ctx, logger golog.Logger, err error) error {
+	var fiberErr *fiber.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "File not found",
+		})
+	}
+	if errors.As(err, &fiberErr) {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"error": fiberErr.Message,
+		})
+	}
+	logger.Errorf("Database error: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
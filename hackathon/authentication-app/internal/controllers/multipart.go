@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// Text fields sent before the file part are held in memory, so their number and size are bounded
+	maxFormFields    = 16
+	maxFormFieldSize = 4 * 1024
+	// maxFormTrailer is how much of the body left after the file is read to keep the connection
+	// open, as much as net/http reads of an unread request body
+	maxFormTrailer = 256 * 1024
+)
+
+var errNoFilePart = errors.New("no file part in the form")
+
+// multipartUpload is a multipart/form-data upload read while it arrives: the text fields sent
+// before the file part, and the file part itself, positioned at its first byte
+type multipartUpload struct {
+	fields map[string]string
+	file   *multipart.Part
+	body   io.Reader
+}
+
+// readMultipartUpload parses a multipart/form-data body up to the part of the named file field.
+// Nothing of the file has been read when it returns, so it can be streamed on without being held
+// in memory or spooled to disk. Fields sent after the file are not seen: clients must send them
+// first, as browsers do when they follow the order of the form.
+func readMultipartUpload(c *fiber.Ctx, name string) (*multipartUpload, error) {
+	boundary := string(c.Request().Header.MultipartFormBoundary())
+	if boundary == "" {
+		return nil, errNoFilePart
+	}
+	var body io.Reader = c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	form := &multipartUpload{fields: make(map[string]string), body: body}
+	reader := multipart.NewReader(body, boundary)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, errNoFilePart
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == name && part.FileName() != "" {
+			form.file = part
+			return form, nil
+		}
+		if part.FileName() != "" || len(form.fields) == maxFormFields {
+			return nil, fmt.Errorf("unexpected part %q before the file", part.FormName())
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(value) > maxFormFieldSize {
+			return nil, fmt.Errorf("form field %q is too long", part.FormName())
+		}
+		form.fields[part.FormName()] = string(value)
+	}
+}
+
+// finish reads what is left of the body after the file, normally just the closing boundary, so
+// the connection can carry the next request. A body abandoned in the middle of the file, as when
+// the upload is refused, is not read to its end; the connection is closed after the response.
+func (form *multipartUpload) finish(c *fiber.Ctx) {
+	if n, _ := io.Copy(io.Discard, io.LimitReader(form.body, maxFormTrailer+1)); n > maxFormTrailer {
+		c.Context().SetConnectionClose()
+	}
+}
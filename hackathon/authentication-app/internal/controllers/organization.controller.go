@@ -0,0 +1,837 @@
+package controllers
+
+import (
+	"authentication-app/config"
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errForbidden = errors.New("forbidden")
+	errLastOwner = errors.New("organization must keep at least one owner")
+)
+
+type OrganizationController struct {
+	cfg    *config.Config
+	logger golog.Logger
+	db     *gorm.DB
+}
+
+func NewOrganizationController(cfg *config.Config, logger golog.Logger, db *gorm.DB) *OrganizationController {
+	return &OrganizationController{
+		cfg:    cfg,
+		logger: logger,
+		db:     db,
+	}
+}
+
+// @Summary Create organization
+// @Description Create an organization owned by the current user
+// @Tags Organization
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateOrganizationRequest true "Organization details"
+// @Success 201 {object} dto.OrganizationResponse
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs [post]
+func (oc *OrganizationController) CreateOrganization(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var req dto.CreateOrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Organization name is required and must be at most 255 characters",
+		})
+	}
+
+	now := time.Now()
+	org := models.Organization{
+		ID:        uuid.New(),
+		Name:      req.Name,
+		CreatedBy: &userID,
+		CreatedAt: now,
+	}
+	membership := models.OrganizationMembership{
+		ID:             uuid.New(),
+		OrganizationID: org.ID,
+		UserID:         userID,
+		Role:           models.OrgRoleOwner,
+		CreatedAt:      now,
+	}
+
+	err := oc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&membership).Error
+	})
+	if err != nil {
+		oc.logger.Errorf("Failed to create organization: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create organization",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dto.OrganizationResponse{
+		ID:        org.ID,
+		Name:      org.Name,
+		Role:      membership.Role,
+		CreatedAt: org.CreatedAt,
+	})
+}
+
+// @Summary List my organizations
+// @Description List the organizations the current user belongs to, with their role in each
+// @Tags Organization
+// @Produce json
+// @Success 200 {array} dto.OrganizationResponse
+// @Security BearerAuth
+// @Router /orgs [get]
+func (oc *OrganizationController) ListOrganizations(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var memberships []models.OrganizationMembership
+	if err := oc.db.Preload("Organization").Where("user_id = ?", userID).Order("created_at").Find(&memberships).Error; err != nil {
+		oc.logger.Errorf("Failed to list organizations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	orgs := make([]dto.OrganizationResponse, 0, len(memberships))
+	for _, membership := range memberships {
+		orgs = append(orgs, dto.OrganizationResponse{
+			ID:        membership.Organization.ID,
+			Name:      membership.Organization.Name,
+			Role:      membership.Role,
+			CreatedAt: membership.Organization.CreatedAt,
+		})
+	}
+
+	return c.JSON(orgs)
+}
+
+// @Summary Get organization
+// @Description Get an organization the current user belongs to
+// @Tags Organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {object} dto.OrganizationResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/{id} [get]
+func (oc *OrganizationController) GetOrganization(c *fiber.Ctx) error {
+	membership, err := oc.callerMembership(c)
+	if err != nil {
+		return oc.membershipError(c, err)
+	}
+
+	return c.JSON(dto.OrganizationResponse{
+		ID:        membership.Organization.ID,
+		Name:      membership.Organization.Name,
+		Role:      membership.Role,
+		CreatedAt: membership.Organization.CreatedAt,
+	})
+}
+
+// @Summary List members
+// @Description List the members of an organization
+// @Tags Organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {array} dto.OrganizationMemberResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/{id}/members [get]
+func (oc *OrganizationController) ListMembers(c *fiber.Ctx) error {
+	membership, err := oc.callerMembership(c)
+	if err != nil {
+		return oc.membershipError(c, err)
+	}
+
+	var memberships []models.OrganizationMembership
+	if err := oc.db.Preload("User").Where("organization_id = ?", membership.OrganizationID).Order("created_at").Find(&memberships).Error; err != nil {
+		oc.logger.Errorf("Failed to list members: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	members := make([]dto.OrganizationMemberResponse, 0, len(memberships))
+	for _, m := range memberships {
+		members = append(members, dto.OrganizationMemberResponse{
+			UserID:   m.UserID,
+			Username: m.User.Username,
+			Role:     m.Role,
+			JoinedAt: m.CreatedAt,
+		})
+	}
+
+	return c.JSON(members)
+}
+
+// @Summary Update member role
+// @Description Change a member's role. Admins manage members; only owners manage owners and admins.
+// @Tags Organization
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param userId path string true "User ID"
+// @Param request body dto.UpdateMemberRequest true "New role"
+// @Success 200 {object} dto.OrganizationMemberResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/{id}/members/{userId} [patch]
+func (oc *OrganizationController) UpdateMember(c *fiber.Ctx) error {
+	caller, err := oc.callerMembership(c)
+	if err != nil {
+		return oc.membershipError(c, err)
+	}
+
+	var req dto.UpdateMemberRequest
+	if err := c.BodyParser(&req); err != nil || models.OrgRoleRank(req.Role) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be one of owner, admin, member",
+		})
+	}
+
+	targetID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var target models.OrganizationMembership
+	err = oc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("User").
+			Where("organization_id = ? AND user_id = ?", caller.OrganizationID, targetID).
+			First(&target).Error; err != nil {
+			return err
+		}
+
+		if !canManageMember(caller.Role, target.Role, req.Role) {
+			return errForbidden
+		}
+
+		if target.Role == models.OrgRoleOwner && req.Role != models.OrgRoleOwner {
+			if err := ensureAnotherOwner(tx, caller.OrganizationID, target.UserID); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		target.Role = req.Role
+		target.UpdatedAt = &now
+		return tx.Model(&target).Updates(map[string]interface{}{
+			"role":       req.Role,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return oc.memberChangeError(c, err)
+	}
+
+	return c.JSON(dto.OrganizationMemberResponse{
+		UserID:   target.UserID,
+		Username: target.User.Username,
+		Role:     target.Role,
+		JoinedAt: target.CreatedAt,
+	})
+}
+
+// @Summary Remove member
+// @Description Remove a member from an organization, or leave it by passing your own user ID
+// @Tags Organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/{id}/members/{userId} [delete]
+func (oc *OrganizationController) RemoveMember(c *fiber.Ctx) error {
+	caller, err := oc.callerMembership(c)
+	if err != nil {
+		return oc.membershipError(c, err)
+	}
+
+	targetID, err := uuid.Parse(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	err = oc.db.Transaction(func(tx *gorm.DB) error {
+		var target models.OrganizationMembership
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("organization_id = ? AND user_id = ?", caller.OrganizationID, targetID).
+			First(&target).Error; err != nil {
+			return err
+		}
+
+		leaving := target.UserID == caller.UserID
+		if !leaving && !canManageMember(caller.Role, target.Role, models.OrgRoleMember) {
+			return errForbidden
+		}
+
+		if target.Role == models.OrgRoleOwner {
+			if err := ensureAnotherOwner(tx, caller.OrganizationID, target.UserID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&target).Error
+	})
+	if err != nil {
+		return oc.memberChangeError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Member removed successfully",
+	})
+}
+
+// @Summary Invite member
+// @Description Invite an existing user to the organization by username
+// @Tags Organization
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param request body dto.InviteMemberRequest true "Invitation details"
+// @Success 201 {object} dto.InvitationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/{id}/invitations [post]
+func (oc *OrganizationController) InviteMember(c *fiber.Ctx) error {
+	caller, err := oc.callerMembership(c)
+	if err != nil {
+		return oc.membershipError(c, err)
+	}
+
+	var req dto.InviteMemberRequest
+	if err := c.BodyParser(&req); err != nil || req.Username == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Username is required",
+		})
+	}
+	if req.Role == "" {
+		req.Role = models.OrgRoleMember
+	}
+	if models.OrgRoleRank(req.Role) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role must be one of owner, admin, member",
+		})
+	}
+
+	// Members cannot invite, and nobody can hand out a role above their own
+	if models.OrgRoleRank(caller.Role) < models.OrgRoleRank(models.OrgRoleAdmin) ||
+		models.OrgRoleRank(req.Role) > models.OrgRoleRank(caller.Role) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You are not allowed to invite with this role",
+		})
+	}
+
+	var invitee models.User
+	if err := oc.db.Where("username = ?", req.Username).First(&invitee).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		oc.logger.Errorf("Database error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var existing int64
+	if err := oc.db.Model(&models.OrganizationMembership{}).
+		Where("organization_id = ? AND user_id = ?", caller.OrganizationID, invitee.ID).
+		Count(&existing).Error; err != nil {
+		oc.logger.Errorf("Database error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if existing > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User is already a member",
+		})
+	}
+
+	invitation := models.OrganizationInvitation{
+		ID:             uuid.New(),
+		OrganizationID: caller.OrganizationID,
+		UserID:         invitee.ID,
+		InvitedBy:      &caller.UserID,
+		Role:           req.Role,
+		Status:         models.InvitationStatusPending,
+		CreatedAt:      time.Now(),
+	}
+	if err := oc.db.Create(&invitation).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "User already has a pending invitation",
+			})
+		}
+		oc.logger.Errorf("Failed to create invitation: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invitation",
+		})
+	}
+
+	invitation.Organization = caller.Organization
+	invitation.User = invitee
+
+	return c.Status(fiber.StatusCreated).JSON(toInvitationResponse(invitation))
+}
+
+// @Summary List organization invitations
+// @Description List the pending invitations of an organization
+// @Tags Organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {array} dto.InvitationResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/{id}/invitations [get]
+func (oc *OrganizationController) ListOrganizationInvitations(c *fiber.Ctx) error {
+	caller, err := oc.callerMembership(c)
+	if err != nil {
+		return oc.membershipError(c, err)
+	}
+
+	if models.OrgRoleRank(caller.Role) < models.OrgRoleRank(models.OrgRoleAdmin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only owners and admins can view invitations",
+		})
+	}
+
+	var invitations []models.OrganizationInvitation
+	if err := oc.db.Preload("Organization").Preload("User").
+		Where("organization_id = ? AND status = ?", caller.OrganizationID, models.InvitationStatusPending).
+		Order("created_at").
+		Find(&invitations).Error; err != nil {
+		oc.logger.Errorf("Failed to list invitations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(toInvitationResponses(invitations))
+}
+
+// @Summary Cancel invitation
+// @Description Cancel a pending invitation
+// @Tags Organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param invitationId path string true "Invitation ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/{id}/invitations/{invitationId} [delete]
+func (oc *OrganizationController) CancelInvitation(c *fiber.Ctx) error {
+	caller, err := oc.callerMembership(c)
+	if err != nil {
+		return oc.membershipError(c, err)
+	}
+
+	if models.OrgRoleRank(caller.Role) < models.OrgRoleRank(models.OrgRoleAdmin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only owners and admins can cancel invitations",
+		})
+	}
+
+	invitationID, err := uuid.Parse(c.Params("invitationId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invitation ID",
+		})
+	}
+
+	result := oc.db.Model(&models.OrganizationInvitation{}).
+		Where("id = ? AND organization_id = ? AND status = ?", invitationID, caller.OrganizationID, models.InvitationStatusPending).
+		Updates(map[string]interface{}{
+			"status":       models.InvitationStatusCancelled,
+			"responded_at": time.Now(),
+		})
+	if result.Error != nil {
+		oc.logger.Errorf("Failed to cancel invitation: %v", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel invitation",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invitation not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation cancelled successfully",
+	})
+}
+
+// @Summary List my invitations
+// @Description List the pending invitations addressed to the current user
+// @Tags Organization
+// @Produce json
+// @Success 200 {array} dto.InvitationResponse
+// @Security BearerAuth
+// @Router /orgs/invitations [get]
+func (oc *OrganizationController) ListMyInvitations(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var invitations []models.OrganizationInvitation
+	if err := oc.db.Preload("Organization").Preload("User").
+		Where("user_id = ? AND status = ?", userID, models.InvitationStatusPending).
+		Order("created_at").
+		Find(&invitations).Error; err != nil {
+		oc.logger.Errorf("Failed to list invitations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(toInvitationResponses(invitations))
+}
+
+// @Summary Accept invitation
+// @Description Accept a pending invitation and join the organization
+// @Tags Organization
+// @Produce json
+// @Param invitationId path string true "Invitation ID"
+// @Success 200 {object} dto.OrganizationResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/invitations/{invitationId}/accept [post]
+func (oc *OrganizationController) AcceptInvitation(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	invitationID, err := uuid.Parse(c.Params("invitationId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invitation ID",
+		})
+	}
+
+	var invitation models.OrganizationInvitation
+	err = oc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ? AND status = ?", invitationID, userID, models.InvitationStatusPending).
+			First(&invitation).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		membership := models.OrganizationMembership{
+			ID:             uuid.New(),
+			OrganizationID: invitation.OrganizationID,
+			UserID:         userID,
+			Role:           invitation.Role,
+			CreatedAt:      now,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&membership).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&invitation).Updates(map[string]interface{}{
+			"status":       models.InvitationStatusAccepted,
+			"responded_at": now,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Invitation not found",
+			})
+		}
+		oc.logger.Errorf("Failed to accept invitation: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to accept invitation",
+		})
+	}
+
+	var org models.Organization
+	if err := oc.db.Where("id = ?", invitation.OrganizationID).First(&org).Error; err != nil {
+		oc.logger.Errorf("Database error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(dto.OrganizationResponse{
+		ID:        org.ID,
+		Name:      org.Name,
+		Role:      invitation.Role,
+		CreatedAt: org.CreatedAt,
+	})
+}
+
+// @Summary Decline invitation
+// @Description Decline a pending invitation
+// @Tags Organization
+// @Produce json
+// @Param invitationId path string true "Invitation ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/invitations/{invitationId}/decline [post]
+func (oc *OrganizationController) DeclineInvitation(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	invitationID, err := uuid.Parse(c.Params("invitationId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid invitation ID",
+		})
+	}
+
+	result := oc.db.Model(&models.OrganizationInvitation{}).
+		Where("id = ? AND user_id = ? AND status = ?", invitationID, userID, models.InvitationStatusPending).
+		Updates(map[string]interface{}{
+			"status":       models.InvitationStatusDeclined,
+			"responded_at": time.Now(),
+		})
+	if result.Error != nil {
+		oc.logger.Errorf("Failed to decline invitation: %v", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decline invitation",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invitation not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation declined",
+	})
+}
+
+// @Summary Switch active organization
+// @Description Issue a new token whose active organization is the given one, or the personal workspace when organization_id is null
+// @Tags Organization
+// @Accept json
+// @Produce json
+// @Param request body dto.SwitchOrganizationRequest true "Organization to activate"
+// @Success 200 {object} dto.AuthResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/active [post]
+func (oc *OrganizationController) SwitchOrganization(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var req dto.SwitchOrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	orgID := uuid.Nil
+	if req.OrganizationID != nil && *req.OrganizationID != uuid.Nil {
+		var count int64
+		if err := oc.db.Model(&models.OrganizationMembership{}).
+			Where("organization_id = ? AND user_id = ?", *req.OrganizationID, userID).
+			Count(&count).Error; err != nil {
+			oc.logger.Errorf("Database error: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		if count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Organization not found",
+			})
+		}
+		orgID = *req.OrganizationID
+	}
+
+	var user models.User
+	if err := oc.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		oc.logger.Errorf("Database error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return respondWithToken(c, oc.cfg, oc.logger, fiber.StatusOK, &user, orgID)
+}
+
+// @Summary List organization files
+// @Description List the files shared with an organization
+// @Tags Organization
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} dto.FileListResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orgs/{id}/files [get]
+func (oc *OrganizationController) ListOrganizationFiles(c *fiber.Ctx) error {
+	membership, err := oc.callerMembership(c)
+	if err != nil {
+		return oc.membershipError(c, err)
+	}
+
+	page, pageSize := pagination(c)
+	query := oc.db.Model(&models.FileUpload{}).Scopes(models.FilesInTenant(membership.UserID, membership.OrganizationID))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		oc.logger.Errorf("Failed to count organization files: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var files []models.FileUpload
+	if err := query.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&files).Error; err != nil {
+		oc.logger.Errorf("Failed to list organization files: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	resp := dto.FileListResponse{
+		Files:    make([]dto.FileResponse, 0, len(files)),
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}
+	for _, file := range files {
+		resp.Files = append(resp.Files, toFileResponse(file))
+	}
+
+	return c.JSON(resp)
+}
+
+// callerMembership loads the current user's membership in the organization named by the :id param
+func (oc *OrganizationController) callerMembership(c *fiber.Ctx) (*models.OrganizationMembership, error) {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	orgID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var membership models.OrganizationMembership
+	if err := oc.db.Preload("Organization").Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+// membershipError hides organizations the caller does not belong to behind a 404
+func (oc *OrganizationController) membershipError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Organization not found",
+		})
+	}
+	oc.logger.Errorf("Database error: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
+
+func (oc *OrganizationController) memberChangeError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Member not found",
+		})
+	case errors.Is(err, errForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You are not allowed to change this member",
+		})
+	case errors.Is(err, errLastOwner):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Organization must keep at least one owner",
+		})
+	}
+	oc.logger.Errorf("Failed to change membership: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
+
+// canManageMember reports whether a caller may move a member from one role to another. Owners can
+// do anything; admins can only manage plain members and cannot grant more than admin.
+func canManageMember(callerRole, targetRole, newRole string) bool {
+	if callerRole == models.OrgRoleOwner {
+		return true
+	}
+	if callerRole != models.OrgRoleAdmin {
+		return false
+	}
+	return targetRole == models.OrgRoleMember && models.OrgRoleRank(newRole) <= models.OrgRoleRank(models.OrgRoleAdmin)
+}
+
+func ensureAnotherOwner(tx *gorm.DB, orgID, exceptUserID uuid.UUID) error {
+	var owners int64
+	if err := tx.Model(&models.OrganizationMembership{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", orgID, models.OrgRoleOwner, exceptUserID).
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+func toInvitationResponse(invitation models.OrganizationInvitation) dto.InvitationResponse {
+	return dto.InvitationResponse{
+		ID:               invitation.ID,
+		OrganizationID:   invitation.OrganizationID,
+		OrganizationName: invitation.Organization.Name,
+		Username:         invitation.User.Username,
+		Role:             invitation.Role,
+		Status:           invitation.Status,
+		InvitedBy:        invitation.InvitedBy,
+		CreatedAt:        invitation.CreatedAt,
+	}
+}
+
+func toInvitationResponses(invitations []models.OrganizationInvitation) []dto.InvitationResponse {
+	resp := make([]dto.InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		resp = append(resp, toInvitationResponse(invitation))
+	}
+	return resp
+}
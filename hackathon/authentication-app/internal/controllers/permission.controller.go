@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PermissionController struct {
+	logger golog.Logger
+	db     *gorm.DB
+}
+
+func NewPermissionController(logger golog.Logger, db *gorm.DB) *PermissionController {
+	return &PermissionController{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// @Summary Grant file access
+// @Description Give another user read or write access to a file, by username. Granting again replaces the earlier permission. Read allows viewing and downloading; write also allows changing tags and metadata, trashing and restoring.
+// @Tags Permission
+// @Accept json
+// @Produce json
+// @Param id path string true "File ID"
+// @Param request body dto.GrantPermissionRequest true "Username and permission"
+// @Success 200 {object} dto.PermissionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/permissions [post]
+func (pc *PermissionController) GrantPermission(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, pc.db, fileAccessManage)
+	if err != nil {
+		return fileError(c, pc.logger, err)
+	}
+
+	var req dto.GrantPermissionRequest
+	if err := c.BodyParser(&req); err != nil || req.Username == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Username is required",
+		})
+	}
+	if req.Permission == "" {
+		req.Permission = models.FilePermissionRead
+	}
+	if models.FilePermissionRank(req.Permission) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Permission must be one of read, write",
+		})
+	}
+
+	var grantee models.User
+	if err := pc.db.Where("username = ? AND active = ?", req.Username, true).First(&grantee).Error; err != nil {
+		return pc.userError(c, err)
+	}
+	if grantee.ID == file.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The uploader already has full access to the file",
+		})
+	}
+
+	callerID := c.Locals("user_id").(uuid.UUID)
+	now := time.Now()
+	grant := models.FilePermission{
+		ID:         uuid.New(),
+		FileID:     file.ID,
+		UserID:     grantee.ID,
+		Permission: req.Permission,
+		GrantedBy:  &callerID,
+		CreatedAt:  now,
+	}
+	if err := pc.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "file_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"permission": req.Permission,
+			"granted_by": callerID,
+			"updated_at": now,
+		}),
+	}).Create(&grant).Error; err != nil {
+		pc.logger.Errorf("Failed to grant access to file %s: %v", file.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to grant access",
+		})
+	}
+
+	// On a regrant the stored row keeps its own ID and creation time
+	if err := pc.db.Where("file_id = ? AND user_id = ?", file.ID, grantee.ID).First(&grant).Error; err != nil {
+		return fileError(c, pc.logger, err)
+	}
+	grant.User = grantee
+
+	return c.JSON(toPermissionResponse(grant))
+}
+
+// @Summary List file access
+// @Description List the users a file has been shared with and their permissions
+// @Tags Permission
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {array} dto.PermissionResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/permissions [get]
+func (pc *PermissionController) ListPermissions(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, pc.db, fileAccessManage)
+	if err != nil {
+		return fileError(c, pc.logger, err)
+	}
+
+	var grants []models.FilePermission
+	if err := pc.db.Preload("User").Where("file_id = ?", file.ID).Order("created_at, id").Find(&grants).Error; err != nil {
+		pc.logger.Errorf("Failed to list permissions of file %s: %v", file.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	resp := make([]dto.PermissionResponse, 0, len(grants))
+	for _, grant := range grants {
+		resp = append(resp, toPermissionResponse(grant))
+	}
+	return c.JSON(resp)
+}
+
+// @Summary Revoke file access
+// @Description Take away a user's access to a file
+// @Tags Permission
+// @Produce json
+// @Param id path string true "File ID"
+// @Param username path string true "Username"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/permissions/{username} [delete]
+func (pc *PermissionController) RevokePermission(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, pc.db, fileAccessManage)
+	if err != nil {
+		return fileError(c, pc.logger, err)
+	}
+
+	var grantee models.User
+	if err := pc.db.Where("username = ?", c.Params("username")).First(&grantee).Error; err != nil {
+		return pc.userError(c, err)
+	}
+
+	result := pc.db.Where("file_id = ? AND user_id = ?", file.ID, grantee.ID).Delete(&models.FilePermission{})
+	if result.Error != nil {
+		pc.logger.Errorf("Failed to revoke access to file %s: %v", file.ID, result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke access",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Permission not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Access revoked successfully",
+	})
+}
+
+// @Summary List files shared with me
+// @Description List the files other users have granted me access to, most recently shared first, whichever tenant is active. Trashed files are left out.
+// @Tags Permission
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} dto.SharedFileListResponse
+// @Security BearerAuth
+// @Router /files/shared-with-me [get]
+func (pc *PermissionController) ListSharedWithMe(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+	page, pageSize := pagination(c)
+	query := pc.db.Model(&models.FilePermission{}).
+		Joins(`JOIN "authentication-app"."file_uploads" ON file_uploads.id = file_permissions.file_id AND file_uploads.deleted_at IS NULL`).
+		Where("file_permissions.user_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		pc.logger.Errorf("Failed to count shared files: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var grants []models.FilePermission
+	if err := query.Preload("File").
+		Order("file_permissions.created_at DESC, file_permissions.id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&grants).Error; err != nil {
+		pc.logger.Errorf("Failed to list shared files: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	resp := dto.SharedFileListResponse{
+		Files:    make([]dto.SharedFileResponse, 0, len(grants)),
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}
+	for _, grant := range grants {
+		resp.Files = append(resp.Files, dto.SharedFileResponse{
+			FileResponse: toFileResponse(grant.File),
+			Permission:   grant.Permission,
+			GrantedBy:    grant.GrantedBy,
+			SharedAt:     grant.CreatedAt,
+		})
+	}
+	return c.JSON(resp)
+}
+
+func (pc *PermissionController) userError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	pc.logger.Errorf("Database error: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
+
+func toPermissionResponse(grant models.FilePermission) dto.PermissionResponse {
+	return dto.PermissionResponse{
+		ID:         grant.ID,
+		FileID:     grant.FileID,
+		UserID:     grant.UserID,
+		Username:   grant.User.Username,
+		Permission: grant.Permission,
+		GrantedBy:  grant.GrantedBy,
+		CreatedAt:  grant.CreatedAt,
+		UpdatedAt:  grant.UpdatedAt,
+	}
+}
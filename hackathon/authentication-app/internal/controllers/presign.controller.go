@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"authentication-app/config"
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/middleware"
+	"authentication-app/internal/models"
+	"authentication-app/pkg/presign"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+type PresignController struct {
+	logger        golog.Logger
+	db            *gorm.DB
+	signer        *presign.Signer
+	defaultExpiry time.Duration
+	maxExpiry     time.Duration
+}
+
+func NewPresignController(cfg *config.Config, logger golog.Logger, db *gorm.DB, signer *presign.Signer) *PresignController {
+	return &PresignController{
+		logger:        logger,
+		db:            db,
+		signer:        signer,
+		defaultExpiry: time.Duration(cfg.PresignDefaultExpiryMinutes) * time.Minute,
+		maxExpiry:     time.Duration(cfg.PresignMaxExpiryMinutes) * time.Minute,
+	}
+}
+
+// @Summary Presign download
+// @Description Get a signed URL that downloads the file, or one of its variants, without an Authorization header until it expires
+// @Tags File
+// @Accept json
+// @Produce json
+// @Param id path string true "File ID"
+// @Param request body dto.PresignRequest false "Expiry in seconds and optional variant"
+// @Success 200 {object} dto.PresignResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/presign [post]
+func (pc *PresignController) PresignDownload(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, pc.db, fileAccessRead)
+	if err != nil {
+		return fileError(c, pc.logger, err)
+	}
+
+	req, expiry, err := pc.parseRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	params := middleware.PresignParams(c)
+	if req.Variant != "" {
+		var variant models.FileVariant
+		if err := pc.db.Where("file_id = ? AND name = ?", file.ID, req.Variant).First(&variant).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Variant not found",
+				})
+			}
+			pc.logger.Errorf("Failed to load variant %s of file %s: %v", req.Variant, file.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		params.Set("variant", variant.Name)
+	}
+
+	return c.JSON(pc.sign(c, fiber.MethodGet, fmt.Sprintf("/files/%s/content", file.ID), params, expiry))
+}
+
+// @Summary Presign upload
+// @Description Get a signed URL that uploads a file as me without an Authorization header until it expires, e.g. for a trusted backend pushing a file on my behalf. The upload policy and quota still apply.
+// @Tags File
+// @Accept json
+// @Produce json
+// @Param request body dto.PresignRequest false "Expiry in seconds"
+// @Success 200 {object} dto.PresignResponse
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/upload/presign [post]
+func (pc *PresignController) PresignUpload(c *fiber.Ctx) error {
+	_, expiry, err := pc.parseRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	resp := pc.sign(c, fiber.MethodPost, "/files/upload", middleware.PresignParams(c), expiry)
+	resp.FormField = "file"
+	return c.JSON(resp)
+}
+
+// parseRequest reads the optional body and bounds the requested expiry
+func (pc *PresignController) parseRequest(c *fiber.Ctx) (dto.PresignRequest, time.Duration, error) {
+	var req dto.PresignRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return req, 0, errors.New("Invalid request body")
+		}
+	}
+
+	expiry := time.Duration(req.ExpiresIn) * time.Second
+	if req.ExpiresIn == 0 {
+		expiry = pc.defaultExpiry
+	}
+	if expiry <= 0 || expiry > pc.maxExpiry {
+		return req, 0, fmt.Errorf("expires_in must be between 1 and %d seconds", int(pc.maxExpiry.Seconds()))
+	}
+	return req, expiry, nil
+}
+
+func (pc *PresignController) sign(c *fiber.Ctx, method, path string, params url.Values, expiry time.Duration) dto.PresignResponse {
+	expiresAt := time.Now().Add(expiry).Truncate(time.Second)
+	query := pc.signer.Sign(method, path, params, expiresAt)
+	return dto.PresignResponse{
+		Method:    method,
+		URL:       c.BaseURL() + path + "?" + query.Encode(),
+		ExpiresAt: expiresAt,
+	}
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxRanges bounds the parts of a multipart/byteranges response; requests for more are answered
+// with the whole content, which RFC 9110 allows
+const maxRanges = 16
+
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// byteRange is a part of a download, length bytes from start
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// contentRange formats the Content-Range header of a part
+func (r byteRange) contentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.start, 10) + "-" + strconv.FormatInt(r.start+r.length-1, 10) + "/" + strconv.FormatInt(size, 10)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when there is none, per RFC 9110
+func notModified(c *fiber.Ctx, content storedContent) bool {
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		return etagMatches(match, content.etag)
+	}
+	if since := c.Get(fiber.HeaderIfModifiedSince); since != "" {
+		t, err := http.ParseTime(since)
+		return err == nil && !content.modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// requestedRanges returns the ranges of a GET that should get a 206, or none when the whole
+// content is to be sent: without a Range header, with one that cannot be parsed or asks for too
+// many parts, and when If-Range names another version of the content
+func requestedRanges(c *fiber.Ctx, content storedContent) ([]byteRange, error) {
+	header := c.Get(fiber.HeaderRange)
+	if header == "" || c.Method() != fiber.MethodGet || !ifRangeMatches(c, content) {
+		return nil, nil
+	}
+	return parseRange(header, content.size)
+}
+
+// ifRangeMatches compares If-Range with the content: an entity tag must match strongly, a date
+// must be the exact modification time
+func ifRangeMatches(c *fiber.Ctx, content storedContent) bool {
+	value := strings.TrimSpace(c.Get(fiber.HeaderIfRange))
+	if value == "" {
+		return true
+	}
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "W/") {
+		return value == content.etag
+	}
+	t, err := http.ParseTime(value)
+	return err == nil && t.Equal(content.modified.Truncate(time.Second))
+}
+
+// parseRange reads a bytes Range header against content of size bytes. Headers it cannot parse
+// yield no ranges, so the whole content is sent; errUnsatisfiableRange means every range lies
+// beyond the end.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	unit, set, ok := strings.Cut(header, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, nil
+	}
+	specs := strings.Split(set, ",")
+	if len(specs) > maxRanges {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	for _, spec := range specs {
+		first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+		if !ok {
+			return nil, nil
+		}
+
+		if first == "" {
+			// A suffix range: the last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			ranges = append(ranges, byteRange{start: size - n, length: n})
+			continue
+		}
+
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, nil
+		}
+		end := size - 1
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return nil, nil
+			}
+			end = min(end, size-1)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, byteRange{start: start, length: end - start + 1})
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseRange(t *testing.T) {
+	tooMany := "bytes=" + strings.Repeat("0-0,", maxRanges) + "0-0"
+	atLimit := "bytes=" + strings.TrimSuffix(strings.Repeat("0-0,", maxRanges), ",")
+
+	tests := []struct {
+		name    string
+		header  string
+		size    int64
+		want    []byteRange
+		wantErr error
+	}{
+		{name: "closed", header: "bytes=0-99", size: 1000, want: []byteRange{{start: 0, length: 100}}},
+		{name: "closed past the end", header: "bytes=900-1999", size: 1000, want: []byteRange{{start: 900, length: 100}}},
+		{name: "single byte", header: "bytes=5-5", size: 1000, want: []byteRange{{start: 5, length: 1}}},
+		{name: "open", header: "bytes=400-", size: 1000, want: []byteRange{{start: 400, length: 600}}},
+		{name: "open from the last byte", header: "bytes=999-", size: 1000, want: []byteRange{{start: 999, length: 1}}},
+		{name: "suffix", header: "bytes=-100", size: 1000, want: []byteRange{{start: 900, length: 100}}},
+		{name: "suffix longer than the content", header: "bytes=-5000", size: 1000, want: []byteRange{{start: 0, length: 1000}}},
+		{
+			name:   "several with spaces",
+			header: "bytes=0-9, 20-29 ,-5",
+			size:   1000,
+			want:   []byteRange{{start: 0, length: 10}, {start: 20, length: 10}, {start: 995, length: 5}},
+		},
+		{name: "unit in another case", header: "Bytes=0-9", size: 1000, want: []byteRange{{start: 0, length: 10}}},
+		{name: "unsatisfiable ranges skipped", header: "bytes=2000-2999,0-9", size: 1000, want: []byteRange{{start: 0, length: 10}}},
+		{name: "as many ranges as allowed", header: atLimit, size: 1000, want: repeatRange(byteRange{start: 0, length: 1}, maxRanges)},
+		{name: "more ranges than allowed", header: tooMany, size: 1000},
+		{name: "start beyond the end", header: "bytes=1000-", size: 1000, wantErr: errUnsatisfiableRange},
+		{name: "all beyond the end", header: "bytes=1000-1999,5000-", size: 1000, wantErr: errUnsatisfiableRange},
+		{name: "empty suffix", header: "bytes=-0", size: 1000, wantErr: errUnsatisfiableRange},
+		{name: "suffix of empty content", header: "bytes=-10", size: 0, wantErr: errUnsatisfiableRange},
+		{name: "open on empty content", header: "bytes=0-", size: 0, wantErr: errUnsatisfiableRange},
+		{name: "other unit", header: "items=0-9", size: 1000},
+		{name: "no unit", header: "0-9", size: 1000},
+		{name: "no dash", header: "bytes=10", size: 1000},
+		{name: "end before start", header: "bytes=20-10", size: 1000},
+		{name: "negative start", header: "bytes=--10", size: 1000},
+		{name: "not a number", header: "bytes=a-b", size: 1000},
+		{name: "one malformed spec spoils the set", header: "bytes=0-9,x-", size: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRange(tt.header, tt.size)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseRange(%q, %d) error = %v, want %v", tt.header, tt.size, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRange(%q, %d) = %v, want %v", tt.header, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func repeatRange(r byteRange, n int) []byteRange {
+	ranges := make([]byteRange, n)
+	for i := range ranges {
+		ranges[i] = r
+	}
+	return ranges
+}
+
+func TestByteRangeContentRange(t *testing.T) {
+	if got := (byteRange{start: 900, length: 100}).contentRange(1000); got != "bytes 900-999/1000" {
+		t.Errorf("contentRange = %q, want %q", got, "bytes 900-999/1000")
+	}
+}
+
+func TestRequestedRanges(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 30, 45, 500_000_000, time.UTC)
+	content := storedContent{size: 1000, etag: `"abc"`, modified: modified}
+	lastModified := modified.Format(http.TimeFormat)
+	firstRange := []byteRange{{start: 0, length: 100}}
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    []byteRange
+		wantErr error
+	}{
+		{name: "no range", headers: map[string]string{}},
+		{name: "range", headers: map[string]string{"Range": "bytes=0-99"}, want: firstRange},
+		{name: "range on a HEAD", method: fiber.MethodHead, headers: map[string]string{"Range": "bytes=0-99"}},
+		{name: "unsatisfiable", headers: map[string]string{"Range": "bytes=5000-"}, wantErr: errUnsatisfiableRange},
+		{name: "If-Range with the etag", headers: map[string]string{"Range": "bytes=0-99", "If-Range": `"abc"`}, want: firstRange},
+		{name: "If-Range with another etag", headers: map[string]string{"Range": "bytes=0-99", "If-Range": `"def"`}},
+		{name: "If-Range with a weak etag", headers: map[string]string{"Range": "bytes=0-99", "If-Range": `W/"abc"`}},
+		{name: "If-Range with the modification time", headers: map[string]string{"Range": "bytes=0-99", "If-Range": lastModified}, want: firstRange},
+		{
+			name:    "If-Range with an earlier time",
+			headers: map[string]string{"Range": "bytes=0-99", "If-Range": modified.Add(-time.Minute).Format(http.TimeFormat)},
+		},
+		{
+			name:    "If-Range with a later time",
+			headers: map[string]string{"Range": "bytes=0-99", "If-Range": modified.Add(time.Minute).Format(http.TimeFormat)},
+		},
+		{name: "If-Range that is neither", headers: map[string]string{"Range": "bytes=0-99", "If-Range": "yesterday"}},
+		{name: "If-Range unsatisfiable", headers: map[string]string{"Range": "bytes=5000-", "If-Range": `"abc"`}, wantErr: errUnsatisfiableRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byteRange
+			var err error
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				got, err = requestedRanges(c, content)
+				return nil
+			})
+
+			method := tt.method
+			if method == "" {
+				method = fiber.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if _, testErr := app.Test(req); testErr != nil {
+				t.Fatal(testErr)
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("requestedRanges error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requestedRanges = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 30, 45, 500_000_000, time.UTC)
+	content := storedContent{etag: `"abc"`, modified: modified}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "no conditions", headers: map[string]string{}},
+		{name: "matching etag", headers: map[string]string{"If-None-Match": `"abc"`}, want: true},
+		{name: "weak etag", headers: map[string]string{"If-None-Match": `W/"abc"`}, want: true},
+		{name: "etag in a list", headers: map[string]string{"If-None-Match": `"x", "abc"`}, want: true},
+		{name: "any", headers: map[string]string{"If-None-Match": "*"}, want: true},
+		{name: "other etag", headers: map[string]string{"If-None-Match": `"def"`}},
+		{name: "same second", headers: map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, want: true},
+		{name: "later", headers: map[string]string{"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)}, want: true},
+		{name: "earlier", headers: map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}},
+		{name: "invalid date", headers: map[string]string{"If-Modified-Since": "yesterday"}},
+		{
+			name:    "etag wins over date",
+			headers: map[string]string{"If-None-Match": `"def"`, "If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bool
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				got = notModified(c, content)
+				return nil
+			})
+
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("notModified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
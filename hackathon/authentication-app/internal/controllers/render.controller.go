@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"authentication-app/internal/models"
+	"authentication-app/internal/render"
+	"authentication-app/pkg/imaging"
+	"authentication-app/pkg/storage"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+type RenderController struct {
+	logger   golog.Logger
+	db       *gorm.DB
+	renderer *render.Renderer
+}
+
+func NewRenderController(logger golog.Logger, db *gorm.DB, renderer *render.Renderer) *RenderController {
+	return &RenderController{
+		logger:   logger,
+		db:       db,
+		renderer: renderer,
+	}
+}
+
+// @Summary Render an image
+// @Description Resize, crop and convert an image file on request. Widths and heights must be among the configured sizes; with only one of them the other follows the aspect ratio. fit=contain (the default) fits the image within the box without enlarging it, cover fills the box and crops the overflow from the centre, fill stretches the image to the box. The format defaults to that of the original, with GIF rendered as PNG, and q sets the JPEG quality from the configured list. Renders are cached on disk and carry a strong ETag, so If-None-Match gets 304.
+// @Tags File
+// @Produce image/jpeg,image/png,image/webp
+// @Param id path string true "File ID"
+// @Param w query int false "Width in pixels"
+// @Param h query int false "Height in pixels"
+// @Param fit query string false "contain, cover or fill"
+// @Param format query string false "jpeg, png or webp"
+// @Param q query int false "JPEG quality"
+// @Success 200 {file} file
+// @Success 304
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/render [get]
+func (rc *RenderController) RenderFile(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, rc.db, fileAccessRead)
+	if err != nil {
+		return fileError(c, rc.logger, err)
+	}
+	if file.ScanStatus == models.ScanStatusInfected {
+		return quarantinedError(c)
+	}
+	if !imaging.Supports(file.ContentType) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Only images can be rendered",
+		})
+	}
+
+	opts, err := rc.renderer.ParseOptions(c.Query("w"), c.Query("h"), c.Query("fit"), c.Query("format"), c.Query("q"), file.ContentType)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// A render is fully determined by the content and the options, so the cache key is a strong ETag
+	etag := `"` + rc.renderer.Key(file, opts) + `"`
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" && etagMatches(match, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	body, size, err := rc.renderer.Render(c.UserContext(), file, opts)
+	if err != nil {
+		return rc.renderError(c, file, err)
+	}
+
+	base := strings.TrimSuffix(file.OriginalName, filepath.Ext(file.OriginalName))
+	c.Set(fiber.HeaderContentType, opts.ContentType())
+	c.Set(fiber.HeaderContentDisposition, contentDisposition("inline", base+"_"+renderSize(opts)+imaging.Extension(opts.Format)))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.SendStream(body, int(size))
+}
+
+// renderSize names the requested box in a render's filename, leaving out a side that follows the
+// aspect ratio: 512x384, 512w or 384h
+func renderSize(opts render.Options) string {
+	switch {
+	case opts.Height == 0:
+		return fmt.Sprintf("%dw", opts.Width)
+	case opts.Width == 0:
+		return fmt.Sprintf("%dh", opts.Height)
+	default:
+		return fmt.Sprintf("%dx%d", opts.Width, opts.Height)
+	}
+}
+
+func (rc *RenderController) renderError(c *fiber.Ctx, file *models.FileUpload, err error) error {
+	switch {
+	case errors.Is(err, imaging.ErrTooLarge):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "Image is too large to be rendered",
+		})
+	case errors.Is(err, render.ErrUndecodable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "Image cannot be decoded",
+		})
+	case errors.Is(err, storage.ErrNotFound):
+		rc.logger.Warnf("Content %s of file %s is missing from %s", file.StorageKey, file.ID, file.StorageBackend)
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "File content not found",
+		})
+	default:
+		rc.logger.Errorf("Failed to render file %s: %v", file.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to render image",
+		})
+	}
+}
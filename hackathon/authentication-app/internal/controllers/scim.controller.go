@@ -0,0 +1,1075 @@
+package controllers
+
+import (
+	"authentication-app/config"
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	scimContentType    = "application/scim+json"
+	scimDefaultCount   = 100
+	scimMaxCount       = 500
+	scimTypeFilter     = "invalidFilter"
+	scimTypeValue      = "invalidValue"
+	scimTypeSyntax     = "invalidSyntax"
+	scimTypeUniqueness = "uniqueness"
+)
+
+// scimFilterPattern matches the only filter form we support: <attribute> eq "<value>"
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// scimMemberFilterPattern matches member removal paths such as members[value eq "<id>"]
+var scimMemberFilterPattern = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]+)"\s*\]$`)
+
+// scimError carries a SCIM error response out of a transaction
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimError) Error() string {
+	return e.detail
+}
+
+type SCIMController struct {
+	cfg    *config.Config
+	logger golog.Logger
+	db     *gorm.DB
+}
+
+func NewSCIMController(cfg *config.Config, logger golog.Logger, db *gorm.DB) *SCIMController {
+	return &SCIMController{
+		cfg:    cfg,
+		logger: logger,
+		db:     db,
+	}
+}
+
+// @Summary List SCIM users
+// @Description List users, optionally filtered with userName eq "..." or externalId eq "..."
+// @Tags SCIM
+// @Produce json
+// @Param filter query string false "SCIM filter"
+// @Param startIndex query int false "1-based index of the first result" default(1)
+// @Param count query int false "Page size" default(100)
+// @Success 200 {object} dto.SCIMListResponse
+// @Failure 400 {object} dto.SCIMError
+// @Failure 401 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Users [get]
+func (sc *SCIMController) ListUsers(c *fiber.Ctx) error {
+	query := sc.db.Model(&models.User{})
+
+	if filter := c.Query("filter"); filter != "" {
+		column, value, err := parseSCIMFilter(filter, map[string]string{
+			"username":   "LOWER(username) = LOWER(?)",
+			"externalid": "external_id = ?",
+		})
+		if err != nil {
+			return sendSCIMError(c, fiber.StatusBadRequest, scimTypeFilter, err.Error())
+		}
+		query = query.Where(column, value)
+	}
+
+	startIndex, count := scimPaging(c)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return sc.internalError(c, "Failed to count users", err)
+	}
+
+	var users []models.User
+	if err := query.Order("created_at, id").Offset(startIndex - 1).Limit(count).Find(&users).Error; err != nil {
+		return sc.internalError(c, "Failed to list users", err)
+	}
+
+	groups, err := sc.groupsOfUsers(users)
+	if err != nil {
+		return sc.internalError(c, "Failed to load user groups", err)
+	}
+
+	resources := make([]dto.SCIMUser, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, toSCIMUser(c, user, groups[user.ID]))
+	}
+
+	return sendSCIM(c, fiber.StatusOK, dto.SCIMListResponse{
+		Schemas:      []string{dto.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// @Summary Get SCIM user
+// @Description Get a user by ID
+// @Tags SCIM
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.SCIMUser
+// @Failure 404 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Users/{id} [get]
+func (sc *SCIMController) GetUser(c *fiber.Ctx) error {
+	user, err := sc.loadUser(sc.db, c.Params("id"))
+	if err != nil {
+		return sc.userError(c, err)
+	}
+
+	return sc.sendUser(c, fiber.StatusOK, user)
+}
+
+// @Summary Create SCIM user
+// @Description Provision a user
+// @Tags SCIM
+// @Accept json
+// @Produce json
+// @Param request body dto.SCIMUser true "SCIM user"
+// @Success 201 {object} dto.SCIMUser
+// @Failure 400 {object} dto.SCIMError
+// @Failure 409 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Users [post]
+func (sc *SCIMController) CreateUser(c *fiber.Ctx) error {
+	var req dto.SCIMUser
+	if err := c.BodyParser(&req); err != nil {
+		return sendSCIMError(c, fiber.StatusBadRequest, scimTypeSyntax, "Invalid request body")
+	}
+
+	user := &models.User{
+		ID:         uuid.New(),
+		AuthSource: models.AuthSourceLocal,
+		Role:       models.RoleUser,
+		Active:     true,
+		CreatedAt:  time.Now(),
+	}
+	if err := applySCIMUser(user, req); err != nil {
+		return sc.userError(c, err)
+	}
+
+	if err := sc.db.Create(user).Error; err != nil {
+		return sc.userError(c, err)
+	}
+
+	return sc.sendUser(c, fiber.StatusCreated, user)
+}
+
+// @Summary Replace SCIM user
+// @Description Replace a user's attributes. Setting active to false deprovisions the user.
+// @Tags SCIM
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body dto.SCIMUser true "SCIM user"
+// @Success 200 {object} dto.SCIMUser
+// @Failure 400 {object} dto.SCIMError
+// @Failure 404 {object} dto.SCIMError
+// @Failure 409 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Users/{id} [put]
+func (sc *SCIMController) ReplaceUser(c *fiber.Ctx) error {
+	var req dto.SCIMUser
+	if err := c.BodyParser(&req); err != nil {
+		return sendSCIMError(c, fiber.StatusBadRequest, scimTypeSyntax, "Invalid request body")
+	}
+
+	var user *models.User
+	err := sc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = sc.loadUser(tx.Clauses(clause.Locking{Strength: "UPDATE"}), c.Params("id"))
+		if err != nil {
+			return err
+		}
+
+		wasActive := user.Active
+		// PUT replaces the attributes we store; anything left out is cleared
+		user.ExternalID = nil
+		user.DisplayName = ""
+		user.Email = ""
+		if err := applySCIMUser(user, req); err != nil {
+			return err
+		}
+
+		return saveSCIMUser(tx, user, wasActive)
+	})
+	if err != nil {
+		return sc.userError(c, err)
+	}
+
+	return sc.sendUser(c, fiber.StatusOK, user)
+}
+
+// @Summary Patch SCIM user
+// @Description Apply SCIM PatchOp operations to a user. Replacing active with false deprovisions the user.
+// @Tags SCIM
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body dto.SCIMPatchRequest true "SCIM patch"
+// @Success 200 {object} dto.SCIMUser
+// @Failure 400 {object} dto.SCIMError
+// @Failure 404 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Users/{id} [patch]
+func (sc *SCIMController) PatchUser(c *fiber.Ctx) error {
+	var req dto.SCIMPatchRequest
+	if err := c.BodyParser(&req); err != nil || len(req.Operations) == 0 {
+		return sendSCIMError(c, fiber.StatusBadRequest, scimTypeSyntax, "Invalid patch request")
+	}
+
+	var user *models.User
+	err := sc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = sc.loadUser(tx.Clauses(clause.Locking{Strength: "UPDATE"}), c.Params("id"))
+		if err != nil {
+			return err
+		}
+
+		wasActive := user.Active
+		for _, op := range req.Operations {
+			if err := patchSCIMUser(user, op); err != nil {
+				return err
+			}
+		}
+
+		return saveSCIMUser(tx, user, wasActive)
+	})
+	if err != nil {
+		return sc.userError(c, err)
+	}
+
+	return sc.sendUser(c, fiber.StatusOK, user)
+}
+
+// @Summary Deprovision SCIM user
+// @Description Disable the user and revoke all of their sessions. The account and its files are kept.
+// @Tags SCIM
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 404 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Users/{id} [delete]
+func (sc *SCIMController) DeleteUser(c *fiber.Ctx) error {
+	err := sc.db.Transaction(func(tx *gorm.DB) error {
+		user, err := sc.loadUser(tx.Clauses(clause.Locking{Strength: "UPDATE"}), c.Params("id"))
+		if err != nil {
+			return err
+		}
+
+		wasActive := user.Active
+		user.Active = false
+		return saveSCIMUser(tx, user, wasActive)
+	})
+	if err != nil {
+		return sc.userError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary List SCIM groups
+// @Description List groups, optionally filtered with displayName eq "..." or externalId eq "..."
+// @Tags SCIM
+// @Produce json
+// @Param filter query string false "SCIM filter"
+// @Param startIndex query int false "1-based index of the first result" default(1)
+// @Param count query int false "Page size" default(100)
+// @Param excludedAttributes query string false "Set to members to leave out group members"
+// @Success 200 {object} dto.SCIMListResponse
+// @Failure 400 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Groups [get]
+func (sc *SCIMController) ListGroups(c *fiber.Ctx) error {
+	query := sc.db.Model(&models.Group{})
+
+	if filter := c.Query("filter"); filter != "" {
+		column, value, err := parseSCIMFilter(filter, map[string]string{
+			"displayname": "LOWER(display_name) = LOWER(?)",
+			"externalid":  "external_id = ?",
+		})
+		if err != nil {
+			return sendSCIMError(c, fiber.StatusBadRequest, scimTypeFilter, err.Error())
+		}
+		query = query.Where(column, value)
+	}
+
+	startIndex, count := scimPaging(c)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return sc.internalError(c, "Failed to count groups", err)
+	}
+
+	var groups []models.Group
+	if err := query.Order("created_at, id").Offset(startIndex - 1).Limit(count).Find(&groups).Error; err != nil {
+		return sc.internalError(c, "Failed to list groups", err)
+	}
+
+	withMembers := !strings.Contains(strings.ToLower(c.Query("excludedAttributes")), "members")
+	resources := make([]dto.SCIMGroup, 0, len(groups))
+	for _, group := range groups {
+		var members []models.GroupMember
+		if withMembers {
+			if err := sc.db.Preload("User").Where("group_id = ?", group.ID).Find(&members).Error; err != nil {
+				return sc.internalError(c, "Failed to load group members", err)
+			}
+		}
+		resources = append(resources, toSCIMGroup(c, group, members))
+	}
+
+	return sendSCIM(c, fiber.StatusOK, dto.SCIMListResponse{
+		Schemas:      []string{dto.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// @Summary Get SCIM group
+// @Description Get a group by ID
+// @Tags SCIM
+// @Produce json
+// @Param id path string true "Group ID"
+// @Success 200 {object} dto.SCIMGroup
+// @Failure 404 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Groups/{id} [get]
+func (sc *SCIMController) GetGroup(c *fiber.Ctx) error {
+	group, err := sc.loadGroup(sc.db, c.Params("id"))
+	if err != nil {
+		return sc.groupError(c, err)
+	}
+
+	return sc.sendGroup(c, fiber.StatusOK, group)
+}
+
+// @Summary Create SCIM group
+// @Description Provision a group with its members
+// @Tags SCIM
+// @Accept json
+// @Produce json
+// @Param request body dto.SCIMGroup true "SCIM group"
+// @Success 201 {object} dto.SCIMGroup
+// @Failure 400 {object} dto.SCIMError
+// @Failure 409 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Groups [post]
+func (sc *SCIMController) CreateGroup(c *fiber.Ctx) error {
+	var req dto.SCIMGroup
+	if err := c.BodyParser(&req); err != nil {
+		return sendSCIMError(c, fiber.StatusBadRequest, scimTypeSyntax, "Invalid request body")
+	}
+
+	group := &models.Group{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+	}
+	err := sc.db.Transaction(func(tx *gorm.DB) error {
+		if err := applySCIMGroup(group, req.DisplayName, req.ExternalID); err != nil {
+			return err
+		}
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+		return addGroupMembers(tx, group.ID, req.Members)
+	})
+	if err != nil {
+		return sc.groupError(c, err)
+	}
+
+	return sc.sendGroup(c, fiber.StatusCreated, group)
+}
+
+// @Summary Replace SCIM group
+// @Description Replace a group's name and full member list
+// @Tags SCIM
+// @Accept json
+// @Produce json
+// @Param id path string true "Group ID"
+// @Param request body dto.SCIMGroup true "SCIM group"
+// @Success 200 {object} dto.SCIMGroup
+// @Failure 400 {object} dto.SCIMError
+// @Failure 404 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Groups/{id} [put]
+func (sc *SCIMController) ReplaceGroup(c *fiber.Ctx) error {
+	var req dto.SCIMGroup
+	if err := c.BodyParser(&req); err != nil {
+		return sendSCIMError(c, fiber.StatusBadRequest, scimTypeSyntax, "Invalid request body")
+	}
+
+	var group *models.Group
+	err := sc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		group, err = sc.loadGroup(tx.Clauses(clause.Locking{Strength: "UPDATE"}), c.Params("id"))
+		if err != nil {
+			return err
+		}
+
+		if err := applySCIMGroup(group, req.DisplayName, req.ExternalID); err != nil {
+			return err
+		}
+		if err := saveSCIMGroup(tx, group); err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		return addGroupMembers(tx, group.ID, req.Members)
+	})
+	if err != nil {
+		return sc.groupError(c, err)
+	}
+
+	return sc.sendGroup(c, fiber.StatusOK, group)
+}
+
+// @Summary Patch SCIM group
+// @Description Apply SCIM PatchOp operations to a group, such as adding or removing members
+// @Tags SCIM
+// @Accept json
+// @Produce json
+// @Param id path string true "Group ID"
+// @Param request body dto.SCIMPatchRequest true "SCIM patch"
+// @Success 200 {object} dto.SCIMGroup
+// @Failure 400 {object} dto.SCIMError
+// @Failure 404 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Groups/{id} [patch]
+func (sc *SCIMController) PatchGroup(c *fiber.Ctx) error {
+	var req dto.SCIMPatchRequest
+	if err := c.BodyParser(&req); err != nil || len(req.Operations) == 0 {
+		return sendSCIMError(c, fiber.StatusBadRequest, scimTypeSyntax, "Invalid patch request")
+	}
+
+	var group *models.Group
+	err := sc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		group, err = sc.loadGroup(tx.Clauses(clause.Locking{Strength: "UPDATE"}), c.Params("id"))
+		if err != nil {
+			return err
+		}
+
+		for _, op := range req.Operations {
+			if err := patchSCIMGroup(tx, group, op); err != nil {
+				return err
+			}
+		}
+
+		return saveSCIMGroup(tx, group)
+	})
+	if err != nil {
+		return sc.groupError(c, err)
+	}
+
+	return sc.sendGroup(c, fiber.StatusOK, group)
+}
+
+// @Summary Delete SCIM group
+// @Description Delete a group. Its members are not affected.
+// @Tags SCIM
+// @Param id path string true "Group ID"
+// @Success 204
+// @Failure 404 {object} dto.SCIMError
+// @Security BearerAuth
+// @Router /scim/v2/Groups/{id} [delete]
+func (sc *SCIMController) DeleteGroup(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return sc.groupError(c, gorm.ErrRecordNotFound)
+	}
+
+	result := sc.db.Where("id = ?", id).Delete(&models.Group{})
+	if result.Error != nil {
+		return sc.internalError(c, "Failed to delete group", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return sc.groupError(c, gorm.ErrRecordNotFound)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (sc *SCIMController) loadUser(db *gorm.DB, idParam string) (*models.User, error) {
+	id, err := uuid.Parse(idParam)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var user models.User
+	if err := db.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (sc *SCIMController) loadGroup(db *gorm.DB, idParam string) (*models.Group, error) {
+	id, err := uuid.Parse(idParam)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var group models.Group
+	if err := db.Where("id = ?", id).First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// groupsOfUsers loads the group memberships of a page of users in one query
+func (sc *SCIMController) groupsOfUsers(users []models.User) (map[uuid.UUID][]models.Group, error) {
+	groups := make(map[uuid.UUID][]models.Group, len(users))
+	if len(users) == 0 {
+		return groups, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+
+	var memberships []models.GroupMember
+	if err := sc.db.Preload("Group").Where("user_id IN ?", ids).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	for _, membership := range memberships {
+		groups[membership.UserID] = append(groups[membership.UserID], membership.Group)
+	}
+	return groups, nil
+}
+
+func (sc *SCIMController) sendUser(c *fiber.Ctx, status int, user *models.User) error {
+	groups, err := sc.groupsOfUsers([]models.User{*user})
+	if err != nil {
+		return sc.internalError(c, "Failed to load user groups", err)
+	}
+
+	return sendSCIM(c, status, toSCIMUser(c, *user, groups[user.ID]))
+}
+
+func (sc *SCIMController) sendGroup(c *fiber.Ctx, status int, group *models.Group) error {
+	var members []models.GroupMember
+	if err := sc.db.Preload("User").Where("group_id = ?", group.ID).Find(&members).Error; err != nil {
+		return sc.internalError(c, "Failed to load group members", err)
+	}
+
+	return sendSCIM(c, status, toSCIMGroup(c, *group, members))
+}
+
+func (sc *SCIMController) userError(c *fiber.Ctx, err error) error {
+	return sc.resourceError(c, err, "User")
+}
+
+func (sc *SCIMController) groupError(c *fiber.Ctx, err error) error {
+	return sc.resourceError(c, err, "Group")
+}
+
+func (sc *SCIMController) resourceError(c *fiber.Ctx, err error, resource string) error {
+	var se *scimError
+	switch {
+	case errors.As(err, &se):
+		return sendSCIMError(c, se.status, se.scimType, se.detail)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return sendSCIMError(c, fiber.StatusNotFound, "", resource+" not found")
+	case strings.Contains(err.Error(), "duplicate key"):
+		return sendSCIMError(c, fiber.StatusConflict, scimTypeUniqueness, resource+" already exists")
+	}
+	return sc.internalError(c, "SCIM request failed", err)
+}
+
+func (sc *SCIMController) internalError(c *fiber.Ctx, message string, err error) error {
+	sc.logger.Errorf("%s: %v", message, err)
+	return sendSCIMError(c, fiber.StatusInternalServerError, "", "Internal server error")
+}
+
+// saveSCIMUser persists a provisioned user. Turning active off also revokes every token issued so far.
+func saveSCIMUser(tx *gorm.DB, user *models.User, wasActive bool) error {
+	now := time.Now()
+	if wasActive && !user.Active {
+		user.TokensValidAfter = &now
+	}
+	user.UpdatedAt = &now
+
+	return tx.Model(user).Select("username", "password_hash", "active", "external_id", "display_name", "email", "tokens_valid_after", "updated_at").Updates(user).Error
+}
+
+func saveSCIMGroup(tx *gorm.DB, group *models.Group) error {
+	now := time.Now()
+	group.UpdatedAt = &now
+
+	return tx.Model(group).Select("display_name", "external_id", "updated_at").Updates(group).Error
+}
+
+// applySCIMUser copies the attributes of a SCIM user resource onto a user
+func applySCIMUser(user *models.User, req dto.SCIMUser) error {
+	userName := strings.TrimSpace(req.UserName)
+	if userName == "" {
+		return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "userName is required"}
+	}
+	user.Username = userName
+
+	if req.ExternalID != "" {
+		externalID := req.ExternalID
+		user.ExternalID = &externalID
+	}
+
+	user.DisplayName = req.DisplayName
+	if user.DisplayName == "" && req.Name != nil {
+		user.DisplayName = req.Name.Formatted
+	}
+
+	if len(req.Emails) > 0 {
+		user.Email = primarySCIMEmail(req.Emails)
+	}
+
+	if req.Active != nil {
+		user.Active = *req.Active
+	}
+
+	if req.Password != "" {
+		return setSCIMPassword(user, req.Password)
+	}
+	return nil
+}
+
+// patchSCIMUser applies one PatchOp operation. Attributes we do not store are accepted and ignored
+// so identity providers that send their full schema keep working.
+func patchSCIMUser(user *models.User, op dto.SCIMPatchOperation) error {
+	action := strings.ToLower(op.Op)
+	if action != "add" && action != "replace" && action != "remove" {
+		return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeSyntax, detail: "Unsupported patch operation: " + op.Op}
+	}
+
+	// Without a path the value is an object of attribute/value pairs
+	if op.Path == "" {
+		if action == "remove" {
+			return &scimError{status: fiber.StatusBadRequest, scimType: "noTarget", detail: "remove requires a path"}
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "Patch value must be an object when no path is given"}
+		}
+		for attribute, value := range values {
+			if err := setSCIMUserAttribute(user, action, attribute, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return setSCIMUserAttribute(user, action, op.Path, op.Value)
+}
+
+func setSCIMUserAttribute(user *models.User, action, attribute string, value json.RawMessage) error {
+	attribute = strings.ToLower(attribute)
+	remove := action == "remove"
+
+	switch {
+	case attribute == "active":
+		if remove {
+			return &scimError{status: fiber.StatusBadRequest, scimType: "mutability", detail: "active cannot be removed"}
+		}
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = active
+
+	case attribute == "username":
+		if remove {
+			return &scimError{status: fiber.StatusBadRequest, scimType: "mutability", detail: "userName cannot be removed"}
+		}
+		userName, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(userName) == "" {
+			return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "userName is required"}
+		}
+		user.Username = strings.TrimSpace(userName)
+
+	case attribute == "externalid":
+		if remove {
+			user.ExternalID = nil
+			return nil
+		}
+		externalID, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		user.ExternalID = &externalID
+
+	case attribute == "displayname", attribute == "name.formatted":
+		if remove {
+			user.DisplayName = ""
+			return nil
+		}
+		displayName, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		user.DisplayName = displayName
+
+	case attribute == "name":
+		if remove {
+			user.DisplayName = ""
+			return nil
+		}
+		var name dto.SCIMName
+		if err := json.Unmarshal(value, &name); err != nil {
+			return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "name must be an object"}
+		}
+		if name.Formatted != "" {
+			user.DisplayName = name.Formatted
+		}
+
+	case strings.HasPrefix(attribute, "emails"):
+		if remove {
+			user.Email = ""
+			return nil
+		}
+		var emails []dto.SCIMEmail
+		if err := json.Unmarshal(value, &emails); err == nil {
+			user.Email = primarySCIMEmail(emails)
+			return nil
+		}
+		// Paths such as emails[type eq "work"].value carry a bare string
+		email, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		user.Email = email
+
+	case attribute == "password":
+		if remove {
+			user.PasswordHash = ""
+			return nil
+		}
+		password, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		return setSCIMPassword(user, password)
+	}
+
+	return nil
+}
+
+// applySCIMGroup validates and copies the group attributes we store
+func applySCIMGroup(group *models.Group, displayName, externalID string) error {
+	displayName = strings.TrimSpace(displayName)
+	if displayName == "" {
+		return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "displayName is required"}
+	}
+	group.DisplayName = displayName
+
+	group.ExternalID = nil
+	if externalID != "" {
+		group.ExternalID = &externalID
+	}
+	return nil
+}
+
+func patchSCIMGroup(tx *gorm.DB, group *models.Group, op dto.SCIMPatchOperation) error {
+	action := strings.ToLower(op.Op)
+	path := strings.ToLower(strings.TrimSpace(op.Path))
+
+	// Without a path the value is an object of attribute/value pairs
+	if path == "" && action != "remove" {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "Patch value must be an object when no path is given"}
+		}
+		for attribute, value := range values {
+			if err := patchSCIMGroup(tx, group, dto.SCIMPatchOperation{Op: op.Op, Path: attribute, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch {
+	case path == "displayname" && action != "remove":
+		displayName, err := scimString(op.Value)
+		if err != nil {
+			return err
+		}
+		return applySCIMGroup(group, displayName, derefString(group.ExternalID))
+
+	case path == "externalid":
+		if action == "remove" {
+			group.ExternalID = nil
+			return nil
+		}
+		externalID, err := scimString(op.Value)
+		if err != nil {
+			return err
+		}
+		group.ExternalID = &externalID
+		return nil
+
+	case path == "members":
+		var members []dto.SCIMMemberRef
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "members must be a list of references"}
+			}
+		}
+
+		switch action {
+		case "add":
+			return addGroupMembers(tx, group.ID, members)
+		case "replace":
+			if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}).Error; err != nil {
+				return err
+			}
+			return addGroupMembers(tx, group.ID, members)
+		case "remove":
+			// Removing the members attribute without a value empties the group
+			if len(members) == 0 {
+				return tx.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}).Error
+			}
+			return removeGroupMembers(tx, group.ID, members)
+		}
+
+	case action == "remove" && scimMemberFilterPattern.MatchString(op.Path):
+		id := scimMemberFilterPattern.FindStringSubmatch(op.Path)[1]
+		return removeGroupMembers(tx, group.ID, []dto.SCIMMemberRef{{Value: id}})
+	}
+
+	return &scimError{status: fiber.StatusBadRequest, scimType: "invalidPath", detail: fmt.Sprintf("Unsupported %s on path %q", op.Op, op.Path)}
+}
+
+func addGroupMembers(tx *gorm.DB, groupID uuid.UUID, members []dto.SCIMMemberRef) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	userIDs, err := scimMemberIDs(members)
+	if err != nil {
+		return err
+	}
+
+	var found int64
+	if err := tx.Model(&models.User{}).Where("id IN ?", userIDs).Count(&found).Error; err != nil {
+		return err
+	}
+	if found != int64(len(userIDs)) {
+		return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "members reference unknown users"}
+	}
+
+	now := time.Now()
+	rows := make([]models.GroupMember, 0, len(userIDs))
+	for _, userID := range userIDs {
+		rows = append(rows, models.GroupMember{
+			GroupID:   groupID,
+			UserID:    userID,
+			CreatedAt: now,
+		})
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("User", "Group").Create(&rows).Error
+}
+
+func removeGroupMembers(tx *gorm.DB, groupID uuid.UUID, members []dto.SCIMMemberRef) error {
+	userIDs, err := scimMemberIDs(members)
+	if err != nil {
+		return err
+	}
+	return tx.Where("group_id = ? AND user_id IN ?", groupID, userIDs).Delete(&models.GroupMember{}).Error
+}
+
+// scimMemberIDs parses and de-duplicates the user IDs of member references
+func scimMemberIDs(members []dto.SCIMMemberRef) ([]uuid.UUID, error) {
+	seen := make(map[uuid.UUID]bool, len(members))
+	ids := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		id, err := uuid.Parse(member.Value)
+		if err != nil {
+			return nil, &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "Invalid member value: " + member.Value}
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func setSCIMPassword(user *models.User, password string) error {
+	if len(password) < 6 {
+		return &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "Password must be at least 6 characters"}
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hashedPassword)
+	return nil
+}
+
+func toSCIMUser(c *fiber.Ctx, user models.User, groups []models.Group) dto.SCIMUser {
+	active := user.Active
+	resp := dto.SCIMUser{
+		Schemas:     []string{dto.SCIMSchemaUser},
+		ID:          user.ID.String(),
+		ExternalID:  derefString(user.ExternalID),
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Meta: &dto.SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     c.BaseURL() + "/scim/v2/Users/" + user.ID.String(),
+		},
+	}
+	if user.DisplayName != "" {
+		resp.Name = &dto.SCIMName{Formatted: user.DisplayName}
+	}
+	if user.Email != "" {
+		resp.Emails = []dto.SCIMEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	for _, group := range groups {
+		resp.Groups = append(resp.Groups, dto.SCIMMemberRef{
+			Value:   group.ID.String(),
+			Display: group.DisplayName,
+			Ref:     c.BaseURL() + "/scim/v2/Groups/" + group.ID.String(),
+		})
+	}
+	return resp
+}
+
+func toSCIMGroup(c *fiber.Ctx, group models.Group, members []models.GroupMember) dto.SCIMGroup {
+	resp := dto.SCIMGroup{
+		Schemas:     []string{dto.SCIMSchemaGroup},
+		ID:          group.ID.String(),
+		ExternalID:  derefString(group.ExternalID),
+		DisplayName: group.DisplayName,
+		Members:     make([]dto.SCIMMemberRef, 0, len(members)),
+		Meta: &dto.SCIMMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     c.BaseURL() + "/scim/v2/Groups/" + group.ID.String(),
+		},
+	}
+	for _, member := range members {
+		resp.Members = append(resp.Members, dto.SCIMMemberRef{
+			Value:   member.UserID.String(),
+			Display: member.User.Username,
+			Ref:     c.BaseURL() + "/scim/v2/Users/" + member.UserID.String(),
+		})
+	}
+	return resp
+}
+
+func primarySCIMEmail(emails []dto.SCIMEmail) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+// parseSCIMFilter turns an `attribute eq "value"` filter into a where clause from the allowed set
+func parseSCIMFilter(filter string, allowed map[string]string) (string, string, error) {
+	match := scimFilterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", fmt.Errorf("unsupported filter, only 'attribute eq \"value\"' is supported")
+	}
+
+	column, ok := allowed[strings.ToLower(match[1])]
+	if !ok {
+		return "", "", fmt.Errorf("filtering on %s is not supported", match[1])
+	}
+
+	value, err := strconv.Unquote(`"` + match[2] + `"`)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid filter value")
+	}
+	return column, value, nil
+}
+
+// scimPaging reads the 1-based startIndex and count query parameters
+func scimPaging(c *fiber.Ctx) (int, int) {
+	startIndex := c.QueryInt("startIndex", 1)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	count := c.QueryInt("count", scimDefaultCount)
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count
+}
+
+// scimBool accepts JSON booleans as well as the "True"/"False" strings some identity providers send
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if parsed, err := strconv.ParseBool(strings.ToLower(s)); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "Expected a boolean value"}
+}
+
+func scimString(value json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return "", &scimError{status: fiber.StatusBadRequest, scimType: scimTypeValue, detail: "Expected a string value"}
+	}
+	return s, nil
+}
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func sendSCIM(c *fiber.Ctx, status int, body interface{}) error {
+	return c.Status(status).JSON(body, scimContentType)
+}
+
+func sendSCIMError(c *fiber.Ctx, status int, scimType, detail string) error {
+	return sendSCIM(c, status, dto.SCIMError{
+		Schemas:  []string{dto.SCIMSchemaError},
+		Status:   strconv.Itoa(status),
+		SCIMType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	searchSortRelevance = "relevance"
+	searchSortCreatedAt = "created_at"
+	searchSortSize      = "size"
+
+	// maxSearchTerms bounds the size of the text query built from q
+	maxSearchTerms = 16
+)
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+// searchCursor marks where a page of search results ended: the sort value and ID of its last file.
+// It also records the sort it was made for, so it cannot be replayed against another ordering.
+type searchCursor struct {
+	Sort  string    `json:"s"`
+	Order string    `json:"o"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// searchRow is a file with its text search rank
+type searchRow struct {
+	models.FileUpload
+	Rank float64 `gorm:"column:rank"`
+}
+
+type SearchController struct {
+	logger golog.Logger
+	db     *gorm.DB
+}
+
+func NewSearchController(logger golog.Logger, db *gorm.DB) *SearchController {
+	return &SearchController{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// @Summary Search files
+// @Description Search the files of the active tenant. q matches words of the original name and the tags, as prefixes; every word must match. Results can be filtered by content type, tags, metadata, size and upload date, and are paged with the next_cursor of the previous page.
+// @Tags File
+// @Produce json
+// @Param q query string false "Search words"
+// @Param content_type query string false "Content type filter, e.g. image/png or image/*"
+// @Param tags query string false "Comma-separated tags the files must all have"
+// @Param metadata query string false "JSON object the metadata must contain, e.g. {\"camera\":\"x100\"}"
+// @Param min_size query int false "Minimum size in bytes"
+// @Param max_size query int false "Maximum size in bytes"
+// @Param created_after query string false "Uploaded at or after, RFC 3339"
+// @Param created_before query string false "Uploaded before, RFC 3339"
+// @Param sort query string false "Sort field (relevance, created_at or size); relevance is the default when q is given, created_at otherwise"
+// @Param order query string false "Sort order (asc or desc); relevance is always descending" default(desc)
+// @Param page_size query int false "Page size" default(20)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Success 200 {object} dto.FileSearchResponse
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/search [get]
+func (sc *SearchController) SearchFiles(c *fiber.Ctx) error {
+	query := sc.db.Model(&models.FileUpload{}).Scopes(tenantFiles(c))
+
+	textQuery := searchTextQuery(c.Query("q"))
+	if textQuery != "" {
+		query = query.Where("file_uploads.search_vector @@ to_tsquery('simple', ?)", textQuery)
+	}
+
+	query, err := searchFilters(c, query)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	sort := c.Query("sort")
+	if sort == "" {
+		sort = searchSortCreatedAt
+		if textQuery != "" {
+			sort = searchSortRelevance
+		}
+	}
+	order := strings.ToLower(c.Query("order", "desc"))
+
+	var sortExpr clause.Expr
+	switch sort {
+	case searchSortRelevance:
+		if textQuery == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "sort=relevance needs q",
+			})
+		}
+		order = "desc"
+		sortExpr = gorm.Expr("ts_rank(file_uploads.search_vector, to_tsquery('simple', ?))::float8", textQuery)
+	case searchSortCreatedAt:
+		sortExpr = gorm.Expr("file_uploads.created_at")
+	case searchSortSize:
+		sortExpr = gorm.Expr("file_uploads.size")
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "sort must be relevance, created_at or size",
+		})
+	}
+	if order != "asc" && order != "desc" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "order must be asc or desc",
+		})
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, value, err := decodeSearchCursor(raw, sort, order)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		// The ID breaks ties, so files sharing a sort value are neither skipped nor repeated
+		comparison := "<"
+		if order == "asc" {
+			comparison = ">"
+		}
+		query = query.Where(fmt.Sprintf("(?, file_uploads.id) %s (?, ?)", comparison), sortExpr, value, cursor.ID)
+	}
+
+	_, pageSize := pagination(c)
+	var rows []searchRow
+	selectRank := "0::float8 AS rank"
+	var selectVars []interface{}
+	if textQuery != "" {
+		selectRank = "ts_rank(file_uploads.search_vector, to_tsquery('simple', ?))::float8 AS rank"
+		selectVars = append(selectVars, textQuery)
+	}
+	if err := query.
+		Select("file_uploads.*, "+selectRank, selectVars...).
+		Order(clause.OrderBy{Expression: gorm.Expr(fmt.Sprintf("? %s, file_uploads.id %s", order, order), sortExpr)}).
+		Limit(pageSize + 1).
+		Find(&rows).Error; err != nil {
+		sc.logger.Errorf("Failed to search files: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	resp := dto.FileSearchResponse{
+		Files: make([]dto.FileResponse, 0, len(rows)),
+	}
+	if len(rows) > pageSize {
+		rows = rows[:pageSize]
+		resp.NextCursor = encodeSearchCursor(sort, order, rows[len(rows)-1])
+	}
+	for _, row := range rows {
+		resp.Files = append(resp.Files, toFileResponse(row.FileUpload))
+	}
+	return c.JSON(resp)
+}
+
+// searchFilters applies the content type, tag, metadata, size and date filters of a search
+func searchFilters(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	if contentType := c.Query("content_type"); contentType != "" {
+		if prefix, ok := strings.CutSuffix(contentType, "/*"); ok {
+			query = query.Where("file_uploads.content_type LIKE ?", prefix+"/%")
+		} else {
+			query = query.Where("file_uploads.content_type = ?", contentType)
+		}
+	}
+
+	if raw := c.Query("tags"); raw != "" {
+		tags, err := normalizeTags(strings.Split(raw, ","))
+		if err != nil {
+			return nil, err
+		}
+		encoded, _ := json.Marshal(tags)
+		query = query.Where("file_uploads.tags @> ?::jsonb", string(encoded))
+	}
+
+	if raw := c.Query("metadata"); raw != "" {
+		var metadata map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &metadata); err != nil || metadata == nil {
+			return nil, errors.New("metadata must be a JSON object")
+		}
+		query = query.Where("file_uploads.metadata @> ?::jsonb", raw)
+	}
+
+	for _, bound := range []struct {
+		param    string
+		operator string
+	}{{"min_size", ">="}, {"max_size", "<="}} {
+		if raw := c.Query(bound.param); raw != "" {
+			size, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative integer", bound.param)
+			}
+			query = query.Where("file_uploads.size "+bound.operator+" ?", size)
+		}
+	}
+
+	for _, bound := range []struct {
+		param    string
+		operator string
+	}{{"created_after", ">="}, {"created_before", "<"}} {
+		if raw := c.Query(bound.param); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", bound.param)
+			}
+			// Upload times are stored in UTC without a zone
+			query = query.Where("file_uploads.created_at "+bound.operator+" ?", t.UTC())
+		}
+	}
+
+	return query, nil
+}
+
+// searchTextQuery turns free text into a prefix match of every word, e.g. "beach 2024" into
+// "beach:* & 2024:*". Words are split like the indexed names are, on anything but letters and
+// digits, which also keeps tsquery operators out of the query.
+func searchTextQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+func encodeSearchCursor(sort string, order string, row searchRow) string {
+	cursor := searchCursor{Sort: sort, Order: order, ID: row.ID}
+	switch sort {
+	case searchSortRelevance:
+		cursor.Value = strconv.FormatFloat(row.Rank, 'g', -1, 64)
+	case searchSortCreatedAt:
+		cursor.Value = row.CreatedAt.Format(time.RFC3339Nano)
+	case searchSortSize:
+		cursor.Value = strconv.FormatInt(row.Size, 10)
+	}
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeSearchCursor reads a cursor made for the given sort and returns its typed sort value
+func decodeSearchCursor(raw string, sort string, order string) (searchCursor, interface{}, error) {
+	var cursor searchCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || json.Unmarshal(decoded, &cursor) != nil {
+		return cursor, nil, errInvalidCursor
+	}
+	if cursor.Sort != sort || cursor.Order != order {
+		return cursor, nil, errors.New("cursor belongs to a search with another sort or order")
+	}
+
+	var value interface{}
+	switch sort {
+	case searchSortRelevance:
+		value, err = strconv.ParseFloat(cursor.Value, 64)
+	case searchSortCreatedAt:
+		value, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	case searchSortSize:
+		value, err = strconv.ParseInt(cursor.Value, 10, 64)
+	}
+	if err != nil {
+		return cursor, nil, errInvalidCursor
+	}
+	return cursor, value, nil
+}
@@ -0,0 +1,443 @@
+package controllers
+
+import (
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"authentication-app/pkg/presign"
+	"authentication-app/pkg/storage"
+	"authentication-app/pkg/utils"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// sharePasswordHeader carries the password of a protected share for clients that do not use Basic auth
+	sharePasswordHeader = "X-Share-Password"
+
+	// shareGrantCookie lets a client that was counted a download fetch the share again, whole or in
+	// ranges, without counting another download or sending the password again
+	shareGrantCookie = "share_grant"
+	shareGrantTTL    = 6 * time.Hour
+
+	// Every sharePasswordAttempts wrong passwords in a row lock a share's password for
+	// sharePasswordLockout, during which no password is checked
+	sharePasswordAttempts = 5
+	sharePasswordLockout  = 15 * time.Minute
+)
+
+type ShareController struct {
+	logger  golog.Logger
+	db      *gorm.DB
+	storage *storage.Registry
+	signer  *presign.Signer
+}
+
+func NewShareController(logger golog.Logger, db *gorm.DB, storage *storage.Registry, signer *presign.Signer) *ShareController {
+	return &ShareController{
+		logger:  logger,
+		db:      db,
+		storage: storage,
+		signer:  signer,
+	}
+}
+
+// @Summary Create share link
+// @Description Create a public link to a file. The link can expire, allow a limited number of downloads and require a password. The token is only returned here.
+// @Tags Share
+// @Accept json
+// @Produce json
+// @Param id path string true "File ID"
+// @Param request body dto.CreateShareRequest false "Share limits"
+// @Success 201 {object} dto.ShareResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/shares [post]
+func (sc *ShareController) CreateShare(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, sc.db, fileAccessManage)
+	if err != nil {
+		return fileError(c, sc.logger, err)
+	}
+
+	var req dto.CreateShareRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_at must be in the future",
+		})
+	}
+	if req.MaxDownloads != nil && *req.MaxDownloads < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "max_downloads must be at least 1",
+		})
+	}
+
+	token := utils.GenerateSecureToken()
+	share := models.FileShare{
+		ID:           uuid.New(),
+		FileID:       file.ID,
+		CreatedBy:    c.Locals("user_id").(uuid.UUID),
+		TokenHash:    hashShareToken(token),
+		ExpiresAt:    req.ExpiresAt,
+		MaxDownloads: req.MaxDownloads,
+		CreatedAt:    time.Now(),
+	}
+	if req.Password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			sc.logger.Errorf("Failed to hash share password: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		passwordHash := string(hashedPassword)
+		share.PasswordHash = &passwordHash
+	}
+
+	if err := sc.db.Create(&share).Error; err != nil {
+		sc.logger.Errorf("Failed to create share for file %s: %v", file.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create share",
+		})
+	}
+
+	resp := toShareResponse(share)
+	resp.Token = token
+	resp.URL = c.BaseURL() + "/s/" + token
+	return c.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// @Summary List share links
+// @Description List the share links of a file, newest first, with their download counts
+// @Tags Share
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {array} dto.ShareResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/shares [get]
+func (sc *ShareController) ListShares(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, sc.db, fileAccessManage)
+	if err != nil {
+		return fileError(c, sc.logger, err)
+	}
+
+	var shares []models.FileShare
+	if err := sc.db.Where("file_id = ?", file.ID).Order("created_at DESC").Find(&shares).Error; err != nil {
+		sc.logger.Errorf("Failed to list shares of file %s: %v", file.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	resp := make([]dto.ShareResponse, 0, len(shares))
+	for _, share := range shares {
+		resp = append(resp, toShareResponse(share))
+	}
+	return c.JSON(resp)
+}
+
+// @Summary Revoke share link
+// @Description Revoke a share link. It stays listed with its download count but no longer grants downloads.
+// @Tags Share
+// @Produce json
+// @Param id path string true "File ID"
+// @Param shareId path string true "Share ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/shares/{shareId} [delete]
+func (sc *ShareController) RevokeShare(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, sc.db, fileAccessManage)
+	if err != nil {
+		return fileError(c, sc.logger, err)
+	}
+
+	shareID, err := uuid.Parse(c.Params("shareId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Share not found",
+		})
+	}
+
+	var share models.FileShare
+	if err := sc.db.Where("id = ? AND file_id = ?", shareID, file.ID).First(&share).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Share not found",
+			})
+		}
+		sc.logger.Errorf("Database error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if share.RevokedAt == nil {
+		if err := sc.db.Model(&share).Update("revoked_at", time.Now()).Error; err != nil {
+			sc.logger.Errorf("Failed to revoke share %s: %v", share.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to revoke share",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Share revoked successfully",
+	})
+}
+
+// @Summary Download shared file
+// @Description Stream a shared file without logging in. Password-protected shares take the password through Basic auth (any username) or an X-Share-Password header; after 5 wrong passwords in a row the share answers 429 for 15 minutes. Range and conditional requests are supported as on /files/{id}/content. A request that sends content counts as a download and sets a share_grant cookie; for 6 hours, requests carrying it neither count again nor need the password, so resumed downloads and seeking players use one download. HEAD, 304, 404 and 416 responses do not count.
+// @Tags Share
+// @Produce octet-stream
+// @Param token path string true "Share token"
+// @Param Range header string false "Byte ranges, e.g. bytes=0-1023"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 410 {object} map[string]string
+// @Failure 416 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /s/{token} [get]
+func (sc *ShareController) DownloadShare(c *fiber.Ctx) error {
+	// Share URLs are bearer credentials: keep them out of Referer headers and search indexes
+	c.Set(fiber.HeaderReferrerPolicy, "no-referrer")
+	c.Set("X-Robots-Tag", "noindex, nofollow")
+
+	var share models.FileShare
+	if err := sc.db.Where("token_hash = ?", hashShareToken(c.Params("token"))).First(&share).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Share not found",
+			})
+		}
+		sc.logger.Errorf("Database error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	now := time.Now()
+	if !share.Active(now) {
+		return shareGone(c)
+	}
+
+	// A client holding a grant was counted a download and passed the password check already
+	granted := sc.granted(c, &share, now)
+	if !granted {
+		if !share.Usable(now) {
+			return shareGone(c)
+		}
+		if share.PasswordHash != nil {
+			if ok, err := sc.checkPassword(c, &share, now); !ok {
+				return err
+			}
+		}
+	}
+
+	// Trashed files are excluded by the default scope, so their shares stop working until restored
+	var file models.FileUpload
+	if err := sc.db.Where("id = ?", share.FileID).First(&file).Error; err != nil {
+		return fileError(c, sc.logger, err)
+	}
+
+	if file.ScanStatus == models.ScanStatusInfected {
+		return quarantinedError(c)
+	}
+
+	// Revalidations send no content and do not count; any other request without a grant does, once
+	// it is known to be answered with content
+	var claim func() (bool, error)
+	if c.Method() != fiber.MethodHead && !granted {
+		claim = func() (bool, error) {
+			ok, err := sc.claimDownload(c, &share)
+			if ok {
+				sc.grant(c, &share, now)
+			}
+			return ok, err
+		}
+	}
+	return streamContent(c, sc.logger, sc.storage, &file, originalContent(&file), claim)
+}
+
+// claimDownload counts a download of a share in one conditional update, so concurrent requests
+// cannot exceed its limit. It answers the request itself when the share is used up.
+func (sc *ShareController) claimDownload(c *fiber.Ctx, share *models.FileShare) (bool, error) {
+	now := time.Now()
+	result := sc.db.Model(&models.FileShare{}).
+		Where("id = ? AND revoked_at IS NULL", share.ID).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where("max_downloads IS NULL OR download_count < max_downloads").
+		Updates(map[string]interface{}{
+			"download_count":     gorm.Expr("download_count + 1"),
+			"last_downloaded_at": now,
+		})
+	if result.Error != nil {
+		sc.logger.Errorf("Failed to count download of share %s: %v", share.ID, result.Error)
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return false, shareGone(c)
+	}
+	return true, nil
+}
+
+// checkPassword verifies the password of a protected share. Each attempt is charged before the
+// password is compared, in the same update that refuses attempts while the share is locked, so
+// concurrent guesses cannot slip past the limit; a right password clears the count again. It
+// answers the request itself when the password is missing, wrong or locked.
+func (sc *ShareController) checkPassword(c *fiber.Ctx, share *models.FileShare, now time.Time) (bool, error) {
+	password := sharePassword(c)
+	if password == "" {
+		return false, sharePasswordRequired(c)
+	}
+
+	result := sc.db.Model(&models.FileShare{}).
+		Where("id = ?", share.ID).
+		Where("password_locked_until IS NULL OR password_locked_until <= ?", now).
+		Updates(map[string]interface{}{
+			"failed_password_attempts": gorm.Expr("failed_password_attempts + 1"),
+			"password_locked_until": gorm.Expr("CASE WHEN (failed_password_attempts + 1) % ? = 0 THEN ? ELSE password_locked_until END",
+				sharePasswordAttempts, now.Add(sharePasswordLockout)),
+		})
+	if result.Error != nil {
+		sc.logger.Errorf("Failed to record password attempt on share %s: %v", share.ID, result.Error)
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if result.RowsAffected == 0 {
+		retry := sharePasswordLockout
+		if share.PasswordLockedUntil != nil && share.PasswordLockedUntil.After(now) {
+			retry = share.PasswordLockedUntil.Sub(now)
+		}
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		return false, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Too many wrong passwords, try again later",
+		})
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(*share.PasswordHash), []byte(password)) != nil {
+		return false, sharePasswordRequired(c)
+	}
+	if err := sc.db.Model(&models.FileShare{}).Where("id = ?", share.ID).Update("failed_password_attempts", 0).Error; err != nil {
+		sc.logger.Errorf("Failed to reset password attempts of share %s: %v", share.ID, err)
+	}
+	return true, nil
+}
+
+// grant sets the cookie that lets the client fetch the share again without counting a download.
+// It is signed for the share and scoped to its URL, and lasts no longer than the share.
+func (sc *ShareController) grant(c *fiber.Ctx, share *models.FileShare, now time.Time) {
+	expires := now.Add(shareGrantTTL)
+	if share.ExpiresAt != nil && share.ExpiresAt.Before(expires) {
+		expires = *share.ExpiresAt
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     shareGrantCookie,
+		Value:    sc.signer.Sign(fiber.MethodGet, shareGrantPath(share), nil, expires).Encode(),
+		Path:     c.Path(),
+		Expires:  expires,
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// granted reports whether the request carries a valid grant for the share
+func (sc *ShareController) granted(c *fiber.Ctx, share *models.FileShare, now time.Time) bool {
+	value := c.Cookies(shareGrantCookie)
+	if value == "" {
+		return false
+	}
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return false
+	}
+	return sc.signer.Verify(fiber.MethodGet, shareGrantPath(share), query, now) == nil
+}
+
+// shareGrantPath names the share a grant is signed for
+func shareGrantPath(share *models.FileShare) string {
+	return "/shares/" + share.ID.String() + "/grant"
+}
+
+// sharePassword reads the password from Basic auth credentials or the X-Share-Password header
+func sharePassword(c *fiber.Ctx) string {
+	if password := c.Get(sharePasswordHeader); password != "" {
+		return password
+	}
+	scheme, credentials, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return ""
+	}
+	_, password, _ := strings.Cut(string(decoded), ":")
+	return password
+}
+
+func sharePasswordRequired(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="Shared file", charset="UTF-8"`)
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": "A valid password is required to download this file",
+	})
+}
+
+func shareGone(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusGone).JSON(fiber.Map{
+		"error": "Share link has expired or been revoked",
+	})
+}
+
+// hashShareToken returns the SHA-256 under which a share token is stored. Tokens carry 256 bits
+// of randomness, so an unsalted fast hash is enough to keep a database leak from exposing links.
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func toShareResponse(share models.FileShare) dto.ShareResponse {
+	return dto.ShareResponse{
+		ID:               share.ID,
+		FileID:           share.FileID,
+		ExpiresAt:        share.ExpiresAt,
+		MaxDownloads:     share.MaxDownloads,
+		DownloadCount:    share.DownloadCount,
+		HasPassword:      share.PasswordHash != nil,
+		Active:           share.Usable(time.Now()),
+		LastDownloadedAt: share.LastDownloadedAt,
+		RevokedAt:        share.RevokedAt,
+		CreatedBy:        share.CreatedBy,
+		CreatedAt:        share.CreatedAt,
+	}
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"authentication-app/internal/models"
+	"authentication-app/pkg/presign"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestShareGrant(t *testing.T) {
+	sc := &ShareController{signer: presign.NewSigner("secret")}
+	share := &models.FileShare{ID: uuid.New()}
+	expiring := time.Now().Add(time.Minute)
+	shortLived := &models.FileShare{ID: uuid.New(), ExpiresAt: &expiring}
+
+	var now time.Time
+	app := fiber.New()
+	app.Get("/s/:token", func(c *fiber.Ctx) error {
+		target := share
+		if c.Params("token") == "short" {
+			target = shortLived
+		}
+		if sc.granted(c, target, now) {
+			return c.SendString("granted")
+		}
+		if c.Query("grant") != "" {
+			sc.grant(c, target, now)
+		}
+		return c.SendString("counted")
+	})
+	get := func(path string, cookie *http.Cookie) (string, *http.Response) {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp
+	}
+	grantFor := func(path string) *http.Cookie {
+		t.Helper()
+		_, resp := get(path+"?grant=1", nil)
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == shareGrantCookie {
+				return cookie
+			}
+		}
+		t.Fatalf("no %s cookie set by %s", shareGrantCookie, path)
+		return nil
+	}
+
+	now = time.Now()
+	cookie := grantFor("/s/long")
+	if !cookie.HttpOnly || cookie.Path != "/s/long" {
+		t.Errorf("grant cookie is not HttpOnly and scoped to the link: %+v", cookie)
+	}
+
+	if body, _ := get("/s/long", nil); body != "counted" {
+		t.Errorf("request without a grant = %q, want counted", body)
+	}
+	if body, _ := get("/s/long", cookie); body != "granted" {
+		t.Errorf("request with a grant = %q, want granted", body)
+	}
+
+	// A grant only opens the share it was signed for
+	if body, _ := get("/s/short", &http.Cookie{Name: shareGrantCookie, Value: cookie.Value}); body != "counted" {
+		t.Errorf("grant of another share = %q, want counted", body)
+	}
+
+	tampered := &http.Cookie{Name: shareGrantCookie, Value: strings.Replace(cookie.Value, "expires=", "expires=9", 1)}
+	if body, _ := get("/s/long", tampered); body != "counted" {
+		t.Errorf("grant with a changed expiry = %q, want counted", body)
+	}
+
+	now = time.Now().Add(shareGrantTTL + time.Minute)
+	if body, _ := get("/s/long", cookie); body != "counted" {
+		t.Errorf("expired grant = %q, want counted", body)
+	}
+
+	// A grant lasts no longer than its share
+	now = time.Now()
+	short := grantFor("/s/short")
+	now = expiring.Add(time.Second)
+	if body, _ := get("/s/short", short); body != "counted" {
+		t.Errorf("grant past the share's expiry = %q, want counted", body)
+	}
+}
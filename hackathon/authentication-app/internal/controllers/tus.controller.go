@@ -0,0 +1,360 @@
+package controllers
+
+import (
+	"authentication-app/internal/models"
+	"authentication-app/internal/upload"
+	"authentication-app/internal/workers"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination,expiration"
+	tusContentType = "application/offset+octet-stream"
+)
+
+// TusController implements the tus 1.0 resumable upload protocol on top of the upload service
+type TusController struct {
+	logger   golog.Logger
+	db       *gorm.DB
+	uploads  *upload.Service
+	variants *workers.VariantGenerator
+}
+
+func NewTusController(logger golog.Logger, db *gorm.DB, uploads *upload.Service, variants *workers.VariantGenerator) *TusController {
+	return &TusController{
+		logger:   logger,
+		db:       db,
+		uploads:  uploads,
+		variants: variants,
+	}
+}
+
+// Protocol answers every tus request with the protocol version and refuses clients speaking
+// another one. OPTIONS is exempt, as it is how clients discover the version.
+func (tc *TusController) Protocol(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	if c.Method() != fiber.MethodOptions && c.Get("Tus-Resumable") != tusVersion {
+		c.Set("Tus-Version", tusVersion)
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"error": "Unsupported tus version, expected " + tusVersion,
+		})
+	}
+	return c.Next()
+}
+
+// @Summary Tus capabilities
+// @Description Describe the supported tus version and extensions. The largest accepted upload depends on the caller's role, so Tus-Max-Size is not sent; max_file_size of GET /files/quota gives it.
+// @Tags Resumable Upload
+// @Success 204
+// @Header 204 {string} Tus-Version "Supported protocol versions"
+// @Header 204 {string} Tus-Extension "Supported extensions"
+// @Router /files/tus [options]
+func (tc *TusController) Options(c *fiber.Ctx) error {
+	c.Set("Tus-Version", tusVersion)
+	c.Set("Tus-Extension", tusExtensions)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary Create resumable upload
+// @Description Start a tus upload of Upload-Length bytes. Upload-Metadata must carry the base64 encoded filename and should carry filetype; folder_id places the file in a folder. The upload policy is checked before any content is sent.
+// @Tags Resumable Upload
+// @Param Tus-Resumable header string true "Protocol version" default(1.0.0)
+// @Param Upload-Length header int true "Total size in bytes"
+// @Param Upload-Metadata header string true "Comma-separated key and base64 value pairs, e.g. filename cGhvdG8ucG5n,filetype aW1hZ2UvcG5n"
+// @Success 201
+// @Header 201 {string} Location "URL of the new upload"
+// @Header 201 {string} Upload-Expires "When the upload expires unless resumed"
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/tus [post]
+func (tc *TusController) Create(c *fiber.Ctx) error {
+	if c.Get("Upload-Defer-Length") != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Upload-Defer-Length is not supported",
+		})
+	}
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Upload-Length must be a positive integer",
+		})
+	}
+
+	rawMetadata := c.Get("Upload-Metadata")
+	metadata, err := parseUploadMetadata(rawMetadata)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Upload-Metadata",
+		})
+	}
+	filename := firstNonEmpty(metadata["filename"], metadata["name"])
+	if filename == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Upload-Metadata must include filename",
+		})
+	}
+	contentType := firstNonEmpty(metadata["filetype"], metadata["type"], mime.TypeByExtension(filepath.Ext(filename)))
+
+	role, _ := c.Locals("role").(string)
+	request := upload.Request{
+		UserID:       c.Locals("user_id").(uuid.UUID),
+		Role:         role,
+		Filename:     filepath.Base(filename),
+		DeclaredType: contentType,
+		Size:         length,
+	}
+	// Like single-request uploads, the upload belongs to the organization active when it starts
+	if orgID, ok := c.Locals("org_id").(uuid.UUID); ok && orgID != uuid.Nil {
+		request.OrganizationID = &orgID
+	}
+	if value := metadata["folder_id"]; value != "" {
+		folderID, err := uuid.Parse(value)
+		if err != nil {
+			return folderError(c, tc.logger, gorm.ErrRecordNotFound)
+		}
+		if _, err := findTenantFolder(c, tc.db, folderID); err != nil {
+			return folderError(c, tc.logger, err)
+		}
+		request.FolderID = &folderID
+	}
+
+	created, err := tc.uploads.CreateResumable(c.UserContext(), request, rawMetadata)
+	if err != nil {
+		return tc.uploadError(c, err)
+	}
+
+	c.Location("/files/tus/" + created.ID.String())
+	c.Set("Upload-Expires", created.ExpiresAt.UTC().Format(http.TimeFormat))
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// @Summary Resumable upload offset
+// @Description Get how many bytes of a tus upload have been received. Completed uploads also carry the ID of the created file.
+// @Tags Resumable Upload
+// @Param id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version" default(1.0.0)
+// @Success 200
+// @Header 200 {integer} Upload-Offset "Bytes received"
+// @Header 200 {integer} Upload-Length "Total size in bytes"
+// @Header 200 {string} X-File-Id "ID of the created file, once completed"
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/tus/{id} [head]
+func (tc *TusController) Head(c *fiber.Ctx) error {
+	resumable, err := tc.findUpload(c)
+	if err != nil {
+		return tc.lookupError(c, err)
+	}
+
+	c.Set("Upload-Length", strconv.FormatInt(resumable.Length, 10))
+	if resumable.Metadata != "" {
+		c.Set("Upload-Metadata", resumable.Metadata)
+	}
+	if resumable.Completed() {
+		c.Set("X-File-Id", resumable.FileID.String())
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	setOffsetHeaders(c, resumable)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// @Summary Upload chunk
+// @Description Append a chunk at Upload-Offset. A chunk is only kept once it has been received completely. The chunk that completes the upload also validates and records the file, exactly like POST /files/upload.
+// @Tags Resumable Upload
+// @Accept application/offset+octet-stream
+// @Param id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version" default(1.0.0)
+// @Param Upload-Offset header int true "Offset the chunk starts at"
+// @Success 204
+// @Header 204 {integer} Upload-Offset "Bytes received"
+// @Header 204 {string} X-File-Id "ID of the created file, once completed"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/tus/{id} [patch]
+func (tc *TusController) Patch(c *fiber.Ctx) error {
+	resumable, err := tc.findUpload(c)
+	if err != nil {
+		return tc.lookupError(c, err)
+	}
+
+	if c.Get(fiber.HeaderContentType) != tusContentType {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Content-Type must be " + tusContentType,
+		})
+	}
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Upload-Offset must be a non-negative integer",
+		})
+	}
+	if contentLength := c.Request().Header.ContentLength(); contentLength > 0 && int64(contentLength) > resumable.Length-resumable.Offset {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "Chunk exceeds the Upload-Length",
+		})
+	}
+
+	var body io.Reader = c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+	if err := tc.uploads.AppendResumable(c.UserContext(), resumable, offset, body); err != nil {
+		return tc.uploadError(c, err)
+	}
+
+	if resumable.Offset == resumable.Length {
+		role, _ := c.Locals("role").(string)
+		file, err := tc.uploads.CompleteResumable(c.UserContext(), resumable, upload.Request{
+			Role:      role,
+			UserAgent: c.Get("User-Agent"),
+			IPAddress: c.IP(),
+		})
+		if err != nil {
+			// Content that breaks the policy will never be accepted, so the upload is over
+			var violation *upload.Violation
+			if errors.As(err, &violation) {
+				if err := tc.uploads.TerminateResumable(c.UserContext(), resumable); err != nil {
+					tc.logger.Errorf("Failed to terminate rejected upload %s: %v", resumable.ID, err)
+				}
+			}
+			return tc.uploadError(c, err)
+		}
+		tc.variants.Enqueue(file.ID)
+		c.Set("X-File-Id", file.ID.String())
+	}
+
+	setOffsetHeaders(c, resumable)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// @Summary Terminate resumable upload
+// @Description Cancel a tus upload and delete its chunks. A file it was completed into is kept.
+// @Tags Resumable Upload
+// @Param id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version" default(1.0.0)
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/tus/{id} [delete]
+func (tc *TusController) Terminate(c *fiber.Ctx) error {
+	resumable, err := tc.findUpload(c)
+	if err != nil {
+		return tc.lookupError(c, err)
+	}
+
+	if err := tc.uploads.TerminateResumable(c.UserContext(), resumable); err != nil {
+		tc.logger.Errorf("Failed to terminate upload %s: %v", resumable.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (tc *TusController) findUpload(c *fiber.Ctx) (*models.TusUpload, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return tc.uploads.FindResumable(c.UserContext(), id, c.Locals("user_id").(uuid.UUID))
+}
+
+// lookupError answers 404 for uploads that do not exist, have expired or belong to someone else
+func (tc *TusController) lookupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Upload not found",
+		})
+	}
+	tc.logger.Errorf("Failed to load upload: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
+
+func (tc *TusController) uploadError(c *fiber.Ctx, err error) error {
+	var violation *upload.Violation
+	switch {
+	case errors.As(err, &violation):
+		return c.Status(violationStatus(violation)).JSON(fiber.Map{
+			"error": violation.Message,
+		})
+	case errors.Is(err, upload.ErrOffsetMismatch):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Upload-Offset does not match the current offset",
+		})
+	case errors.Is(err, upload.ErrScanUnavailable):
+		// The chunks are kept; an empty PATCH at the final offset retries the completion
+		tc.logger.Errorf("Resumable upload failed: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "File could not be scanned for malware, please try again later",
+		})
+	default:
+		tc.logger.Errorf("Resumable upload failed: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save file",
+		})
+	}
+}
+
+func setOffsetHeaders(c *fiber.Ctx, resumable *models.TusUpload) {
+	c.Set("Upload-Offset", strconv.FormatInt(resumable.Offset, 10))
+	c.Set("Upload-Expires", resumable.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma-separated pairs of a unique key
+// and an optional base64 encoded value
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+		if _, ok := metadata[key]; ok {
+			return nil, fmt.Errorf("duplicate metadata key %q", key)
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
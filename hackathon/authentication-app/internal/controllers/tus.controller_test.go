@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", header: "", want: map[string]string{}},
+		{
+			name:   "filename and type",
+			header: "filename cGhvdG8ucG5n,filetype aW1hZ2UvcG5n",
+			want:   map[string]string{"filename": "photo.png", "filetype": "image/png"},
+		},
+		{
+			name:   "spaces around pairs",
+			header: " filename cGhvdG8ucG5n , filetype aW1hZ2UvcG5n ,",
+			want:   map[string]string{"filename": "photo.png", "filetype": "image/png"},
+		},
+		{
+			name:   "key without a value",
+			header: "is_confidential,filename cGhvdG8ucG5n",
+			want:   map[string]string{"is_confidential": "", "filename": "photo.png"},
+		},
+		{
+			name:   "non-ascii value",
+			header: "filename 0YTQvtGC0L4uanBn",
+			want:   map[string]string{"filename": "фото.jpg"},
+		},
+		{name: "invalid base64", header: "filename not-base64!", wantErr: true},
+		{name: "unpadded base64", header: "filename cGhvdG8", wantErr: true},
+		{name: "duplicate key", header: "filename YS5wbmc=,filename Yi5wbmc=", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUploadMetadata(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUploadMetadata(%q) error = %v, wantErr %v", tt.header, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseUploadMetadata(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
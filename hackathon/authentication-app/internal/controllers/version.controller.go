@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"authentication-app/internal/upload"
+	"authentication-app/internal/workers"
+	"authentication-app/pkg/storage"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+type VersionController struct {
+	logger   golog.Logger
+	db       *gorm.DB
+	storage  *storage.Registry
+	uploads  *upload.Service
+	variants *workers.VariantGenerator
+}
+
+func NewVersionController(logger golog.Logger, db *gorm.DB, storage *storage.Registry, uploads *upload.Service, variants *workers.VariantGenerator) *VersionController {
+	return &VersionController{
+		logger:   logger,
+		db:       db,
+		storage:  storage,
+		uploads:  uploads,
+		variants: variants,
+	}
+}
+
+// @Summary Upload a new version
+// @Description Replace the content of a file with a new version. The upload goes through the same policy, quota and malware checks as a new file, except that it does not count as another file; the bytes count against the uploader's quota. Tags, metadata, folder and shares stay with the file. Earlier versions are kept up to the configured number. Requires write access.
+// @Tags Version
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "File ID"
+// @Param file formData file true "New content"
+// @Success 200 {object} dto.FileVersionUploadResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/content [put]
+func (vc *VersionController) UploadVersion(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, vc.db, fileAccessWrite)
+	if err != nil {
+		return fileError(c, vc.logger, err)
+	}
+
+	form, err := readMultipartUpload(c, "file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No file provided or invalid form data",
+		})
+	}
+	defer form.finish(c)
+
+	request := vc.request(c)
+	request.Filename = form.file.FileName()
+	request.DeclaredType = form.file.Header.Get("Content-Type")
+	request.Size = -1
+	request.Body = form.file
+
+	updated, version, err := vc.uploads.IngestVersion(c.UserContext(), file.ID, request)
+	if err != nil {
+		return vc.uploadError(c, err)
+	}
+	vc.variants.Enqueue(updated.ID)
+
+	return c.JSON(dto.FileVersionUploadResponse{
+		File:    toFileResponse(*updated),
+		Version: toVersionResponse(updated, *version),
+	})
+}
+
+// @Summary List file versions
+// @Description List the versions of a file, newest first, with their size, hash, scan status and uploader
+// @Tags Version
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {array} dto.FileVersionResponse
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/versions [get]
+func (vc *VersionController) ListVersions(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, vc.db, fileAccessRead)
+	if err != nil {
+		return fileError(c, vc.logger, err)
+	}
+
+	var versions []models.FileVersion
+	if err := vc.db.Preload("Uploader").Where("file_id = ?", file.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		vc.logger.Errorf("Failed to list versions of file %s: %v", file.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	resp := make([]dto.FileVersionResponse, 0, len(versions))
+	for _, version := range versions {
+		resp = append(resp, toVersionResponse(file, version))
+	}
+	return c.JSON(resp)
+}
+
+// @Summary Download a file version
+// @Description Stream the content of one version of a file as an attachment named after the name it was uploaded with. Quarantined versions answer 403.
+// @Tags Version
+// @Produce octet-stream
+// @Param id path string true "File ID"
+// @Param version path int true "Version number"
+// @Param Range header string false "Byte ranges, e.g. bytes=0-1023"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 416 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/versions/{version}/content [get]
+func (vc *VersionController) DownloadVersion(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, vc.db, fileAccessRead)
+	if err != nil {
+		return fileError(c, vc.logger, err)
+	}
+
+	number, err := c.ParamsInt("version")
+	if err != nil {
+		return vc.versionError(c, gorm.ErrRecordNotFound)
+	}
+	var version models.FileVersion
+	if err := vc.db.Where("file_id = ? AND version = ?", file.ID, number).First(&version).Error; err != nil {
+		return vc.versionError(c, err)
+	}
+
+	return streamContent(c, vc.logger, vc.storage, file, versionContent(file, &version), nil)
+}
+
+// @Summary Restore a file version
+// @Description Roll a file back to an earlier version. Its content is uploaded again as a new version, so the history is kept and the policy and malware checks of today apply. Quarantined versions cannot be restored. Requires write access.
+// @Tags Version
+// @Produce json
+// @Param id path string true "File ID"
+// @Param version path int true "Version number"
+// @Success 200 {object} dto.FileVersionUploadResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Security BearerAuth
+// @Router /files/{id}/versions/{version}/restore [post]
+func (vc *VersionController) RestoreVersion(c *fiber.Ctx) error {
+	file, err := authorizeFile(c, vc.db, fileAccessWrite)
+	if err != nil {
+		return fileError(c, vc.logger, err)
+	}
+
+	number, err := c.ParamsInt("version")
+	if err != nil {
+		return vc.versionError(c, gorm.ErrRecordNotFound)
+	}
+
+	updated, version, err := vc.uploads.RestoreVersion(c.UserContext(), file.ID, number, vc.request(c))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return vc.versionError(c, err)
+		}
+		return vc.uploadError(c, err)
+	}
+	vc.variants.Enqueue(updated.ID)
+
+	return c.JSON(dto.FileVersionUploadResponse{
+		File:    toFileResponse(*updated),
+		Version: toVersionResponse(updated, *version),
+	})
+}
+
+// request describes an upload by the caller; the content fields are filled in by the handler
+func (vc *VersionController) request(c *fiber.Ctx) upload.Request {
+	role, _ := c.Locals("role").(string)
+	return upload.Request{
+		UserID:    c.Locals("user_id").(uuid.UUID),
+		Role:      role,
+		UserAgent: c.Get("User-Agent"),
+		IPAddress: c.IP(),
+	}
+}
+
+func (vc *VersionController) uploadError(c *fiber.Ctx, err error) error {
+	var violation *upload.Violation
+	switch {
+	case errors.As(err, &violation):
+		return c.Status(violationStatus(violation)).JSON(fiber.Map{
+			"error": violation.Message,
+		})
+	case errors.Is(err, upload.ErrScanUnavailable):
+		vc.logger.Errorf("Failed to upload version: %v", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "File could not be scanned for malware, please try again later",
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// The file was purged while the version was uploaded
+		return fileError(c, vc.logger, err)
+	default:
+		vc.logger.Errorf("Failed to upload version: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save file",
+		})
+	}
+}
+
+func (vc *VersionController) versionError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Version not found",
+		})
+	}
+	vc.logger.Errorf("Database error: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Internal server error",
+	})
+}
+
+func toVersionResponse(file *models.FileUpload, version models.FileVersion) dto.FileVersionResponse {
+	resp := dto.FileVersionResponse{
+		Version:       version.Version,
+		OriginalName:  version.OriginalName,
+		ContentType:   version.ContentType,
+		Size:          version.Size,
+		Width:         version.Width,
+		Height:        version.Height,
+		SHA256:        version.SHA256,
+		ScanStatus:    version.ScanStatus,
+		ScanSignature: version.ScanSignature,
+		UploadedBy:    version.UploadedBy,
+		Current:       version.Version == file.Version,
+		CreatedAt:     version.CreatedAt,
+	}
+	if version.Uploader != nil {
+		resp.Uploader = version.Uploader.Username
+	}
+	return resp
+}
@@ -0,0 +1,603 @@
+package controllers
+
+import (
+	"authentication-app/config"
+	dto "authentication-app/internal/DTOs"
+	"authentication-app/internal/models"
+	"authentication-app/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errWebAuthnSessionInvalid = errors.New("webauthn session expired or invalid")
+
+type WebAuthnController struct {
+	cfg      *config.Config
+	logger   golog.Logger
+	db       *gorm.DB
+	webAuthn *webauthn.WebAuthn
+	timeout  time.Duration
+}
+
+func NewWebAuthnController(cfg *config.Config, logger golog.Logger, db *gorm.DB) (*WebAuthnController, error) {
+	timeout := time.Duration(cfg.WebAuthnTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPDisplayName,
+		RPOrigins:     utils.SplitAndTrim(cfg.WebAuthnRPOrigins, ","),
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: timeout, TimeoutUVD: timeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: timeout, TimeoutUVD: timeout},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnController{
+		cfg:      cfg,
+		logger:   logger,
+		db:       db,
+		webAuthn: webAuthn,
+		timeout:  timeout,
+	}, nil
+}
+
+// webAuthnUser adapts a user and their stored passkeys to the webauthn.User interface
+type webAuthnUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	id := u.user.ID
+	return id[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// @Summary Begin passkey registration
+// @Description Start a WebAuthn registration ceremony for the current user
+// @Tags WebAuthn
+// @Accept json
+// @Produce json
+// @Param request body dto.WebAuthnRegisterBeginRequest false "Passkey label"
+// @Success 200 {object} dto.WebAuthnBeginResponse
+// @Failure 400 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/webauthn/register/begin [post]
+func (wc *WebAuthnController) BeginRegistration(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var req dto.WebAuthnRegisterBeginRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	if len(req.Name) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Passkey name must be at most 255 characters",
+		})
+	}
+
+	user, err := wc.loadUser(c.UserContext(), userID)
+	if err != nil {
+		wc.logger.Errorf("Failed to load user for passkey registration: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Stop the authenticator from registering the same passkey twice
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := wc.webAuthn.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		wc.logger.Errorf("Failed to begin passkey registration: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to begin passkey registration",
+		})
+	}
+
+	sessionID, err := wc.saveSession(c.UserContext(), &userID, models.WebAuthnCeremonyRegistration, req.Name, session)
+	if err != nil {
+		wc.logger.Errorf("Failed to save passkey registration session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to begin passkey registration",
+		})
+	}
+
+	return c.JSON(dto.WebAuthnBeginResponse{
+		SessionID: sessionID,
+		Options:   creation,
+	})
+}
+
+// @Summary Finish passkey registration
+// @Description Verify the authenticator attestation and store the new passkey
+// @Tags WebAuthn
+// @Accept json
+// @Produce json
+// @Param request body dto.WebAuthnFinishRequest true "Session ID and credential returned by navigator.credentials.create()"
+// @Success 201 {object} dto.WebAuthnCredentialInfo
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/webauthn/register/finish [post]
+func (wc *WebAuthnController) FinishRegistration(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var req dto.WebAuthnFinishRequest
+	if err := c.BodyParser(&req); err != nil || len(req.Credential) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	session, err := wc.takeSession(c.UserContext(), req.SessionID, models.WebAuthnCeremonyRegistration)
+	if err != nil || session.UserID == nil || *session.UserID != userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Passkey session expired or invalid",
+		})
+	}
+
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal(session.Data, &sessionData); err != nil {
+		wc.logger.Errorf("Failed to decode passkey session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey credential",
+		})
+	}
+
+	user, err := wc.loadUser(c.UserContext(), userID)
+	if err != nil {
+		wc.logger.Errorf("Failed to load user for passkey registration: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	credential, err := wc.webAuthn.CreateCredential(user, sessionData, parsed)
+	if err != nil {
+		wc.logger.Warnf("Passkey registration rejected for user %s: %v", userID, err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Passkey registration failed",
+		})
+	}
+
+	name := session.Name
+	if name == "" {
+		name = "Passkey " + time.Now().Format("2006-01-02 15:04")
+	}
+
+	record := newWebAuthnCredentialRecord(userID, name, credential)
+	if err := wc.db.WithContext(c.UserContext()).Create(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "duplicate key") {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Passkey is already registered",
+			})
+		}
+		wc.logger.Errorf("Failed to save passkey: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save passkey",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(toWebAuthnCredentialInfo(record))
+}
+
+// @Summary Begin passkey login
+// @Description Start a WebAuthn assertion ceremony. Leave the username empty to let the browser offer any discoverable passkey.
+// @Tags WebAuthn
+// @Accept json
+// @Produce json
+// @Param request body dto.WebAuthnLoginBeginRequest false "Optional username"
+// @Success 200 {object} dto.WebAuthnBeginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/webauthn/login/begin [post]
+func (wc *WebAuthnController) BeginLogin(c *fiber.Ctx) error {
+	var req dto.WebAuthnLoginBeginRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	var (
+		assertion *protocol.CredentialAssertion
+		session   *webauthn.SessionData
+		userID    *uuid.UUID
+		err       error
+	)
+
+	if req.Username == "" {
+		assertion, session, err = wc.webAuthn.BeginDiscoverableLogin()
+	} else {
+		var user models.User
+		if err := wc.db.WithContext(c.UserContext()).Where("username = ?", req.Username).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid credentials",
+				})
+			}
+			wc.logger.Errorf("Database error: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		waUser, loadErr := wc.loadUser(c.UserContext(), user.ID)
+		if loadErr != nil {
+			wc.logger.Errorf("Failed to load passkeys: %v", loadErr)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		if len(waUser.credentials) == 0 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid credentials",
+			})
+		}
+
+		userID = &user.ID
+		assertion, session, err = wc.webAuthn.BeginLogin(waUser)
+	}
+
+	if err != nil {
+		wc.logger.Errorf("Failed to begin passkey login: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to begin passkey login",
+		})
+	}
+
+	sessionID, err := wc.saveSession(c.UserContext(), userID, models.WebAuthnCeremonyLogin, "", session)
+	if err != nil {
+		wc.logger.Errorf("Failed to save passkey login session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to begin passkey login",
+		})
+	}
+
+	return c.JSON(dto.WebAuthnBeginResponse{
+		SessionID: sessionID,
+		Options:   assertion,
+	})
+}
+
+// @Summary Finish passkey login
+// @Description Verify the authenticator assertion and issue a JWT token
+// @Tags WebAuthn
+// @Accept json
+// @Produce json
+// @Param request body dto.WebAuthnFinishRequest true "Session ID and credential returned by navigator.credentials.get()"
+// @Param X-Session-Mode header string false "Set to 'cookie' to receive the token as an HttpOnly cookie"
+// @Success 200 {object} dto.AuthResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/webauthn/login/finish [post]
+func (wc *WebAuthnController) FinishLogin(c *fiber.Ctx) error {
+	var req dto.WebAuthnFinishRequest
+	if err := c.BodyParser(&req); err != nil || len(req.Credential) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	session, err := wc.takeSession(c.UserContext(), req.SessionID, models.WebAuthnCeremonyLogin)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Passkey session expired or invalid",
+		})
+	}
+
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal(session.Data, &sessionData); err != nil {
+		wc.logger.Errorf("Failed to decode passkey session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey credential",
+		})
+	}
+
+	var (
+		user       *webAuthnUser
+		credential *webauthn.Credential
+	)
+	if session.UserID != nil {
+		user, err = wc.loadUser(c.UserContext(), *session.UserID)
+		if err == nil {
+			credential, err = wc.webAuthn.ValidateLogin(user, sessionData, parsed)
+		}
+	} else {
+		credential, err = wc.webAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			id, err := uuid.FromBytes(userHandle)
+			if err != nil {
+				return nil, err
+			}
+			user, err = wc.loadUser(c.UserContext(), id)
+			return user, err
+		}, sessionData, parsed)
+	}
+
+	if err != nil || user == nil {
+		wc.logger.Warnf("Passkey login rejected: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid credentials",
+		})
+	}
+
+	if err := wc.recordAssertion(c.UserContext(), credential); err != nil {
+		wc.logger.Errorf("Failed to update passkey sign count: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// A sign count that did not move forward means the private key may have been cloned
+	if credential.Authenticator.CloneWarning {
+		wc.logger.Warnf("Passkey sign count regression for user %s, possible cloned authenticator", user.user.ID)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Passkey rejected, please contact support",
+		})
+	}
+
+	return respondWithToken(c, wc.cfg, wc.logger, fiber.StatusOK, &user.user, uuid.Nil)
+}
+
+// @Summary List passkeys
+// @Description List the passkeys registered for the current user
+// @Tags WebAuthn
+// @Produce json
+// @Success 200 {array} dto.WebAuthnCredentialInfo
+// @Security BearerAuth
+// @Router /auth/webauthn/credentials [get]
+func (wc *WebAuthnController) ListCredentials(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	var records []models.WebAuthnCredential
+	if err := wc.db.WithContext(c.UserContext()).Where("user_id = ?", userID).Order("created_at").Find(&records).Error; err != nil {
+		wc.logger.Errorf("Failed to list passkeys: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	infos := make([]dto.WebAuthnCredentialInfo, 0, len(records))
+	for _, record := range records {
+		infos = append(infos, toWebAuthnCredentialInfo(record))
+	}
+
+	return c.JSON(infos)
+}
+
+// @Summary Delete passkey
+// @Description Remove one of the current user's passkeys
+// @Tags WebAuthn
+// @Produce json
+// @Param id path string true "Passkey ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/webauthn/credentials/{id} [delete]
+func (wc *WebAuthnController) DeleteCredential(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uuid.UUID)
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid passkey ID",
+		})
+	}
+
+	result := wc.db.WithContext(c.UserContext()).Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		wc.logger.Errorf("Failed to delete passkey: %v", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete passkey",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Passkey not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Passkey deleted successfully",
+	})
+}
+
+func (wc *WebAuthnController) loadUser(ctx context.Context, userID uuid.UUID) (*webAuthnUser, error) {
+	var user models.User
+	if err := wc.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	var records []models.WebAuthnCredential
+	if err := wc.db.WithContext(ctx).Where("user_id = ?", userID).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(records))
+	for _, record := range records {
+		credentials = append(credentials, toWebAuthnCredential(record))
+	}
+
+	return &webAuthnUser{
+		user:        user,
+		credentials: credentials,
+	}, nil
+}
+
+func (wc *WebAuthnController) saveSession(ctx context.Context, userID *uuid.UUID, ceremony, name string, data *webauthn.SessionData) (uuid.UUID, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	db := wc.db.WithContext(ctx)
+
+	// Abandoned ceremonies are cleaned up opportunistically
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnSession{}).Error; err != nil {
+		wc.logger.Warnf("Failed to clean up expired passkey sessions: %v", err)
+	}
+
+	session := models.WebAuthnSession{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Name:      name,
+		Data:      encoded,
+		ExpiresAt: time.Now().Add(wc.timeout),
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return uuid.Nil, err
+	}
+
+	return session.ID, nil
+}
+
+// takeSession deletes and returns a ceremony so that each challenge can only be answered once
+func (wc *WebAuthnController) takeSession(ctx context.Context, id uuid.UUID, ceremony string) (*models.WebAuthnSession, error) {
+	var session models.WebAuthnSession
+	result := wc.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("id = ? AND ceremony = ?", id, ceremony).
+		Delete(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(session.ExpiresAt) {
+		return nil, errWebAuthnSessionInvalid
+	}
+
+	return &session, nil
+}
+
+// recordAssertion persists the sign count and flags reported by the authenticator
+func (wc *WebAuthnController) recordAssertion(ctx context.Context, credential *webauthn.Credential) error {
+	return wc.db.WithContext(ctx).
+		Model(&models.WebAuthnCredential{}).
+		Where("credential_id = ?", credential.ID).
+		Updates(map[string]interface{}{
+			"sign_count":    credential.Authenticator.SignCount,
+			"clone_warning": credential.Authenticator.CloneWarning,
+			"backup_state":  credential.Flags.BackupState,
+			"user_verified": credential.Flags.UserVerified,
+			"last_used_at":  time.Now(),
+		}).Error
+}
+
+func newWebAuthnCredentialRecord(userID uuid.UUID, name string, credential *webauthn.Credential) models.WebAuthnCredential {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	return models.WebAuthnCredential{
+		ID:              uuid.New(),
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		CloneWarning:    credential.Authenticator.CloneWarning,
+		UserPresent:     credential.Flags.UserPresent,
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+}
+
+func toWebAuthnCredential(record models.WebAuthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0)
+	for _, transport := range utils.SplitAndTrim(record.Transports, ",") {
+		transports = append(transports, protocol.AuthenticatorTransport(transport))
+	}
+
+	return webauthn.Credential{
+		ID:              record.CredentialID,
+		PublicKey:       record.PublicKey,
+		AttestationType: record.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserPresent:    record.UserPresent,
+			UserVerified:   record.UserVerified,
+			BackupEligible: record.BackupEligible,
+			BackupState:    record.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       record.AAGUID,
+			SignCount:    record.SignCount,
+			CloneWarning: record.CloneWarning,
+		},
+	}
+}
+
+func toWebAuthnCredentialInfo(record models.WebAuthnCredential) dto.WebAuthnCredentialInfo {
+	return dto.WebAuthnCredentialInfo{
+		ID:         record.ID,
+		Name:       record.Name,
+		SignCount:  record.SignCount,
+		Synced:     record.BackupState,
+		CreatedAt:  record.CreatedAt,
+		LastUsedAt: record.LastUsedAt,
+	}
+}
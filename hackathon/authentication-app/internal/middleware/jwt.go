@@ -3,7 +3,10 @@ package middleware
 import (
 	"authentication-app/config"
 	"authentication-app/internal/models"
+	"authentication-app/pkg/utils"
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -13,22 +16,27 @@ import (
 
 func JWTAuth(cfg *config.Config, db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get Authorization header
+		// Get Authorization header, falling back to the browser session cookie
+		var tokenString string
+		fromCookie := false
 		authHeader := c.Get("Authorization")
-		if authHeader == "" {
+		if authHeader != "" {
+			// Check if it starts with "Bearer "
+			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+			if tokenString == authHeader {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid authorization format. Use 'Bearer <token>'",
+				})
+			}
+		} else if cookie := c.Cookies(cfg.SessionCookieName); cookie != "" {
+			tokenString = cookie
+			fromCookie = true
+		} else {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Authorization header required",
 			})
 		}
 
-		// Check if it starts with "Bearer "
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid authorization format. Use 'Bearer <token>'",
-			})
-		}
-
 		// Parse and validate token
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			// Validate signing method
@@ -79,18 +87,94 @@ func JWTAuth(cfg *config.Config, db *gorm.DB) fiber.Handler {
 			})
 		}
 
-		// Check if token is revoked
-		var revokedToken models.RevokedToken
-		if err := db.Where("token_id = ?", tokenID).First(&revokedToken).Error; err == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Session has been expired. Please login again.",
+		// Browsers attach cookies to cross-site requests, so state-changing calls must echo the CSRF token
+		if fromCookie && !isSafeMethod(c.Method()) {
+			csrfToken := c.Get(cfg.CSRFHeaderName)
+			if csrfToken == "" || csrfToken != c.Cookies(cfg.CSRFCookieName) || !utils.ValidateCSRFToken(tokenString, cfg.JWTSecret, csrfToken) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Invalid CSRF token",
+				})
+			}
+		}
+
+		// Tokens issued before roles existed carry no role claim
+		role, ok := claims["role"].(string)
+		if !ok || role == "" {
+			role = models.RoleUser
+		}
+
+		var issuedAt *time.Time
+		if claim, err := claims.GetIssuedAt(); err == nil && claim != nil {
+			issuedAt = &claim.Time
+		}
+
+		orgID := uuid.Nil
+		if orgIDStr, ok := claims["org_id"].(string); ok && orgIDStr != "" {
+			orgID, err = uuid.Parse(orgIDStr)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid organization ID format",
+				})
+			}
+		}
+
+		orgRole, sessionErr := checkSession(db, userID, tokenID, issuedAt, orgID)
+		if sessionErr != nil {
+			return c.Status(sessionErr.Code).JSON(fiber.Map{
+				"error": sessionErr.Message,
 			})
 		}
 
 		// Set user ID in context
 		c.Locals("user_id", userID)
 		c.Locals("token_id", tokenID)
+		c.Locals("role", role)
+		c.Locals("org_id", orgID)
+		c.Locals("org_role", orgRole)
+		c.Locals("session_token", tokenString)
+		c.Locals("cookie_session", fromCookie)
 
 		return c.Next()
 	}
 }
+
+// checkSession verifies that a session is still honoured: its token is not revoked, the account
+// is active and was not deprovisioned after issuedAt, and the user is still a member of the active
+// organization, whose role it returns
+func checkSession(db *gorm.DB, userID uuid.UUID, tokenID string, issuedAt *time.Time, orgID uuid.UUID) (string, *fiber.Error) {
+	// Check if token is revoked
+	var revokedToken models.RevokedToken
+	if err := db.Where("token_id = ?", tokenID).First(&revokedToken).Error; err == nil {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "Session has been expired. Please login again.")
+	}
+
+	// Deprovisioning disables the account and invalidates every token issued before it
+	var user models.User
+	if err := db.Select("active", "tokens_valid_after").Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fiber.NewError(fiber.StatusUnauthorized, "Invalid user ID")
+		}
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Internal server error")
+	}
+	if !user.Active {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "Account is disabled")
+	}
+	if user.TokensValidAfter != nil {
+		if issuedAt == nil || issuedAt.Before(user.TokensValidAfter.Truncate(time.Second)) {
+			return "", fiber.NewError(fiber.StatusUnauthorized, "Session has been expired. Please login again.")
+		}
+	}
+
+	// An active organization is only honoured while the user is still a member of it
+	if orgID == uuid.Nil {
+		return "", nil
+	}
+	var membership models.OrganizationMembership
+	if err := db.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fiber.NewError(fiber.StatusForbidden, "You are no longer a member of the active organization")
+		}
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Internal server error")
+	}
+	return membership.Role, nil
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"authentication-app/pkg/presign"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Query parameters naming the session a URL was signed for
+const (
+	presignUserParam    = "user"
+	presignOrgParam     = "org"
+	presignRoleParam    = "role"
+	presignSessionParam = "session"
+	presignIssuedParam  = "issued"
+)
+
+// PresignParams describes the caller's session as query parameters, to be signed into a URL that
+// later acts on the caller's behalf
+func PresignParams(c *fiber.Ctx) url.Values {
+	params := url.Values{}
+	params.Set(presignUserParam, c.Locals("user_id").(uuid.UUID).String())
+	if orgID, ok := c.Locals("org_id").(uuid.UUID); ok && orgID != uuid.Nil {
+		params.Set(presignOrgParam, orgID.String())
+	}
+	role, _ := c.Locals("role").(string)
+	params.Set(presignRoleParam, role)
+	tokenID, _ := c.Locals("token_id").(string)
+	params.Set(presignSessionParam, tokenID)
+	params.Set(presignIssuedParam, strconv.FormatInt(time.Now().Unix(), 10))
+	return params
+}
+
+// PresignedAuth accepts a URL signed with PresignParams in place of a JWT and hands requests
+// without a signature to fallback. The session that signed the URL must still be valid, so
+// logging out, deprovisioning or leaving the organization also invalidates its URLs.
+func PresignedAuth(db *gorm.DB, signer *presign.Signer, fallback fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+		if err != nil || !query.Has(presign.SignatureParam) {
+			return fallback(c)
+		}
+
+		// A HEAD is answered like the GET it was signed for
+		method := c.Method()
+		if method == fiber.MethodHead {
+			method = fiber.MethodGet
+		}
+		if err := signer.Verify(method, c.Path(), query, time.Now()); err != nil {
+			if errors.Is(err, presign.ErrExpired) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Signed URL has expired",
+				})
+			}
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Invalid signature",
+			})
+		}
+
+		// The parameters are signed, so they only fail to parse if the signing key leaked
+		userID, err := uuid.Parse(query.Get(presignUserParam))
+		if err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Invalid signature",
+			})
+		}
+		orgID := uuid.Nil
+		if value := query.Get(presignOrgParam); value != "" {
+			if orgID, err = uuid.Parse(value); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Invalid signature",
+				})
+			}
+		}
+		issued, err := strconv.ParseInt(query.Get(presignIssuedParam), 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Invalid signature",
+			})
+		}
+		issuedAt := time.Unix(issued, 0)
+		tokenID := query.Get(presignSessionParam)
+
+		orgRole, sessionErr := checkSession(db, userID, tokenID, &issuedAt, orgID)
+		if sessionErr != nil {
+			return c.Status(sessionErr.Code).JSON(fiber.Map{
+				"error": sessionErr.Message,
+			})
+		}
+
+		c.Locals("user_id", userID)
+		c.Locals("token_id", tokenID)
+		c.Locals("role", query.Get(presignRoleParam))
+		c.Locals("org_id", orgID)
+		c.Locals("org_role", orgRole)
+		c.Locals("presigned_until", presign.Expires(query))
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"authentication-app/config"
+	dto "authentication-app/internal/DTOs"
+	"crypto/sha256"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SCIMAuth protects the provisioning API with its own static bearer token, separate from user JWTs
+func SCIMAuth(cfg *config.Config) fiber.Handler {
+	expected := sha256.Sum256([]byte(cfg.SCIMBearerToken))
+
+	return func(c *fiber.Ctx) error {
+		token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		// Hash both sides so the comparison does not leak the token length
+		provided := sha256.Sum256([]byte(token))
+		if token == "" || subtle.ConstantTimeCompare(provided[:], expected[:]) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(dto.SCIMError{
+				Schemas: []string{dto.SCIMSchemaError},
+				Status:  strconv.Itoa(fiber.StatusUnauthorized),
+				Detail:  "Invalid SCIM bearer token",
+			}, "application/scim+json")
+		}
+
+		return c.Next()
+	}
+}
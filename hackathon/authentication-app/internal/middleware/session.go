@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"authentication-app/config"
+	"authentication-app/pkg/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SessionModeHeader lets browser clients ask for a cookie session instead of a bearer token
+const SessionModeHeader = "X-Session-Mode"
+
+// WantsCookieSession reports whether the client asked for the JWT to be stored in a cookie
+func WantsCookieSession(c *fiber.Ctx) bool {
+	return strings.EqualFold(c.Get(SessionModeHeader), "cookie")
+}
+
+// SetSessionCookies stores the JWT in an HttpOnly cookie next to a readable CSRF cookie and
+// returns the CSRF token the client has to echo in the CSRF header
+func SetSessionCookies(c *fiber.Ctx, cfg *config.Config, token string, expiresAt time.Time) string {
+	csrfToken := utils.GenerateCSRFToken(token, cfg.JWTSecret)
+	c.Cookie(sessionCookie(cfg, cfg.SessionCookieName, token, expiresAt, true))
+	c.Cookie(sessionCookie(cfg, cfg.CSRFCookieName, csrfToken, expiresAt, false))
+	return csrfToken
+}
+
+// ClearSessionCookies expires both session cookies with the attributes they were set with
+func ClearSessionCookies(c *fiber.Ctx, cfg *config.Config) {
+	expired := time.Unix(0, 0)
+	c.Cookie(sessionCookie(cfg, cfg.SessionCookieName, "", expired, true))
+	c.Cookie(sessionCookie(cfg, cfg.CSRFCookieName, "", expired, false))
+}
+
+func sessionCookie(cfg *config.Config, name, value string, expiresAt time.Time, httpOnly bool) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   cfg.SessionCookieDomain,
+		Expires:  expiresAt,
+		Secure:   cfg.SessionCookieSecure,
+		HTTPOnly: httpOnly,
+		SameSite: cfg.SessionCookieSameSite,
+	}
+}
+
+// isSafeMethod reports whether the method is read-only and therefore exempt from CSRF checks
+func isSafeMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Blob is a stored object addressed by the SHA-256 of its content. Every upload of the same bytes
+// points at the same blob; RefCount counts those uploads, trashed ones included.
+type Blob struct {
+	SHA256         string    `gorm:"column:sha256;primaryKey" json:"sha256"`
+	StorageBackend string    `gorm:"column:storage_backend;not null" json:"storage_backend"`
+	StorageKey     string    `gorm:"column:storage_key;not null" json:"storage_key"`
+	Size           int64     `gorm:"column:size;not null" json:"size"`
+	RefCount       int       `gorm:"column:ref_count;not null" json:"ref_count"`
+	CreatedAt      time.Time `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (Blob) TableName() string {
+	return "authentication-app.blobs"
+}
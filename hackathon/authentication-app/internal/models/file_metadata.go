@@ -0,0 +1,50 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Tags is the list of user-defined tags of a file, stored as a JSONB array
+type Tags []string
+
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(t))
+	return string(b), err
+}
+
+func (t *Tags) Scan(src interface{}) error {
+	return scanJSON(src, t)
+}
+
+// Metadata is the free-form key/value metadata of a file, stored as a JSONB object
+type Metadata map[string]interface{}
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]interface{}(m))
+	return string(b), err
+}
+
+func (m *Metadata) Scan(src interface{}) error {
+	return scanJSON(src, m)
+}
+
+func scanJSON(src interface{}, dst interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("cannot scan %T into %T", src, dst)
+	}
+}
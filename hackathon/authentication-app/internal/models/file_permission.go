@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FilePermissionRead  = "read"
+	FilePermissionWrite = "write"
+)
+
+// FilePermissionRank orders file permissions so that they can be compared; unknown permissions rank lowest
+func FilePermissionRank(permission string) int {
+	switch permission {
+	case FilePermissionWrite:
+		return 2
+	case FilePermissionRead:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// FilePermission grants one user access to a single file, independently of the file's tenant
+type FilePermission struct {
+	ID         uuid.UUID  `gorm:"column:id;primaryKey" json:"id"`
+	FileID     uuid.UUID  `gorm:"column:file_id;not null;uniqueIndex:idx_file_permissions_file_user" json:"file_id"`
+	UserID     uuid.UUID  `gorm:"column:user_id;not null;uniqueIndex:idx_file_permissions_file_user" json:"user_id"`
+	Permission string     `gorm:"column:permission;not null" json:"permission"`
+	GrantedBy  *uuid.UUID `gorm:"column:granted_by" json:"granted_by"`
+	CreatedAt  time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt  *time.Time `gorm:"column:updated_at" json:"updated_at"`
+	File       FileUpload `gorm:"foreignKey:FileID" json:"-"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (FilePermission) TableName() string {
+	return "authentication-app.file_permissions"
+}
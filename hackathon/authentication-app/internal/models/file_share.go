@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileShare is a public link to a file. Only the SHA-256 of its token is stored; the token itself
+// is shown once, when the share is created.
+type FileShare struct {
+	ID               uuid.UUID  `gorm:"column:id;primaryKey" json:"id"`
+	FileID           uuid.UUID  `gorm:"column:file_id;not null;index" json:"file_id"`
+	CreatedBy        uuid.UUID  `gorm:"column:created_by;not null" json:"created_by"`
+	TokenHash        string     `gorm:"column:token_hash;not null;uniqueIndex" json:"-"`
+	PasswordHash     *string    `gorm:"column:password_hash" json:"-"`
+	ExpiresAt        *time.Time `gorm:"column:expires_at" json:"expires_at"`
+	MaxDownloads     *int       `gorm:"column:max_downloads" json:"max_downloads"`
+	DownloadCount    int        `gorm:"column:download_count;not null" json:"download_count"`
+	LastDownloadedAt *time.Time `gorm:"column:last_downloaded_at" json:"last_downloaded_at"`
+	RevokedAt        *time.Time `gorm:"column:revoked_at" json:"revoked_at"`
+	CreatedAt        time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	// Consecutive wrong passwords, and the time until which no password is checked after too many
+	FailedPasswordAttempts int        `gorm:"column:failed_password_attempts;not null" json:"-"`
+	PasswordLockedUntil    *time.Time `gorm:"column:password_locked_until" json:"-"`
+}
+
+func (FileShare) TableName() string {
+	return "authentication-app.file_shares"
+}
+
+// Active reports whether the share is neither revoked nor expired
+func (s *FileShare) Active(now time.Time) bool {
+	if s.RevokedAt != nil {
+		return false
+	}
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+// Usable reports whether the share still grants downloads: not revoked, not expired and not out
+// of downloads
+func (s *FileShare) Usable(now time.Time) bool {
+	return s.Active(now) && (s.MaxDownloads == nil || s.DownloadCount < *s.MaxDownloads)
+}
@@ -4,23 +4,60 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Malware scan verdicts. Pending files have not been scanned, because scanning is disabled or
+// they predate it; error means the scanner could not reach a verdict and the scan is retried.
+// Infected files are quarantined and cannot be downloaded.
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+	ScanStatusError    = "error"
 )
 
 type FileUpload struct {
-	ID           uuid.UUID  `gorm:"column:id;primaryKey" json:"id"`
-	UserID       uuid.UUID  `gorm:"column:user_id;not null;index" json:"user_id"`
-	User         User       `gorm:"foreignKey:UserID" json:"user"`
-	Filename     string     `gorm:"column:filename;not null" json:"filename"`
-	OriginalName string     `gorm:"column:original_name;not null" json:"original_name"`
-	ContentType  string     `gorm:"column:content_type;not null" json:"content_type"`
-	Size         int64      `gorm:"column:size;not null" json:"size"`
-	FilePath     string     `gorm:"column:file_path;not null" json:"file_path"`
-	UserAgent    string     `gorm:"column:user_agent" json:"user_agent"`
-	IPAddress    string     `gorm:"column:ip_address" json:"ip_address"`
-	CreatedAt    time.Time  `gorm:"column:created_at;not null" json:"created_at"`
-	UpdatedAt    *time.Time `gorm:"column:updated_at" json:"updated_at"`
+	ID             uuid.UUID      `gorm:"column:id;primaryKey" json:"id"`
+	UserID         uuid.UUID      `gorm:"column:user_id;not null;index" json:"user_id"`
+	User           User           `gorm:"foreignKey:UserID" json:"user"`
+	OrganizationID *uuid.UUID     `gorm:"column:organization_id;index" json:"organization_id"`
+	FolderID       *uuid.UUID     `gorm:"column:folder_id;index" json:"folder_id"`
+	Filename       string         `gorm:"column:filename;not null" json:"filename"`
+	OriginalName   string         `gorm:"column:original_name;not null" json:"original_name"`
+	ContentType    string         `gorm:"column:content_type;not null" json:"content_type"`
+	Size           int64          `gorm:"column:size;not null" json:"size"`
+	Width          *int           `gorm:"column:width" json:"width"`
+	Height         *int           `gorm:"column:height" json:"height"`
+	StorageBackend string         `gorm:"column:storage_backend;not null" json:"storage_backend"`
+	StorageKey     string         `gorm:"column:storage_key;not null" json:"storage_key"`
+	SHA256         *string        `gorm:"column:sha256;index" json:"sha256"`
+	Version        int            `gorm:"column:version;not null;default:1" json:"version"`
+	ScanStatus     string         `gorm:"column:scan_status;not null;default:pending" json:"scan_status"`
+	ScanSignature  *string        `gorm:"column:scan_signature" json:"scan_signature"`
+	ScannedAt      *time.Time     `gorm:"column:scanned_at" json:"scanned_at"`
+	Tags           Tags           `gorm:"column:tags;type:jsonb;not null" json:"tags"`
+	Metadata       Metadata       `gorm:"column:metadata;type:jsonb;not null" json:"metadata"`
+	UserAgent      string         `gorm:"column:user_agent" json:"user_agent"`
+	IPAddress      string         `gorm:"column:ip_address" json:"ip_address"`
+	CreatedAt      time.Time      `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt      *time.Time     `gorm:"column:updated_at" json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deleted_at"`
+	Variants       []FileVariant  `gorm:"foreignKey:FileID" json:"variants,omitempty"`
 }
 
 func (FileUpload) TableName() string {
 	return "authentication-app.file_uploads"
 }
+
+// FilesInTenant scopes file queries to a single tenant: the organization's shared files when an
+// organization is active, otherwise the user's personal files. Personal files never leak into an
+// organization and one organization never sees another's files.
+func FilesInTenant(userID uuid.UUID, orgID uuid.UUID) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if orgID != uuid.Nil {
+			return db.Where("file_uploads.organization_id = ?", orgID)
+		}
+		return db.Where("file_uploads.user_id = ? AND file_uploads.organization_id IS NULL", userID)
+	}
+}
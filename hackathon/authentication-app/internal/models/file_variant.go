@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileVariant is an image derived from an upload, such as a thumbnail. Variants have their own
+// object and are deleted together with their file.
+type FileVariant struct {
+	ID             uuid.UUID `gorm:"column:id;primaryKey" json:"id"`
+	FileID         uuid.UUID `gorm:"column:file_id;not null" json:"file_id"`
+	Name           string    `gorm:"column:name;not null" json:"name"`
+	ContentType    string    `gorm:"column:content_type;not null" json:"content_type"`
+	Width          int       `gorm:"column:width;not null" json:"width"`
+	Height         int       `gorm:"column:height;not null" json:"height"`
+	Size           int64     `gorm:"column:size;not null" json:"size"`
+	StorageBackend string    `gorm:"column:storage_backend;not null" json:"storage_backend"`
+	StorageKey     string    `gorm:"column:storage_key;not null" json:"storage_key"`
+	CreatedAt      time.Time `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (FileVariant) TableName() string {
+	return "authentication-app.file_variants"
+}
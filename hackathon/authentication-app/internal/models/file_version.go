@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileVersion is one revision of a file's content. The file row mirrors its current version;
+// infected versions are kept in quarantine for review but never become current.
+type FileVersion struct {
+	ID             uuid.UUID  `gorm:"column:id;primaryKey" json:"id"`
+	FileID         uuid.UUID  `gorm:"column:file_id;not null;uniqueIndex:idx_file_versions_file_version" json:"file_id"`
+	Version        int        `gorm:"column:version;not null;uniqueIndex:idx_file_versions_file_version" json:"version"`
+	OriginalName   string     `gorm:"column:original_name;not null" json:"original_name"`
+	ContentType    string     `gorm:"column:content_type;not null" json:"content_type"`
+	Size           int64      `gorm:"column:size;not null" json:"size"`
+	Width          *int       `gorm:"column:width" json:"width"`
+	Height         *int       `gorm:"column:height" json:"height"`
+	StorageBackend string     `gorm:"column:storage_backend;not null" json:"storage_backend"`
+	StorageKey     string     `gorm:"column:storage_key;not null" json:"storage_key"`
+	SHA256         *string    `gorm:"column:sha256" json:"sha256"`
+	ScanStatus     string     `gorm:"column:scan_status;not null;default:pending" json:"scan_status"`
+	ScanSignature  *string    `gorm:"column:scan_signature" json:"scan_signature"`
+	ScannedAt      *time.Time `gorm:"column:scanned_at" json:"scanned_at"`
+	UploadedBy     *uuid.UUID `gorm:"column:uploaded_by;index" json:"uploaded_by"`
+	Uploader       *User      `gorm:"foreignKey:UploadedBy" json:"-"`
+	CreatedAt      time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (FileVersion) TableName() string {
+	return "authentication-app.file_versions"
+}
+
+// Promote makes the version the file's current content
+func (v *FileVersion) Promote(file *FileUpload) {
+	file.Version = v.Version
+	file.OriginalName = v.OriginalName
+	file.ContentType = v.ContentType
+	file.Size = v.Size
+	file.Width = v.Width
+	file.Height = v.Height
+	file.StorageBackend = v.StorageBackend
+	file.StorageKey = v.StorageKey
+	file.SHA256 = v.SHA256
+	file.ScanStatus = v.ScanStatus
+	file.ScanSignature = v.ScanSignature
+	file.ScannedAt = v.ScannedAt
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Folder organises files of one tenant into a hierarchy. Top-level folders have no parent.
+type Folder struct {
+	ID             uuid.UUID      `gorm:"column:id;primaryKey" json:"id"`
+	UserID         uuid.UUID      `gorm:"column:user_id;not null;index" json:"user_id"`
+	OrganizationID *uuid.UUID     `gorm:"column:organization_id;index" json:"organization_id"`
+	ParentID       *uuid.UUID     `gorm:"column:parent_id;index" json:"parent_id"`
+	Name           string         `gorm:"column:name;not null" json:"name"`
+	CreatedAt      time.Time      `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt      *time.Time     `gorm:"column:updated_at" json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deleted_at"`
+}
+
+func (Folder) TableName() string {
+	return "authentication-app.folders"
+}
+
+// FoldersInTenant scopes folder queries to a single tenant, like FilesInTenant
+func FoldersInTenant(userID uuid.UUID, orgID uuid.UUID) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if orgID != uuid.Nil {
+			return db.Where("folders.organization_id = ?", orgID)
+		}
+		return db.Where("folders.user_id = ? AND folders.organization_id IS NULL", userID)
+	}
+}
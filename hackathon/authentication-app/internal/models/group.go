@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Group struct {
+	ID          uuid.UUID  `gorm:"column:id;primaryKey" json:"id"`
+	DisplayName string     `gorm:"column:display_name;uniqueIndex;not null" json:"display_name"`
+	ExternalID  *string    `gorm:"column:external_id" json:"external_id"`
+	CreatedAt   time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt   *time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Group) TableName() string {
+	return "authentication-app.groups"
+}
+
+type GroupMember struct {
+	GroupID   uuid.UUID `gorm:"column:group_id;primaryKey" json:"group_id"`
+	Group     Group     `gorm:"foreignKey:GroupID" json:"-"`
+	UserID    uuid.UUID `gorm:"column:user_id;primaryKey" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"-"`
+	CreatedAt time.Time `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (GroupMember) TableName() string {
+	return "authentication-app.group_members"
+}
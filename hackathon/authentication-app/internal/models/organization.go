@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+
+	InvitationStatusPending   = "pending"
+	InvitationStatusAccepted  = "accepted"
+	InvitationStatusDeclined  = "declined"
+	InvitationStatusCancelled = "cancelled"
+)
+
+// OrgRoleRank orders organization roles so that permissions can be compared; unknown roles rank lowest
+func OrgRoleRank(role string) int {
+	switch role {
+	case OrgRoleOwner:
+		return 3
+	case OrgRoleAdmin:
+		return 2
+	case OrgRoleMember:
+		return 1
+	}
+	return 0
+}
+
+type Organization struct {
+	ID        uuid.UUID  `gorm:"column:id;primaryKey" json:"id"`
+	Name      string     `gorm:"column:name;not null" json:"name"`
+	CreatedBy *uuid.UUID `gorm:"column:created_by" json:"created_by"`
+	CreatedAt time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt *time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Organization) TableName() string {
+	return "authentication-app.organizations"
+}
+
+type OrganizationMembership struct {
+	ID             uuid.UUID    `gorm:"column:id;primaryKey" json:"id"`
+	OrganizationID uuid.UUID    `gorm:"column:organization_id;not null;index" json:"organization_id"`
+	Organization   Organization `gorm:"foreignKey:OrganizationID" json:"-"`
+	UserID         uuid.UUID    `gorm:"column:user_id;not null;index" json:"user_id"`
+	User           User         `gorm:"foreignKey:UserID" json:"-"`
+	Role           string       `gorm:"column:role;not null" json:"role"`
+	CreatedAt      time.Time    `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt      *time.Time   `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (OrganizationMembership) TableName() string {
+	return "authentication-app.organization_memberships"
+}
+
+type OrganizationInvitation struct {
+	ID             uuid.UUID    `gorm:"column:id;primaryKey" json:"id"`
+	OrganizationID uuid.UUID    `gorm:"column:organization_id;not null;index" json:"organization_id"`
+	Organization   Organization `gorm:"foreignKey:OrganizationID" json:"-"`
+	UserID         uuid.UUID    `gorm:"column:user_id;not null;index" json:"user_id"`
+	User           User         `gorm:"foreignKey:UserID" json:"-"`
+	InvitedBy      *uuid.UUID   `gorm:"column:invited_by" json:"invited_by"`
+	Role           string       `gorm:"column:role;not null" json:"role"`
+	Status         string       `gorm:"column:status;not null" json:"status"`
+	CreatedAt      time.Time    `gorm:"column:created_at;not null" json:"created_at"`
+	RespondedAt    *time.Time   `gorm:"column:responded_at" json:"responded_at"`
+}
+
+func (OrganizationInvitation) TableName() string {
+	return "authentication-app.organization_invitations"
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TusUpload is a resumable upload in progress. Its bytes are stored as parts until Offset reaches
+// Length; the upload then becomes a FileUpload and FileID is set.
+type TusUpload struct {
+	ID             uuid.UUID  `gorm:"column:id;primaryKey" json:"id"`
+	UserID         uuid.UUID  `gorm:"column:user_id;not null;index" json:"user_id"`
+	OrganizationID *uuid.UUID `gorm:"column:organization_id" json:"organization_id"`
+	FolderID       *uuid.UUID `gorm:"column:folder_id" json:"folder_id"`
+	Length         int64      `gorm:"column:length;not null" json:"length"`
+	Offset         int64      `gorm:"column:upload_offset;not null" json:"offset"`
+	Metadata       string     `gorm:"column:metadata;not null" json:"metadata"`
+	Filename       string     `gorm:"column:filename;not null" json:"filename"`
+	ContentType    string     `gorm:"column:content_type;not null" json:"content_type"`
+	FileID         *uuid.UUID `gorm:"column:file_id" json:"file_id"`
+	ExpiresAt      time.Time  `gorm:"column:expires_at;not null;index" json:"expires_at"`
+	CreatedAt      time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt      *time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (TusUpload) TableName() string {
+	return "authentication-app.tus_uploads"
+}
+
+// Completed reports whether the upload has been turned into a file
+func (u *TusUpload) Completed() bool {
+	return u.FileID != nil
+}
+
+// TusUploadPart is one stored chunk of a resumable upload, starting at Offset
+type TusUploadPart struct {
+	UploadID       uuid.UUID `gorm:"column:upload_id;primaryKey" json:"upload_id"`
+	Offset         int64     `gorm:"column:upload_offset;primaryKey" json:"offset"`
+	Size           int64     `gorm:"column:size;not null" json:"size"`
+	StorageBackend string    `gorm:"column:storage_backend;not null" json:"storage_backend"`
+	StorageKey     string    `gorm:"column:storage_key;not null" json:"storage_key"`
+	CreatedAt      time.Time `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (TusUploadPart) TableName() string {
+	return "authentication-app.tus_upload_parts"
+}
@@ -6,12 +6,26 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+
+	RoleUser = "user"
+)
+
 type User struct {
-	ID           uuid.UUID  `gorm:"column:id;primaryKey;type:uuid" json:"id"`
-	Username     string     `gorm:"column:username;uniqueIndex;not null" json:"username"`
-	PasswordHash string     `gorm:"column:password_hash;not null" json:"password_hash"`
-	CreatedAt    time.Time  `gorm:"column:created_at;not null" json:"created_at"`
-	UpdatedAt    *time.Time `gorm:"column:updated_at;not null" json:"updated_at"`
+	ID               uuid.UUID  `gorm:"column:id;primaryKey;type:uuid" json:"id"`
+	Username         string     `gorm:"column:username;uniqueIndex;not null" json:"username"`
+	PasswordHash     string     `gorm:"column:password_hash;not null" json:"password_hash"`
+	AuthSource       string     `gorm:"column:auth_source;not null" json:"auth_source"`
+	Role             string     `gorm:"column:role;not null" json:"role"`
+	Active           bool       `gorm:"column:active;not null" json:"active"`
+	ExternalID       *string    `gorm:"column:external_id" json:"external_id"`
+	DisplayName      string     `gorm:"column:display_name" json:"display_name"`
+	Email            string     `gorm:"column:email" json:"email"`
+	TokensValidAfter *time.Time `gorm:"column:tokens_valid_after" json:"tokens_valid_after"`
+	CreatedAt        time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	UpdatedAt        *time.Time `gorm:"column:updated_at;not null" json:"updated_at"`
 }
 
 func (User) TableName() string {
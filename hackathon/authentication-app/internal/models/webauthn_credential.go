@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebAuthnCredential struct {
+	ID              uuid.UUID  `gorm:"column:id;primaryKey" json:"id"`
+	UserID          uuid.UUID  `gorm:"column:user_id;not null;index" json:"user_id"`
+	Name            string     `gorm:"column:name;not null" json:"name"`
+	CredentialID    []byte     `gorm:"column:credential_id;not null;uniqueIndex" json:"-"`
+	PublicKey       []byte     `gorm:"column:public_key;not null" json:"-"`
+	AttestationType string     `gorm:"column:attestation_type;not null" json:"attestation_type"`
+	Transports      string     `gorm:"column:transports;not null" json:"transports"`
+	AAGUID          []byte     `gorm:"column:aaguid" json:"-"`
+	SignCount       uint32     `gorm:"column:sign_count;not null" json:"sign_count"`
+	CloneWarning    bool       `gorm:"column:clone_warning;not null" json:"clone_warning"`
+	UserPresent     bool       `gorm:"column:user_present;not null" json:"user_present"`
+	UserVerified    bool       `gorm:"column:user_verified;not null" json:"user_verified"`
+	BackupEligible  bool       `gorm:"column:backup_eligible;not null" json:"backup_eligible"`
+	BackupState     bool       `gorm:"column:backup_state;not null" json:"backup_state"`
+	CreatedAt       time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+	LastUsedAt      *time.Time `gorm:"column:last_used_at" json:"last_used_at"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "authentication-app.webauthn_credentials"
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+type WebAuthnSession struct {
+	ID        uuid.UUID  `gorm:"column:id;primaryKey" json:"id"`
+	UserID    *uuid.UUID `gorm:"column:user_id" json:"user_id"`
+	Ceremony  string     `gorm:"column:ceremony;not null" json:"ceremony"`
+	Name      string     `gorm:"column:name;not null" json:"name"`
+	Data      []byte     `gorm:"column:data;type:jsonb;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"column:expires_at;not null" json:"expires_at"`
+	CreatedAt time.Time  `gorm:"column:created_at;not null" json:"created_at"`
+}
+
+func (WebAuthnSession) TableName() string {
+	return "authentication-app.webauthn_sessions"
+}
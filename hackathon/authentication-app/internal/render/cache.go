@@ -0,0 +1,179 @@
+package render
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	golog "github.com/luongwnv/go-log"
+)
+
+// Entries are written under this prefix and renamed into place once complete
+const cacheTempPrefix = ".render-"
+
+// Cache keeps rendered images as files below a directory, named after their key. Reading an entry
+// marks it as used; once the cache outgrows its limit, the least recently used entries are
+// removed. The size it tracks is an estimate that every trim corrects.
+type Cache struct {
+	logger   golog.Logger
+	root     string
+	maxBytes int64
+
+	mu       sync.Mutex
+	size     int64
+	trimming bool
+}
+
+// NewCache opens the cache at root, taking over what earlier runs left there. A maxBytes of zero
+// keeps every entry.
+func NewCache(logger golog.Logger, root string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		logger:   logger,
+		root:     root,
+		maxBytes: maxBytes,
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		// Leftovers of an interrupted write
+		if strings.HasPrefix(d.Name(), cacheTempPrefix) {
+			return os.Remove(path)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		c.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Open opens an entry and marks it as used. A miss returns an error matching fs.ErrNotExist.
+func (c *Cache) Open(key string) (*os.File, int64, error) {
+	path := c.path(key)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		c.logger.Warnf("Failed to mark render %s as used: %v", key, err)
+	}
+	return file, info.Size(), nil
+}
+
+// Put stores an entry. It is written next to its final name and renamed, so readers never see
+// part of it.
+func (c *Cache) Put(key string, data []byte) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), cacheTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.size += int64(len(data))
+	trim := c.maxBytes > 0 && c.size > c.maxBytes && !c.trimming
+	if trim {
+		c.trimming = true
+	}
+	c.mu.Unlock()
+
+	if trim {
+		go c.trim()
+	}
+	return nil
+}
+
+// trim removes the least recently used entries until the cache is back under 90% of its limit,
+// leaving room before the next trim
+func (c *Cache) trim() {
+	type entry struct {
+		path string
+		size int64
+		used time.Time
+	}
+
+	var entries []entry
+	var total int64
+	err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), cacheTempPrefix) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			// Removed by a concurrent write of the same key
+			return nil
+		}
+		entries = append(entries, entry{path: path, size: info.Size(), used: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		c.logger.Errorf("Failed to list render cache: %v", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].used.Before(entries[j].used)
+	})
+	target := c.maxBytes * 9 / 10
+	removed := 0
+	for _, entry := range entries {
+		if total <= target {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			c.logger.Errorf("Failed to remove render %s: %v", entry.path, err)
+			continue
+		}
+		total -= entry.size
+		removed++
+	}
+	if removed > 0 {
+		c.logger.Infof("Removed %d renders from the cache", removed)
+	}
+
+	c.mu.Lock()
+	c.size = total
+	c.trimming = false
+	c.mu.Unlock()
+}
+
+// path shards entries by the first byte of their key, like blobs
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.root, key[:2], key)
+}
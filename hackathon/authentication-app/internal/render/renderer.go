@@ -0,0 +1,240 @@
+package render
+
+import (
+	"authentication-app/config"
+	"authentication-app/internal/models"
+	"authentication-app/pkg/imaging"
+	"authentication-app/pkg/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	golog "github.com/luongwnv/go-log"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrUndecodable is returned for stored content that is not a valid image
+var ErrUndecodable = errors.New("render: image cannot be decoded")
+
+// Options describe a render. They only hold values ParseOptions accepted, so every distinct
+// render is one of a bounded set per image.
+type Options struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+}
+
+// ContentType is the type of the rendered image
+func (o Options) ContentType() string {
+	return "image/" + o.Format
+}
+
+// Renderer resizes, crops and converts stored images on request and caches the results on disk
+type Renderer struct {
+	logger    golog.Logger
+	storage   *storage.Registry
+	cache     *Cache
+	sizes     []int
+	qualities []int
+	maxPixels int64
+	slots     chan struct{}
+	inflight  singleflight.Group
+}
+
+func NewRenderer(cfg *config.Config, logger golog.Logger, storage *storage.Registry) (*Renderer, error) {
+	sizes, err := parseAllowList(cfg.RenderSizes, 1<<14)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RENDER_SIZES: %w", err)
+	}
+	qualities, err := parseAllowList(cfg.RenderQualities, 100)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RENDER_QUALITIES: %w", err)
+	}
+	cache, err := NewCache(logger, cfg.RenderCacheDir, cfg.RenderCacheMaxMB*1024*1024)
+	if err != nil {
+		return nil, fmt.Errorf("open render cache: %w", err)
+	}
+
+	return &Renderer{
+		logger:    logger,
+		storage:   storage,
+		cache:     cache,
+		sizes:     sizes,
+		qualities: qualities,
+		maxPixels: cfg.ImageMaxPixels,
+		slots:     make(chan struct{}, max(cfg.RenderConcurrency, 1)),
+	}, nil
+}
+
+// ParseOptions reads the query parameters of a render of content of the given type. Its errors
+// are safe to show to the client.
+func (r *Renderer) ParseOptions(width, height, fit, format, quality string, contentType string) (Options, error) {
+	var opts Options
+	var err error
+	if opts.Width, err = r.parseSize("w", width); err != nil {
+		return opts, err
+	}
+	if opts.Height, err = r.parseSize("h", height); err != nil {
+		return opts, err
+	}
+	if opts.Width == 0 && opts.Height == 0 {
+		return opts, errors.New("w or h is required")
+	}
+
+	opts.Fit = strings.ToLower(fit)
+	switch opts.Fit {
+	case "":
+		opts.Fit = imaging.FitContain
+	case imaging.FitContain:
+	case imaging.FitCover, imaging.FitFill:
+		if opts.Width == 0 || opts.Height == 0 {
+			return opts, fmt.Errorf("fit=%s needs both w and h", opts.Fit)
+		}
+	default:
+		return opts, errors.New("fit must be contain, cover or fill")
+	}
+
+	opts.Format = strings.ToLower(format)
+	switch opts.Format {
+	case "":
+		opts.Format = imaging.OutputFormat(imaging.Variant{}, imaging.FormatOf(contentType))
+	case "jpg":
+		opts.Format = imaging.FormatJPEG
+	case imaging.FormatJPEG, imaging.FormatPNG, imaging.FormatWebP:
+	default:
+		return opts, errors.New("format must be jpeg, png or webp")
+	}
+
+	// Quality only means something for JPEG; leaving it out elsewhere keeps one cache entry per render
+	if quality != "" && opts.Format == imaging.FormatJPEG {
+		q, err := strconv.Atoi(quality)
+		if err != nil || !allowed(r.qualities, q) {
+			return opts, fmt.Errorf("q must be one of %s", joinInts(r.qualities))
+		}
+		opts.Quality = q
+	}
+	return opts, nil
+}
+
+func (r *Renderer) parseSize(name, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || !allowed(r.sizes, size) {
+		return 0, fmt.Errorf("%s must be one of %s", name, joinInts(r.sizes))
+	}
+	return size, nil
+}
+
+// Key identifies a render of a file's current content. Deduplicated files share their renders,
+// and a new version gets new ones.
+func (r *Renderer) Key(file *models.FileUpload, opts Options) string {
+	content := file.StorageBackend + "/" + file.StorageKey
+	if file.SHA256 != nil {
+		content = *file.SHA256
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%d\n%s\n%s\n%d", content, opts.Width, opts.Height, opts.Fit, opts.Format, opts.Quality)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Render returns a render of the file, from the cache when it was made before. Concurrent
+// requests for the same render share one rendering.
+func (r *Renderer) Render(ctx context.Context, file *models.FileUpload, opts Options) (io.ReadCloser, int64, error) {
+	key := r.Key(file, opts)
+	cached, size, err := r.cache.Open(key)
+	if err == nil {
+		return cached, size, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		r.logger.Errorf("Failed to read render %s from the cache: %v", key, err)
+	}
+
+	// The rendering is shared, so it must outlive the request that happened to start it
+	data, err, _ := r.inflight.Do(key, func() (interface{}, error) {
+		return r.render(context.WithoutCancel(ctx), file, opts, key)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	rendered := data.([]byte)
+	return io.NopCloser(bytes.NewReader(rendered)), int64(len(rendered)), nil
+}
+
+func (r *Renderer) render(ctx context.Context, file *models.FileUpload, opts Options, key string) ([]byte, error) {
+	// Decoding and scaling are heavy on CPU and memory, so only a few renders run at once
+	r.slots <- struct{}{}
+	defer func() { <-r.slots }()
+
+	backend, err := r.storage.Backend(file.StorageBackend)
+	if err != nil {
+		return nil, err
+	}
+	src, err := backend.Get(ctx, file.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	img, _, err := imaging.Decode(src, r.maxPixels)
+	if errors.Is(err, imaging.ErrTooLarge) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUndecodable, err)
+	}
+	var buf bytes.Buffer
+	if _, err := imaging.EncodeQuality(&buf, imaging.Resize(img, opts.Width, opts.Height, opts.Fit), opts.Format, opts.Quality); err != nil {
+		return nil, err
+	}
+
+	// A render that cannot be cached is still served
+	if err := r.cache.Put(key, buf.Bytes()); err != nil {
+		r.logger.Errorf("Failed to cache render %s: %v", key, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseAllowList reads comma-separated positive integers up to limit
+func parseAllowList(value string, limit int) ([]int, error) {
+	var list []int
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		n, err := strconv.Atoi(entry)
+		if err != nil || n <= 0 || n > limit {
+			return nil, fmt.Errorf("%q is not a number between 1 and %d", entry, limit)
+		}
+		list = append(list, n)
+	}
+	if len(list) == 0 {
+		return nil, errors.New("at least one value is required")
+	}
+	sort.Ints(list)
+	return list, nil
+}
+
+func allowed(list []int, n int) bool {
+	i := sort.SearchInts(list, n)
+	return i < len(list) && list[i] == n
+}
+
+func joinInts(list []int) string {
+	values := make([]string, len(list))
+	for i, n := range list {
+		values[i] = strconv.Itoa(n)
+	}
+	return strings.Join(values, ", ")
+}
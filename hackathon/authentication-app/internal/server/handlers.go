@@ -1,8 +1,11 @@
 package server
 
 import (
+	"authentication-app/internal/authenticator"
 	"authentication-app/internal/controllers"
 	"authentication-app/internal/middleware"
+	"authentication-app/pkg/presign"
+	"authentication-app/pkg/utils"
 	"fmt"
 	"time"
 
@@ -37,9 +40,10 @@ func (s *Server) MapHandlers() error {
 	})
 
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET, POST, PUT, PATCH, DELETE, OPTIONS",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowOrigins:  "*",
+		AllowMethods:  "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-CSRF-Token, X-Session-Mode, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Upload-Defer-Length, X-Share-Password",
+		ExposeHeaders: "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires, X-File-Id",
 	}))
 
 	app.Use(func(c *fiber.Ctx) error {
@@ -80,12 +84,14 @@ func (s *Server) MapHandlers() error {
 						<input type="password" id="password" placeholder="Password" required>
 						<button onclick="login()">Login</button>
 						<button onclick="register()">Register</button>
+						<button onclick="loginWithPasskey()">Sign in with a passkey</button>
 					</div>
 					
 					<div id="uploadForm" class="hidden">
 						<h3>Upload File</h3>
 						<input type="file" id="fileInput">
 						<button onclick="uploadFile()">Upload</button>
+						<button onclick="registerPasskey()">Add a passkey</button>
 						<button onclick="logout()">Logout</button>
 					</div>
 					
@@ -93,10 +99,26 @@ func (s *Server) MapHandlers() error {
 				</div>
 
 				<script>
-					let token = localStorage.getItem('authToken');
-					
-					if (token) {
-						showUploadForm();
+					// The session token lives in an HttpOnly cookie; only the CSRF token is visible to scripts
+					let csrfToken = null;
+
+					checkSession();
+
+					async function checkSession() {
+						try {
+							const response = await fetch('/auth/me');
+							if (response.ok) {
+								const data = await response.json();
+								csrfToken = data.csrf_token;
+								showUploadForm();
+							}
+						} catch (error) {
+							showLoginForm();
+						}
+					}
+
+					function sessionHeaders(headers = {}) {
+						return Object.assign({ 'X-CSRF-Token': csrfToken || '' }, headers);
 					}
 
 					function showMessage(msg, isError = false) {
@@ -122,14 +144,13 @@ func (s *Server) MapHandlers() error {
 						try {
 							const response = await fetch('/auth/register', {
 								method: 'POST',
-								headers: { 'Content-Type': 'application/json' },
+								headers: { 'Content-Type': 'application/json', 'X-Session-Mode': 'cookie' },
 								body: JSON.stringify({ username, password })
 							});
 
 							const data = await response.json();
 							if (response.ok) {
-								localStorage.setItem('authToken', data.token);
-								token = data.token;
+								csrfToken = data.csrf_token;
 								showUploadForm();
 								showMessage('Registration successful!');
 							} else {
@@ -147,14 +168,13 @@ func (s *Server) MapHandlers() error {
 						try {
 							const response = await fetch('/auth/login', {
 								method: 'POST',
-								headers: { 'Content-Type': 'application/json' },
+								headers: { 'Content-Type': 'application/json', 'X-Session-Mode': 'cookie' },
 								body: JSON.stringify({ username, password })
 							});
 
 							const data = await response.json();
 							if (response.ok) {
-								localStorage.setItem('authToken', data.token);
-								token = data.token;
+								csrfToken = data.csrf_token;
 								showUploadForm();
 								showMessage('Login successful!');
 							} else {
@@ -180,7 +200,7 @@ func (s *Server) MapHandlers() error {
 						try {
 							const response = await fetch('/files/upload', {
 								method: 'POST',
-								headers: { 'Authorization': 'Bearer ' + token },
+								headers: sessionHeaders(),
 								body: formData
 							});
 
@@ -196,9 +216,139 @@ func (s *Server) MapHandlers() error {
 						}
 					}
 
-					function logout() {
-						localStorage.removeItem('authToken');
-						token = null;
+					function base64urlToBuffer(value) {
+						const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+						const padded = base64 + '='.repeat((4 - base64.length % 4) % 4);
+						return Uint8Array.from(atob(padded), c => c.charCodeAt(0)).buffer;
+					}
+
+					function bufferToBase64url(buffer) {
+						let binary = '';
+						new Uint8Array(buffer).forEach(b => binary += String.fromCharCode(b));
+						return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+					}
+
+					async function registerPasskey() {
+						if (!window.PublicKeyCredential) {
+							showMessage('Passkeys are not supported by this browser', true);
+							return;
+						}
+
+						try {
+							const beginResponse = await fetch('/auth/webauthn/register/begin', {
+								method: 'POST',
+								headers: sessionHeaders({ 'Content-Type': 'application/json' }),
+								body: JSON.stringify({})
+							});
+							const begin = await beginResponse.json();
+							if (!beginResponse.ok) {
+								showMessage(begin.error, true);
+								return;
+							}
+
+							const publicKey = begin.options.publicKey;
+							publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+							publicKey.user.id = base64urlToBuffer(publicKey.user.id);
+							(publicKey.excludeCredentials || []).forEach(c => c.id = base64urlToBuffer(c.id));
+
+							const credential = await navigator.credentials.create({ publicKey });
+
+							const finishResponse = await fetch('/auth/webauthn/register/finish', {
+								method: 'POST',
+								headers: sessionHeaders({ 'Content-Type': 'application/json' }),
+								body: JSON.stringify({
+									session_id: begin.session_id,
+									credential: {
+										id: credential.id,
+										rawId: bufferToBase64url(credential.rawId),
+										type: credential.type,
+										response: {
+											clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+											attestationObject: bufferToBase64url(credential.response.attestationObject),
+											transports: credential.response.getTransports ? credential.response.getTransports() : []
+										}
+									}
+								})
+							});
+							const finish = await finishResponse.json();
+							if (finishResponse.ok) {
+								showMessage('Passkey added!');
+							} else {
+								showMessage(finish.error, true);
+							}
+						} catch (error) {
+							showMessage('Passkey registration cancelled', true);
+						}
+					}
+
+					async function loginWithPasskey() {
+						if (!window.PublicKeyCredential) {
+							showMessage('Passkeys are not supported by this browser', true);
+							return;
+						}
+
+						const username = document.getElementById('username').value;
+
+						try {
+							const beginResponse = await fetch('/auth/webauthn/login/begin', {
+								method: 'POST',
+								headers: { 'Content-Type': 'application/json' },
+								body: JSON.stringify({ username })
+							});
+							const begin = await beginResponse.json();
+							if (!beginResponse.ok) {
+								showMessage(begin.error, true);
+								return;
+							}
+
+							const publicKey = begin.options.publicKey;
+							publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+							(publicKey.allowCredentials || []).forEach(c => c.id = base64urlToBuffer(c.id));
+
+							const assertion = await navigator.credentials.get({ publicKey });
+
+							const finishResponse = await fetch('/auth/webauthn/login/finish', {
+								method: 'POST',
+								headers: { 'Content-Type': 'application/json', 'X-Session-Mode': 'cookie' },
+								body: JSON.stringify({
+									session_id: begin.session_id,
+									credential: {
+										id: assertion.id,
+										rawId: bufferToBase64url(assertion.rawId),
+										type: assertion.type,
+										response: {
+											authenticatorData: bufferToBase64url(assertion.response.authenticatorData),
+											clientDataJSON: bufferToBase64url(assertion.response.clientDataJSON),
+											signature: bufferToBase64url(assertion.response.signature),
+											userHandle: assertion.response.userHandle ? bufferToBase64url(assertion.response.userHandle) : null
+										}
+									}
+								})
+							});
+							const data = await finishResponse.json();
+							if (finishResponse.ok) {
+								csrfToken = data.csrf_token;
+								showUploadForm();
+								showMessage('Login successful!');
+							} else {
+								showMessage(data.error, true);
+							}
+						} catch (error) {
+							showMessage('Passkey login cancelled', true);
+						}
+					}
+
+					async function logout() {
+						try {
+							await fetch('/auth/logout', {
+								method: 'POST',
+								headers: sessionHeaders()
+							});
+						} catch (error) {
+							// The cookie expires on its own if the server cannot be reached
+						}
+
+						csrfToken = null;
 						showLoginForm();
 						showMessage('Logged out successfully!');
 					}
@@ -214,18 +364,144 @@ func (s *Server) MapHandlers() error {
 	app.Get("/api/liveness", monitoringHandler.Liveness)
 
 	// Auth routes
-	authController := controllers.NewAuthController(s.cfg, s.logger, s.rdbIns)
+	authenticators, err := authenticator.NewFromConfig(s.cfg, s.logger, s.rdbIns)
+	if err != nil {
+		return err
+	}
+	authController := controllers.NewAuthController(s.cfg, s.logger, s.rdbIns, authenticators)
 	authGroup := app.Group("/auth")
 	authGroup.Post("/register", authController.Register)
 	authGroup.Post("/login", authController.Login)
 
 	jwtMiddleware := middleware.JWTAuth(s.cfg, s.rdbIns)
 	authGroup.Post("/revoke", jwtMiddleware, authController.RevokeToken)
+	authGroup.Post("/logout", jwtMiddleware, authController.Logout)
+	authGroup.Get("/me", jwtMiddleware, authController.Me)
+
+	// Passkey routes
+	webAuthnController, err := controllers.NewWebAuthnController(s.cfg, s.logger, s.rdbIns)
+	if err != nil {
+		return err
+	}
+	webAuthnGroup := authGroup.Group("/webauthn")
+	webAuthnGroup.Post("/register/begin", jwtMiddleware, webAuthnController.BeginRegistration)
+	webAuthnGroup.Post("/register/finish", jwtMiddleware, webAuthnController.FinishRegistration)
+	webAuthnGroup.Post("/login/begin", webAuthnController.BeginLogin)
+	webAuthnGroup.Post("/login/finish", webAuthnController.FinishLogin)
+	webAuthnGroup.Get("/credentials", jwtMiddleware, webAuthnController.ListCredentials)
+	webAuthnGroup.Delete("/credentials/:id", jwtMiddleware, webAuthnController.DeleteCredential)
+
+	// Resumable upload routes (tus 1.0), registered before /files/:id
+	tusController := controllers.NewTusController(s.logger, s.rdbIns, s.uploads, s.variants)
+	tusGroup := app.Group("/files/tus", tusController.Protocol)
+	tusGroup.Options("/", tusController.Options)
+	tusGroup.Post("/", jwtMiddleware, tusController.Create)
+	tusGroup.Head("/:id", jwtMiddleware, tusController.Head)
+	tusGroup.Patch("/:id", jwtMiddleware, tusController.Patch)
+	tusGroup.Delete("/:id", jwtMiddleware, tusController.Terminate)
 
 	// File upload routes
-	fileController := controllers.NewFileController(s.logger, s.rdbIns)
+	// Without a dedicated secret, presigned URLs are signed with a key derived from the JWT secret
+	presignSecret := s.cfg.PresignSecret
+	if presignSecret == "" {
+		presignSecret = utils.DeriveKey(s.cfg.JWTSecret, "presign")
+	}
+	signer := presign.NewSigner(presignSecret)
+	presignedMiddleware := middleware.PresignedAuth(s.rdbIns, signer, jwtMiddleware)
+	presignController := controllers.NewPresignController(s.cfg, s.logger, s.rdbIns, signer)
+
+	permissionController := controllers.NewPermissionController(s.logger, s.rdbIns)
+	searchController := controllers.NewSearchController(s.logger, s.rdbIns)
+	archiveController := controllers.NewArchiveController(s.cfg, s.logger, s.rdbIns, s.storage)
+	fileController := controllers.NewFileController(s.logger, s.rdbIns, s.storage, s.uploads, s.variants)
 	fileGroup := app.Group("/files")
-	fileGroup.Post("/upload", jwtMiddleware, fileController.UploadFile)
+	fileGroup.Post("/upload", presignedMiddleware, fileController.UploadFile)
+	fileGroup.Post("/upload/presign", jwtMiddleware, presignController.PresignUpload)
+	fileGroup.Get("/", jwtMiddleware, fileController.ListFiles)
+	fileGroup.Get("/trash", jwtMiddleware, fileController.ListTrash)
+	fileGroup.Get("/quota", jwtMiddleware, fileController.GetQuota)
+	fileGroup.Get("/shared-with-me", jwtMiddleware, permissionController.ListSharedWithMe)
+	fileGroup.Get("/search", jwtMiddleware, searchController.SearchFiles)
+	fileGroup.Post("/archive", jwtMiddleware, archiveController.CreateArchive)
+	fileGroup.Get("/:id", jwtMiddleware, fileController.GetFile)
+	fileGroup.Patch("/:id", jwtMiddleware, fileController.UpdateFile)
+	fileGroup.Delete("/:id", jwtMiddleware, fileController.DeleteFile)
+	fileGroup.Post("/:id/restore", jwtMiddleware, fileController.RestoreFile)
+	fileGroup.Post("/:id/move", jwtMiddleware, fileController.MoveFile)
+	fileGroup.Get("/:id/content", presignedMiddleware, fileController.DownloadFile)
+	fileGroup.Post("/:id/presign", jwtMiddleware, presignController.PresignDownload)
+
+	// Image rendering routes; sizes are limited to an allow-list and renders are cached on disk
+	renderController := controllers.NewRenderController(s.logger, s.rdbIns, s.renderer)
+	fileGroup.Get("/:id/render", jwtMiddleware, renderController.RenderFile)
+
+	// Version routes; uploading new content keeps the earlier content as history
+	versionController := controllers.NewVersionController(s.logger, s.rdbIns, s.storage, s.uploads, s.variants)
+	fileGroup.Put("/:id/content", jwtMiddleware, versionController.UploadVersion)
+	fileGroup.Get("/:id/versions", jwtMiddleware, versionController.ListVersions)
+	fileGroup.Get("/:id/versions/:version/content", jwtMiddleware, versionController.DownloadVersion)
+	fileGroup.Post("/:id/versions/:version/restore", jwtMiddleware, versionController.RestoreVersion)
+
+	// Per-user access to single files
+	fileGroup.Post("/:id/permissions", jwtMiddleware, permissionController.GrantPermission)
+	fileGroup.Get("/:id/permissions", jwtMiddleware, permissionController.ListPermissions)
+	fileGroup.Delete("/:id/permissions/:username", jwtMiddleware, permissionController.RevokePermission)
+
+	// Share link routes; downloads through a link need no login
+	// Share grants are signed with a key of their own, so they cannot pass for presigned URLs
+	shareController := controllers.NewShareController(s.logger, s.rdbIns, s.storage, presign.NewSigner(utils.DeriveKey(s.cfg.JWTSecret, "share-grant")))
+	fileGroup.Post("/:id/shares", jwtMiddleware, shareController.CreateShare)
+	fileGroup.Get("/:id/shares", jwtMiddleware, shareController.ListShares)
+	fileGroup.Delete("/:id/shares/:shareId", jwtMiddleware, shareController.RevokeShare)
+	app.Get("/s/:token", shareController.DownloadShare)
+
+	// Folder routes; "root" stands for the top level when listing children
+	folderController := controllers.NewFolderController(s.logger, s.rdbIns)
+	folderGroup := app.Group("/folders", jwtMiddleware)
+	folderGroup.Post("/", folderController.CreateFolder)
+	folderGroup.Get("/trash", folderController.ListTrash)
+	folderGroup.Get("/:id", folderController.GetFolder)
+	folderGroup.Get("/:id/children", folderController.ListChildren)
+	folderGroup.Patch("/:id", folderController.RenameFolder)
+	folderGroup.Post("/:id/move", folderController.MoveFolder)
+	folderGroup.Delete("/:id", folderController.DeleteFolder)
+	folderGroup.Post("/:id/restore", folderController.RestoreFolder)
+
+	// Organization routes
+	organizationController := controllers.NewOrganizationController(s.cfg, s.logger, s.rdbIns)
+	orgGroup := app.Group("/orgs", jwtMiddleware)
+	orgGroup.Post("/", organizationController.CreateOrganization)
+	orgGroup.Get("/", organizationController.ListOrganizations)
+	orgGroup.Post("/active", organizationController.SwitchOrganization)
+	orgGroup.Get("/invitations", organizationController.ListMyInvitations)
+	orgGroup.Post("/invitations/:invitationId/accept", organizationController.AcceptInvitation)
+	orgGroup.Post("/invitations/:invitationId/decline", organizationController.DeclineInvitation)
+	orgGroup.Get("/:id", organizationController.GetOrganization)
+	orgGroup.Get("/:id/members", organizationController.ListMembers)
+	orgGroup.Patch("/:id/members/:userId", organizationController.UpdateMember)
+	orgGroup.Delete("/:id/members/:userId", organizationController.RemoveMember)
+	orgGroup.Post("/:id/invitations", organizationController.InviteMember)
+	orgGroup.Get("/:id/invitations", organizationController.ListOrganizationInvitations)
+	orgGroup.Delete("/:id/invitations/:invitationId", organizationController.CancelInvitation)
+	orgGroup.Get("/:id/files", organizationController.ListOrganizationFiles)
+
+	// SCIM provisioning routes, only exposed when a provisioning token is configured
+	if s.cfg.SCIMBearerToken != "" {
+		scimController := controllers.NewSCIMController(s.cfg, s.logger, s.rdbIns)
+		scimGroup := app.Group("/scim/v2", middleware.SCIMAuth(s.cfg))
+		scimGroup.Get("/Users", scimController.ListUsers)
+		scimGroup.Post("/Users", scimController.CreateUser)
+		scimGroup.Get("/Users/:id", scimController.GetUser)
+		scimGroup.Put("/Users/:id", scimController.ReplaceUser)
+		scimGroup.Patch("/Users/:id", scimController.PatchUser)
+		scimGroup.Delete("/Users/:id", scimController.DeleteUser)
+		scimGroup.Get("/Groups", scimController.ListGroups)
+		scimGroup.Post("/Groups", scimController.CreateGroup)
+		scimGroup.Get("/Groups/:id", scimController.GetGroup)
+		scimGroup.Put("/Groups/:id", scimController.ReplaceGroup)
+		scimGroup.Patch("/Groups/:id", scimController.PatchGroup)
+		scimGroup.Delete("/Groups/:id", scimController.DeleteGroup)
+	}
 
 	golog.Info("Loaded all route!")
 
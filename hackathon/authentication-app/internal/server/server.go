@@ -2,9 +2,14 @@ package server
 
 import (
 	"authentication-app/config"
+	"authentication-app/internal/render"
+	"authentication-app/internal/upload"
+	"authentication-app/internal/workers"
+	"authentication-app/pkg/storage"
 	"encoding/json"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,10 +19,14 @@ import (
 )
 
 type Server struct {
-	fiber  *fiber.App
-	cfg    *config.Config
-	rdbIns *gorm.DB
-	logger golog.Logger
+	fiber    *fiber.App
+	cfg      *config.Config
+	rdbIns   *gorm.DB
+	logger   golog.Logger
+	storage  *storage.Registry
+	uploads  *upload.Service
+	variants *workers.VariantGenerator
+	renderer *render.Renderer
 }
 
 type Option func(*Server)
@@ -28,18 +37,50 @@ func Logger(logger golog.Logger) Option {
 	}
 }
 
+func Storage(registry *storage.Registry) Option {
+	return func(s *Server) {
+		s.storage = registry
+	}
+}
+
+func Uploads(service *upload.Service) Option {
+	return func(s *Server) {
+		s.uploads = service
+	}
+}
+
+func Variants(generator *workers.VariantGenerator) Option {
+	return func(s *Server) {
+		s.variants = generator
+	}
+}
+
+func Renderer(renderer *render.Renderer) Option {
+	return func(s *Server) {
+		s.renderer = renderer
+	}
+}
+
 func NewServer(cfg *config.Config, rdb *gorm.DB, opts ...Option) *Server {
 	s := &Server{
 		fiber: fiber.New(fiber.Config{
 			JSONEncoder:       json.Marshal,
 			JSONDecoder:       json.Unmarshal,
 			StreamRequestBody: true,
+			// Uploads parse their multipart body as it arrives; parsing it up front would spool
+			// every file to a temporary file before the handler runs
+			DisablePreParseMultipartForm: true,
 		}),
 		cfg:    cfg,
 		rdbIns: rdb,
 	}
 
 	s.fiber.Use(etag.New(etag.Config{
+		// Downloads set their own strong ETag from the content and handle conditional requests
+		// themselves, and archives are streamed; hashing them here would buffer the whole stream
+		Next: func(c *fiber.Ctx) bool {
+			return streamedRoute(c.Path())
+		},
 		Weak: true,
 	}))
 
@@ -50,6 +91,13 @@ func NewServer(cfg *config.Config, rdb *gorm.DB, opts ...Option) *Server {
 	return s
 }
 
+// streamedRoute reports whether a path answers with a stream rather than a buffered body
+func streamedRoute(path string) bool {
+	return strings.HasPrefix(path, "/s/") ||
+		path == "/files/archive" ||
+		strings.HasPrefix(path, "/files/") && (strings.HasSuffix(path, "/content") || strings.HasSuffix(path, "/render"))
+}
+
 func (s *Server) Run() error {
 	if err := s.MapHandlers(); err != nil {
 		return err
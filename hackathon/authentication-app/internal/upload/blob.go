@@ -0,0 +1,204 @@
+package upload
+
+import (
+	"authentication-app/internal/models"
+	"authentication-app/pkg/storage"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Objects are staged under a unique key while they are hashed, then moved to their blob key
+const (
+	stagingPrefix = "staging/"
+	blobPrefix    = "blobs/"
+)
+
+// blobKey shards blobs by the first byte of their hash to keep directories small
+func blobKey(sum string) string {
+	return blobPrefix + sum[:2] + "/" + sum
+}
+
+// blobRef is the location of a blob after a reference to it was taken
+type blobRef struct {
+	StorageBackend string
+	StorageKey     string
+	Created        bool
+}
+
+// lockBlob serializes everything that creates a blob or deletes its object, until tx ends. The
+// blob row alone cannot, as it does not exist before the first upload or after the last release.
+func lockBlob(tx *gorm.DB, sum string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", "blob:"+sum).Error
+}
+
+// acquireBlob takes a reference to the blob with the given hash, registering a new blob at its key
+// in backend when none exists yet. The blob row stays locked until tx ends, which serializes
+// concurrent uploads and releases of the same content.
+func acquireBlob(tx *gorm.DB, backend storage.Storage, sum string, size int64) (blobRef, error) {
+	if err := lockBlob(tx, sum); err != nil {
+		return blobRef{}, err
+	}
+	var ref blobRef
+	err := tx.Raw(`
+		INSERT INTO "authentication-app"."blobs" (sha256, storage_backend, storage_key, size, ref_count, created_at)
+		VALUES (?, ?, ?, ?, 1, NOW())
+		ON CONFLICT (sha256) DO UPDATE SET ref_count = blobs.ref_count + 1
+		RETURNING storage_backend, storage_key, (xmax = 0) AS created`,
+		sum, backend.Name(), blobKey(sum), size,
+	).Scan(&ref).Error
+	return ref, err
+}
+
+// orphan is an object no row refers to any more. Orphans are collected while rows are deleted and
+// removed once the transaction has committed, so a rollback never leaves rows without content.
+type orphan struct {
+	backend string
+	key     string
+	// sum is set for a blob, whose key the next upload of the same content takes again
+	sum *string
+}
+
+// Release permanently deletes a file row with its variants and versions, and drops each version's
+// reference to its blob. The objects nothing refers to any more are deleted after the commit; one
+// that fails to go is logged and left behind.
+func (s *Service) Release(ctx context.Context, file models.FileUpload) error {
+	var orphans []orphan
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		orphans = nil
+		// Locking the row keeps the variant generator from adding variants and new versions from
+		// being recorded while the file goes away
+		var locked models.FileUpload
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			First(&locked, "id = ?", file.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		variants, err := deleteVariants(tx, file.ID)
+		if err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			orphans = append(orphans, orphan{backend: variant.StorageBackend, key: variant.StorageKey})
+		}
+
+		var versions []models.FileVersion
+		if err := tx.Where("file_id = ?", file.ID).Find(&versions).Error; err != nil {
+			return err
+		}
+		// The versions go with the file row; their blobs are released once nothing refers to them
+		if err := tx.Unscoped().Delete(&file).Error; err != nil {
+			return err
+		}
+		for _, version := range versions {
+			released, err := releaseContent(tx, version.StorageBackend, version.StorageKey, version.SHA256)
+			if err != nil {
+				return err
+			}
+			orphans = append(orphans, released...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.deleteOrphans(ctx, orphans)
+	return nil
+}
+
+// releaseVersion deletes a version that is not its file's current one and drops its content
+func releaseVersion(tx *gorm.DB, version models.FileVersion) ([]orphan, error) {
+	if err := tx.Delete(&version).Error; err != nil {
+		return nil, err
+	}
+	return releaseContent(tx, version.StorageBackend, version.StorageKey, version.SHA256)
+}
+
+// releaseContent drops a reference to stored content whose row is already gone and returns the
+// object when it was the last one. Content without a hash, predating deduplication or quarantined,
+// owns its object.
+func releaseContent(tx *gorm.DB, backendName, key string, sum *string) ([]orphan, error) {
+	if sum == nil {
+		return []orphan{{backend: backendName, key: key}}, nil
+	}
+
+	var blob models.Blob
+	if err := tx.Raw(`
+		UPDATE "authentication-app"."blobs" SET ref_count = ref_count - 1
+		WHERE sha256 = ?
+		RETURNING *`, *sum,
+	).Scan(&blob).Error; err != nil {
+		return nil, err
+	}
+	if blob.SHA256 == "" || blob.RefCount > 0 {
+		return nil, nil
+	}
+
+	if err := tx.Delete(&blob).Error; err != nil {
+		return nil, err
+	}
+	return []orphan{{backend: blob.StorageBackend, key: blob.StorageKey, sum: sum}}, nil
+}
+
+// deleteOrphans deletes objects whose rows are gone, logging the ones that cannot be deleted. It
+// runs after the request may have ended, so it does not stop when ctx is cancelled.
+func (s *Service) deleteOrphans(ctx context.Context, orphans []orphan) {
+	ctx = context.WithoutCancel(ctx)
+	for _, o := range orphans {
+		var err error
+		if o.sum != nil {
+			err = s.deleteBlobObject(ctx, o)
+		} else {
+			err = s.deleteObject(ctx, o.backend, o.key)
+		}
+		if err != nil {
+			s.logger.Errorf("Failed to remove orphaned object %s from %s: %v", o.key, o.backend, err)
+		}
+	}
+}
+
+// deleteBlobObject deletes the object of a blob unless an upload registered the blob again since
+// its row was deleted, in which case the object at its key is that upload's
+func (s *Service) deleteBlobObject(ctx context.Context, o orphan) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockBlob(tx, *o.sum); err != nil {
+			return err
+		}
+		var registered int64
+		if err := tx.Model(&models.Blob{}).Where("sha256 = ?", *o.sum).Count(&registered).Error; err != nil {
+			return err
+		}
+		if registered > 0 {
+			return nil
+		}
+		return s.deleteObject(ctx, o.backend, o.key)
+	})
+}
+
+// deleteVariants deletes the variant rows of a file and returns them, so their objects can go too
+func deleteVariants(tx *gorm.DB, fileID uuid.UUID) ([]models.FileVariant, error) {
+	var variants []models.FileVariant
+	err := tx.Raw(`DELETE FROM "authentication-app"."file_variants" WHERE file_id = ? RETURNING *`, fileID).
+		Scan(&variants).Error
+	return variants, err
+}
+
+func (s *Service) deleteObject(ctx context.Context, backendName, key string) error {
+	backend, err := s.storage.Backend(backendName)
+	if err != nil {
+		return err
+	}
+	if err := backend.Delete(ctx, key); err != nil {
+		return fmt.Errorf("delete object %s from %s: %w", key, backendName, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package upload
+
+import (
+	"authentication-app/config"
+	"authentication-app/pkg/utils"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const megabyte = 1024 * 1024
+
+// Policy bounds what a single user may upload. Zero MaxFiles, QuotaBytes or image limits mean
+// unlimited.
+type Policy struct {
+	MaxFileSize       int64
+	AllowedTypes      []string
+	AllowedExtensions []string
+	MaxFiles          int64
+	QuotaBytes        int64
+	MaxImageWidth     int
+	MaxImageHeight    int
+	MaxImagePixels    int64
+	StripMetadata     bool
+}
+
+// AllowsType reports whether a (normalized) content type is on the allow-list
+func (p Policy) AllowsType(contentType string) bool {
+	for _, allowed := range p.AllowedTypes {
+		if allowed == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsExtension reports whether the extension of a file name is on the allow-list. An empty list allows any.
+func (p Policy) AllowsExtension(filename string) bool {
+	if len(p.AllowedExtensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, allowed := range p.AllowedExtensions {
+		if allowed == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Policies holds the default policy and the per-role overrides
+type Policies struct {
+	defaults Policy
+	roles    map[string]Policy
+}
+
+func NewPolicies(cfg *config.Config) (*Policies, error) {
+	defaults := Policy{
+		MaxFileSize:       cfg.UploadMaxFileSizeMB * megabyte,
+		AllowedTypes:      normalizeList(cfg.UploadAllowedTypes, utils.NormalizeContentType),
+		AllowedExtensions: normalizeList(cfg.UploadAllowedExtensions, normalizeExtension),
+		MaxFiles:          cfg.UploadMaxFilesPerUser,
+		QuotaBytes:        cfg.UploadQuotaMBPerUser * megabyte,
+		MaxImageWidth:     cfg.UploadMaxImageWidth,
+		MaxImageHeight:    cfg.UploadMaxImageHeight,
+		MaxImagePixels:    cfg.UploadMaxImagePixels,
+		StripMetadata:     cfg.UploadStripMetadata,
+	}
+	if defaults.MaxFileSize <= 0 {
+		return nil, fmt.Errorf("UPLOAD_MAX_FILE_SIZE_MB must be positive")
+	}
+	if len(defaults.AllowedTypes) == 0 {
+		return nil, fmt.Errorf("UPLOAD_ALLOWED_TYPES must list at least one type")
+	}
+
+	roles, err := parseRolePolicies(cfg.UploadRolePolicies, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Policies{
+		defaults: defaults,
+		roles:    roles,
+	}, nil
+}
+
+// For returns the policy that applies to a role
+func (p *Policies) For(role string) Policy {
+	if policy, ok := p.roles[role]; ok {
+		return policy
+	}
+	return p.defaults
+}
+
+// parseRolePolicies reads "role:key=value,key=value;role:..." where the keys are max_file_size_mb,
+// max_files and quota_mb. Anything not overridden is inherited from the defaults.
+func parseRolePolicies(value string, defaults Policy) (map[string]Policy, error) {
+	roles := make(map[string]Policy)
+	for _, entry := range utils.SplitAndTrim(value, ";") {
+		role, settings, ok := strings.Cut(entry, ":")
+		role = strings.TrimSpace(role)
+		if !ok || role == "" {
+			return nil, fmt.Errorf("invalid UPLOAD_ROLE_POLICIES entry %q, expected role:key=value", entry)
+		}
+
+		policy := defaults
+		for _, setting := range utils.SplitAndTrim(settings, ",") {
+			key, raw, ok := strings.Cut(setting, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid UPLOAD_ROLE_POLICIES setting %q for role %s", setting, role)
+			}
+			number, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil || number < 0 {
+				return nil, fmt.Errorf("invalid UPLOAD_ROLE_POLICIES value %q for role %s", raw, role)
+			}
+
+			switch strings.TrimSpace(key) {
+			case "max_file_size_mb":
+				if number == 0 {
+					return nil, fmt.Errorf("max_file_size_mb must be positive for role %s", role)
+				}
+				policy.MaxFileSize = number * megabyte
+			case "max_files":
+				policy.MaxFiles = number
+			case "quota_mb":
+				policy.QuotaBytes = number * megabyte
+			default:
+				return nil, fmt.Errorf("unknown UPLOAD_ROLE_POLICIES key %q for role %s", key, role)
+			}
+		}
+		roles[role] = policy
+	}
+	return roles, nil
+}
+
+func normalizeList(value string, normalize func(string) string) []string {
+	items := utils.SplitAndTrim(value, ",")
+	for i, item := range items {
+		items[i] = normalize(item)
+	}
+	return items
+}
+
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
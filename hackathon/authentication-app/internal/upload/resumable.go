@@ -0,0 +1,326 @@
+package upload
+
+import (
+	"authentication-app/internal/models"
+	"authentication-app/pkg/storage"
+	"authentication-app/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const resumablePurgeBatchSize = 100
+
+// ErrOffsetMismatch is returned when a chunk does not start where the stored upload ends
+var ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+// errUploadCompleted rolls back the ingestion of an upload another request completed first
+var errUploadCompleted = errors.New("upload already completed")
+
+// errEmptyChunk marks a chunk without bytes, which is accepted but not recorded
+var errEmptyChunk = errors.New("empty chunk")
+
+// CreateResumable registers a resumable upload of req.Size bytes after running the checks that
+// need no content, so a doomed upload is refused before its first chunk
+func (s *Service) CreateResumable(ctx context.Context, req Request, metadata string) (*models.TusUpload, error) {
+	if err := s.Check(ctx, req); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	upload := &models.TusUpload{
+		ID:             uuid.New(),
+		UserID:         req.UserID,
+		OrganizationID: req.OrganizationID,
+		FolderID:       req.FolderID,
+		Length:         req.Size,
+		Metadata:       metadata,
+		Filename:       req.Filename,
+		ContentType:    utils.NormalizeContentType(req.DeclaredType),
+		ExpiresAt:      now.Add(s.resumableTTL),
+		CreatedAt:      now,
+	}
+	if err := s.db.WithContext(ctx).Create(upload).Error; err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// FindResumable loads an unexpired resumable upload of a user
+func (s *Service) FindResumable(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*models.TusUpload, error) {
+	var upload models.TusUpload
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND user_id = ? AND expires_at > ?", id, userID, time.Now()).
+		First(&upload).Error; err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// AppendResumable stores body as the chunk starting at offset. The chunk is written to its own
+// object first and only counted once it has been received completely; the conditional offset
+// update makes concurrent chunks for the same offset fail instead of interleaving.
+func (s *Service) AppendResumable(ctx context.Context, upload *models.TusUpload, offset int64, body io.Reader) error {
+	if upload.Completed() || offset != upload.Offset {
+		return ErrOffsetMismatch
+	}
+
+	// Retrying the final chunk without content only re-triggers completion
+	remaining := upload.Length - upload.Offset
+	if remaining == 0 {
+		if n, _ := io.Copy(io.Discard, io.LimitReader(body, 1)); n > 0 {
+			return violation(ErrFileTooLarge, "Chunk exceeds the Upload-Length of %d bytes", upload.Length)
+		}
+		return nil
+	}
+
+	backend := s.storage.Primary()
+	key := fmt.Sprintf("tus/%s/%020d-%s", upload.ID, offset, utils.GenerateRandomString(8))
+	counter := &countingReader{r: io.LimitReader(body, remaining+1)}
+	if err := backend.Put(ctx, key, counter, -1, "application/octet-stream"); err != nil {
+		return fmt.Errorf("store chunk in %s: %w", backend.Name(), err)
+	}
+
+	err := func() error {
+		if counter.n > remaining {
+			return violation(ErrFileTooLarge, "Chunk exceeds the Upload-Length of %d bytes", upload.Length)
+		}
+		if counter.n == 0 {
+			return errEmptyChunk
+		}
+
+		now := time.Now()
+		return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.TusUpload{}).
+				Where("id = ? AND upload_offset = ? AND file_id IS NULL", upload.ID, offset).
+				Updates(map[string]interface{}{
+					"upload_offset": gorm.Expr("upload_offset + ?", counter.n),
+					"expires_at":    now.Add(s.resumableTTL),
+					"updated_at":    now,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrOffsetMismatch
+			}
+
+			upload.Offset += counter.n
+			upload.ExpiresAt = now.Add(s.resumableTTL)
+			return tx.Create(&models.TusUploadPart{
+				UploadID:       upload.ID,
+				Offset:         offset,
+				Size:           counter.n,
+				StorageBackend: backend.Name(),
+				StorageKey:     key,
+				CreatedAt:      now,
+			}).Error
+		})
+	}()
+	if err != nil {
+		if deleteErr := backend.Delete(context.WithoutCancel(ctx), key); deleteErr != nil {
+			s.logger.Errorf("Failed to remove rejected chunk %s: %v", key, deleteErr)
+		}
+		if errors.Is(err, errEmptyChunk) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// CompleteResumable ingests a fully received upload exactly like a single-request upload. The
+// owner, tenant, name and declared type come from the upload; req supplies the caller's role and
+// client details. Completing an already completed upload returns its file.
+func (s *Service) CompleteResumable(ctx context.Context, upload *models.TusUpload, req Request) (*models.FileUpload, error) {
+	var current models.TusUpload
+	if err := s.db.WithContext(ctx).First(&current, "id = ?", upload.ID).Error; err != nil {
+		return nil, err
+	}
+	if current.Completed() {
+		return s.completedFile(ctx, upload, &current)
+	}
+	if current.Offset != current.Length {
+		return nil, ErrOffsetMismatch
+	}
+
+	var parts []models.TusUploadPart
+	if err := s.db.WithContext(ctx).Where("upload_id = ?", current.ID).Order("upload_offset").Find(&parts).Error; err != nil {
+		return nil, err
+	}
+	body, err := s.openParts(ctx, &current, parts)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	req.UserID = current.UserID
+	req.OrganizationID = current.OrganizationID
+	req.Filename = current.Filename
+	req.DeclaredType = current.ContentType
+	req.Size = current.Length
+	req.Body = body
+	// A folder trashed while the upload was in progress no longer takes new files
+	if current.FolderID != nil {
+		var live int64
+		if err := s.db.WithContext(ctx).Model(&models.Folder{}).Where("id = ?", *current.FolderID).Count(&live).Error; err != nil {
+			return nil, err
+		}
+		if live > 0 {
+			req.FolderID = current.FolderID
+		}
+	}
+
+	// The upload is marked completed in the transaction that records the file, and only if it is
+	// not yet, so a retried final chunk racing this one cannot record a second file
+	file, err := s.ingest(ctx, req, func(tx *gorm.DB, file *models.FileUpload) error {
+		result := tx.Model(&models.TusUpload{}).Where("id = ? AND file_id IS NULL", current.ID).Update("file_id", file.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errUploadCompleted
+		}
+		return nil
+	})
+	if errors.Is(err, errUploadCompleted) {
+		if err := s.db.WithContext(ctx).First(&current, "id = ?", upload.ID).Error; err != nil {
+			return nil, err
+		}
+		return s.completedFile(ctx, upload, &current)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	upload.FileID = &file.ID
+	if err := s.releaseParts(ctx, upload.ID); err != nil {
+		s.logger.Errorf("Failed to remove chunks of completed upload %s: %v", upload.ID, err)
+	}
+	return file, nil
+}
+
+// completedFile returns the file an upload was completed into
+func (s *Service) completedFile(ctx context.Context, upload *models.TusUpload, current *models.TusUpload) (*models.FileUpload, error) {
+	file := &models.FileUpload{}
+	if err := s.db.WithContext(ctx).Unscoped().First(file, "id = ?", *current.FileID).Error; err != nil {
+		return nil, err
+	}
+	upload.FileID = current.FileID
+	return file, nil
+}
+
+// TerminateResumable deletes an upload and its chunks. A file it was completed into is kept.
+func (s *Service) TerminateResumable(ctx context.Context, upload *models.TusUpload) error {
+	if err := s.releaseParts(ctx, upload.ID); err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Delete(upload).Error
+}
+
+// PurgeExpiredResumable terminates every upload whose expiration has passed
+func (s *Service) PurgeExpiredResumable(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		var uploads []models.TusUpload
+		if err := s.db.WithContext(ctx).
+			Where("expires_at <= ?", time.Now()).
+			Order("expires_at").
+			Limit(resumablePurgeBatchSize).
+			Find(&uploads).Error; err != nil {
+			return purged, err
+		}
+
+		for i := range uploads {
+			if err := s.TerminateResumable(ctx, &uploads[i]); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(uploads) < resumablePurgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// releaseParts deletes the chunk objects of an upload, then their rows
+func (s *Service) releaseParts(ctx context.Context, uploadID uuid.UUID) error {
+	var parts []models.TusUploadPart
+	if err := s.db.WithContext(ctx).Where("upload_id = ?", uploadID).Find(&parts).Error; err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if err := s.deleteObject(ctx, part.StorageBackend, part.StorageKey); err != nil {
+			return err
+		}
+	}
+	return s.db.WithContext(ctx).Where("upload_id = ?", uploadID).Delete(&models.TusUploadPart{}).Error
+}
+
+// openParts checks that the chunks cover the upload without gaps and returns a reader over them
+func (s *Service) openParts(ctx context.Context, upload *models.TusUpload, parts []models.TusUploadPart) (io.ReadCloser, error) {
+	var expected int64
+	for _, part := range parts {
+		if part.Offset != expected {
+			return nil, fmt.Errorf("chunks of upload %s are not contiguous at offset %d", upload.ID, expected)
+		}
+		expected += part.Size
+	}
+	if expected != upload.Length {
+		return nil, fmt.Errorf("chunks of upload %s cover %d of %d bytes", upload.ID, expected, upload.Length)
+	}
+
+	return &partsReader{ctx: ctx, storage: s.storage, parts: parts}, nil
+}
+
+// partsReader streams the chunks of an upload one after another, opening each only when needed
+type partsReader struct {
+	ctx     context.Context
+	storage *storage.Registry
+	parts   []models.TusUploadPart
+	current io.ReadCloser
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			part := r.parts[0]
+			r.parts = r.parts[1:]
+
+			backend, err := r.storage.Backend(part.StorageBackend)
+			if err != nil {
+				return 0, err
+			}
+			if r.current, err = backend.Get(r.ctx, part.StorageKey); err != nil {
+				return 0, fmt.Errorf("open chunk %s: %w", part.StorageKey, err)
+			}
+		}
+
+		n, err := r.current.Read(p)
+		if errors.Is(err, io.EOF) {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
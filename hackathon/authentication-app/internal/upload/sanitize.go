@@ -0,0 +1,129 @@
+package upload
+
+import (
+	"authentication-app/pkg/imaging"
+	"authentication-app/pkg/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// checkImagePixels enforces the pixel limit from the image header, so a decompression bomb is
+// rejected before it is stored or decoded
+func checkImagePixels(policy Policy, config image.Config) error {
+	if policy.MaxImagePixels > 0 && int64(config.Width)*int64(config.Height) > policy.MaxImagePixels {
+		return violation(ErrImageTooLarge, "Image exceeds the limit of %d pixels", policy.MaxImagePixels)
+	}
+	return nil
+}
+
+// sanitizeImage enforces the dimension limits on a staged image and records its displayed width
+// and height. When the policy asks for it, the image is replaced by a copy without metadata: it is
+// read back from storage and stripped while it streams to a new staging key, so it is never held
+// whole. Only an image that has to be turned upright is decoded, within the pixel limit.
+func (s *Service) sanitizeImage(ctx context.Context, policy Policy, staged *stagedContent, config image.Config) error {
+	format := imaging.FormatOf(staged.contentType)
+	src, err := staged.backend.Get(ctx, staged.key)
+	if err != nil {
+		return fmt.Errorf("open staged object: %w", err)
+	}
+	source := &failedReader{r: src}
+	inspection, err := imaging.Inspect(source, format)
+	src.Close()
+	switch {
+	case source.err != nil:
+		return fmt.Errorf("read staged object: %w", source.err)
+	case errors.Is(err, imaging.ErrMalformed) && policy.StripMetadata:
+		return violation(ErrContentMismatch, "File content is not a valid %s file", staged.contentType)
+	case err != nil && !errors.Is(err, imaging.ErrMalformed):
+		return err
+	}
+
+	width, height := imaging.OrientedSize(config.Width, config.Height, inspection.Orientation)
+	if (policy.MaxImageWidth > 0 && width > policy.MaxImageWidth) || (policy.MaxImageHeight > 0 && height > policy.MaxImageHeight) {
+		return violation(ErrImageTooLarge, "Image dimensions %dx%d exceed the limit of %dx%d", width, height, policy.MaxImageWidth, policy.MaxImageHeight)
+	}
+	staged.width, staged.height = &width, &height
+	if !policy.StripMetadata {
+		return nil
+	}
+
+	// The sanitised image streams from the staged object to its own key through a pipe. Stripping
+	// keeps the pixels as they are, so its size is known; an image turned upright is re-encoded.
+	size := staged.size - inspection.Metadata
+	if inspection.Orientation > 1 {
+		size = -1
+	}
+	source = &failedReader{}
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := writeSanitized(ctx, pw, staged, source, inspection, size, policy.MaxImagePixels)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	hasher := sha256.New()
+	counter := &cappedReader{r: pr, limit: policy.MaxFileSize}
+	key := stagingPrefix + utils.GenerateUniqueFilename(staged.filename)
+	err = staged.backend.Put(ctx, key, io.TeeReader(counter, hasher), size, staged.contentType)
+	pr.Close()
+	writeErr := <-written
+	switch {
+	case counter.n > policy.MaxFileSize:
+		return violation(ErrFileTooLarge, "File size exceeds %s limit", formatBytes(policy.MaxFileSize))
+	case source.err != nil:
+		return fmt.Errorf("read staged object: %w", source.err)
+	case errors.Is(writeErr, imaging.ErrMalformed):
+		return violation(ErrContentMismatch, "File content is not a valid %s file", staged.contentType)
+	case errors.Is(writeErr, imaging.ErrTooLarge):
+		return violation(ErrImageTooLarge, "Image exceeds the limit of %d pixels", policy.MaxImagePixels)
+	case writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe):
+		// The header decoded but the pixels did not
+		return violation(ErrContentMismatch, "Image could not be decoded: %v", writeErr)
+	case err != nil:
+		return fmt.Errorf("store object in %s: %w", staged.backend.Name(), err)
+	}
+
+	// The sanitised copy replaces the image as it was received
+	s.unstage(ctx, staged)
+	staged.key = key
+	staged.size = counter.n
+	staged.sum = hex.EncodeToString(hasher.Sum(nil))
+	return nil
+}
+
+// writeSanitized writes the staged image to w without its metadata, reading it through source
+func writeSanitized(ctx context.Context, w io.Writer, staged *stagedContent, source *failedReader, inspection imaging.Inspection, size, maxPixels int64) error {
+	src, err := staged.backend.Get(ctx, staged.key)
+	if err != nil {
+		source.err = err
+		return err
+	}
+	defer src.Close()
+	source.r = src
+
+	format := imaging.FormatOf(staged.contentType)
+	if inspection.Orientation > 1 {
+		return imaging.Upright(w, source, format, inspection.Orientation, maxPixels)
+	}
+	return imaging.Strip(w, source, format, size)
+}
+
+// failedReader remembers the error of a read that failed, so that a storage failure while an image
+// is sanitised is not mistaken for an image that does not decode
+type failedReader struct {
+	r   io.Reader
+	err error
+}
+
+func (fr *failedReader) Read(p []byte) (int, error) {
+	n, err := fr.r.Read(p)
+	if err != nil && err != io.EOF {
+		fr.err = err
+	}
+	return n, err
+}
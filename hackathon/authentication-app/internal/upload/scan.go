@@ -0,0 +1,173 @@
+package upload
+
+import (
+	"authentication-app/internal/models"
+	"authentication-app/pkg/scanner"
+	"authentication-app/pkg/storage"
+	"context"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// Infected uploads are kept under quarantinePrefix for review instead of becoming blobs
+	quarantinePrefix = "quarantine/"
+	scanBatchSize    = 100
+)
+
+func quarantineKey(versionID uuid.UUID) string {
+	return quarantinePrefix + versionID.String()
+}
+
+// scanObject runs the scanner over a stored object
+func (s *Service) scanObject(ctx context.Context, backend storage.Storage, key string) (scanner.Result, error) {
+	src, err := backend.Get(ctx, key)
+	if err != nil {
+		return scanner.Result{}, err
+	}
+	defer src.Close()
+	return s.scanner.Scan(ctx, src)
+}
+
+// streamScan runs the scanner over content written to it from a goroutine, so an upload is scanned
+// while it streams to storage instead of being read back afterwards
+type streamScan struct {
+	pw     *io.PipeWriter
+	done   chan struct{}
+	result scanner.Result
+	err    error
+}
+
+func (s *Service) startScan(ctx context.Context) *streamScan {
+	pr, pw := io.Pipe()
+	scan := &streamScan{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(scan.done)
+		scan.result, scan.err = s.scanner.Scan(ctx, pr)
+		// A scanner that stops reading early, because it failed or needs no more, must not stall
+		// the upload it is fed from
+		io.Copy(io.Discard, pr)
+	}()
+	return scan
+}
+
+func (scan *streamScan) Write(p []byte) (int, error) {
+	return scan.pw.Write(p)
+}
+
+// finish ends the content and waits for the verdict. When writing failed the scanner sees the
+// error rather than the end of the content, so it cannot pass judgement on part of an upload.
+func (scan *streamScan) finish(writeErr error) (scanner.Result, error) {
+	scan.pw.CloseWithError(writeErr)
+	<-scan.done
+	if writeErr != nil {
+		return scanner.Result{}, writeErr
+	}
+	return scan.result, scan.err
+}
+
+// applyVerdict records a scan result on a file version
+func applyVerdict(version *models.FileVersion, result scanner.Result) {
+	version.ScanStatus = models.ScanStatusPending
+	version.ScanSignature = nil
+	if !result.Scanned {
+		return
+	}
+
+	now := time.Now()
+	version.ScannedAt = &now
+	version.ScanStatus = models.ScanStatusClean
+	if result.Infected {
+		signature := result.Signature
+		version.ScanStatus = models.ScanStatusInfected
+		version.ScanSignature = &signature
+	}
+}
+
+// ScanPending scans the file versions that have not been scanned yet, because they predate
+// scanning or were uploaded while it was disabled, and retries those whose scan failed.
+// Deduplicated versions share their object, so each object is scanned once and its verdict
+// applies to all of them and to the files they are current for. Versions found infected this way
+// stay where they are but can no longer be downloaded.
+func (s *Service) ScanPending(ctx context.Context) (int, error) {
+	if s.scanner.Name() == scanner.BackendNone {
+		return 0, nil
+	}
+
+	scanned := 0
+	seen := make(map[string]bool)
+	lastID := uuid.Nil
+	for {
+		var versions []models.FileVersion
+		if err := s.db.WithContext(ctx).
+			Where("scan_status IN ?", []string{models.ScanStatusPending, models.ScanStatusError}).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(scanBatchSize).
+			Find(&versions).Error; err != nil {
+			return scanned, err
+		}
+
+		for i := range versions {
+			location := versions[i].StorageBackend + "/" + versions[i].StorageKey
+			if seen[location] {
+				continue
+			}
+			seen[location] = true
+
+			if err := s.rescan(ctx, &versions[i]); err != nil {
+				if ctx.Err() != nil {
+					return scanned, ctx.Err()
+				}
+				s.logger.Errorf("Malware scan of version %d of file %s failed: %v", versions[i].Version, versions[i].FileID, err)
+				continue
+			}
+			scanned++
+		}
+
+		if len(versions) < scanBatchSize {
+			return scanned, nil
+		}
+		lastID = versions[len(versions)-1].ID
+	}
+}
+
+func (s *Service) rescan(ctx context.Context, version *models.FileVersion) error {
+	backend, err := s.storage.Backend(version.StorageBackend)
+	if err != nil {
+		return err
+	}
+	result, scanErr := s.scanObject(ctx, backend, version.StorageKey)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	applyVerdict(version, result)
+	if scanErr != nil {
+		now := time.Now()
+		version.ScanStatus = models.ScanStatusError
+		version.ScannedAt = &now
+	}
+	verdict := map[string]interface{}{
+		"scan_status":    version.ScanStatus,
+		"scan_signature": version.ScanSignature,
+		"scanned_at":     version.ScannedAt,
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.FileVersion{}).
+			Where("storage_backend = ? AND storage_key = ?", version.StorageBackend, version.StorageKey).
+			Updates(verdict).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.FileUpload{}).
+			Where("storage_backend = ? AND storage_key = ?", version.StorageBackend, version.StorageKey).
+			Updates(verdict).Error
+	})
+	if err != nil {
+		return err
+	}
+	return scanErr
+}
@@ -0,0 +1,455 @@
+package upload
+
+import (
+	"authentication-app/config"
+	"authentication-app/internal/models"
+	"authentication-app/pkg/imaging"
+	"authentication-app/pkg/scanner"
+	"authentication-app/pkg/storage"
+	"authentication-app/pkg/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFileTooLarge     = errors.New("file too large")
+	ErrTypeNotAllowed   = errors.New("file type not allowed")
+	ErrContentMismatch  = errors.New("content does not match declared type")
+	ErrImageTooLarge    = errors.New("image dimensions too large")
+	ErrFileLimitReached = errors.New("file limit reached")
+	ErrQuotaExceeded    = errors.New("storage quota exceeded")
+	ErrInfected         = errors.New("malware detected")
+
+	// ErrScanUnavailable means the malware scanner could not reach a verdict. The upload is
+	// refused but may succeed when retried.
+	ErrScanUnavailable = errors.New("malware scan unavailable")
+)
+
+// Violation is returned when an upload breaks the policy. Its message is safe to show to the
+// client and it unwraps to one of the Err* reasons above.
+type Violation struct {
+	Reason  error
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+func (v *Violation) Unwrap() error {
+	return v.Reason
+}
+
+func violation(reason error, format string, args ...interface{}) *Violation {
+	return &Violation{
+		Reason:  reason,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Usage is what a user currently holds in storage: the files they own and the bytes of the
+// versions they uploaded. Trashed files count until they are purged.
+type Usage struct {
+	Files int64
+	Bytes int64
+}
+
+// Request describes an incoming upload. Size is -1 when the client did not announce it.
+type Request struct {
+	UserID         uuid.UUID
+	OrganizationID *uuid.UUID
+	FolderID       *uuid.UUID
+	Role           string
+	Filename       string
+	DeclaredType   string
+	Size           int64
+	Body           io.Reader
+	UserAgent      string
+	IPAddress      string
+}
+
+// Service validates uploads against the policy, streams them to storage and records them
+type Service struct {
+	logger       golog.Logger
+	db           *gorm.DB
+	storage      *storage.Registry
+	policies     *Policies
+	scanner      scanner.Scanner
+	resumableTTL time.Duration
+	versionsKeep int
+}
+
+func NewService(cfg *config.Config, logger golog.Logger, db *gorm.DB, storage *storage.Registry, policies *Policies, scanner scanner.Scanner) *Service {
+	return &Service{
+		logger:       logger,
+		db:           db,
+		storage:      storage,
+		policies:     policies,
+		scanner:      scanner,
+		resumableTTL: time.Duration(cfg.TusExpirationHours) * time.Hour,
+		versionsKeep: cfg.FileVersionsKeep,
+	}
+}
+
+// Policy returns the policy that applies to a role
+func (s *Service) Policy(role string) Policy {
+	return s.policies.For(role)
+}
+
+// Usage sums the files a user has uploaded, across every tenant
+func (s *Service) Usage(ctx context.Context, userID uuid.UUID) (Usage, error) {
+	return usage(s.db.WithContext(ctx), userID)
+}
+
+// Check runs the checks that need no content: size, extension, declared type and the caller's
+// current usage. Ingest runs them too; resumable uploads run them before the first byte arrives.
+func (s *Service) Check(ctx context.Context, req Request) error {
+	_, err := s.check(ctx, s.policies.For(req.Role), req, 1)
+	return err
+}
+
+// check runs the content-free checks for an upload that adds newFiles files: one for a new file,
+// none for a new version of an existing one
+func (s *Service) check(ctx context.Context, policy Policy, req Request, newFiles int64) (string, error) {
+	if req.Size > policy.MaxFileSize {
+		return "", violation(ErrFileTooLarge, "File size exceeds %s limit", formatBytes(policy.MaxFileSize))
+	}
+	if !policy.AllowsExtension(req.Filename) {
+		return "", violation(ErrTypeNotAllowed, "File extension %q is not allowed", filepath.Ext(req.Filename))
+	}
+	declaredType := utils.NormalizeContentType(req.DeclaredType)
+	if !policy.AllowsType(declaredType) {
+		return "", violation(ErrTypeNotAllowed, "File type %q is not allowed", declaredType)
+	}
+
+	current, err := s.Usage(ctx, req.UserID)
+	if err != nil {
+		return "", err
+	}
+	if err := checkUsage(policy, current, newFiles, max(req.Size, 0)); err != nil {
+		return "", err
+	}
+
+	return declaredType, nil
+}
+
+// stagedContent is an upload that passed the content checks and was scanned, waiting under a
+// staging key to be recorded
+type stagedContent struct {
+	backend     storage.Storage
+	key         string
+	filename    string
+	contentType string
+	size        int64
+	width       *int
+	height      *int
+	sum         string
+	scan        scanner.Result
+}
+
+// stage checks an upload against the policy and stages its content. The caller unstages the
+// content once it is recorded or refused.
+func (s *Service) stage(ctx context.Context, policy Policy, req Request, newFiles int64) (*stagedContent, error) {
+	declaredType, err := s.check(ctx, policy, req, newFiles)
+	if err != nil {
+		return nil, err
+	}
+	return s.stageContent(ctx, policy, req, declaredType)
+}
+
+// stageContent sniffs the content of an upload and streams it to a staging key on the primary
+// backend in a single pass: the size limit is enforced, the content hashed and scanned for malware
+// while it is written. Images are then sanitised from the staged object, so no upload is held in
+// memory.
+func (s *Service) stageContent(ctx context.Context, policy Policy, req Request, declaredType string) (*stagedContent, error) {
+	// The declared type is client-supplied, so the bytes must prove it. The size is not known up
+	// front, so the limit is enforced on the bytes received from the start.
+	received := &cappedReader{r: req.Body, limit: policy.MaxFileSize}
+	contentType, config, body, err := utils.SniffContent(received)
+	if err != nil {
+		if received.n > policy.MaxFileSize {
+			return nil, violation(ErrFileTooLarge, "File size exceeds %s limit", formatBytes(policy.MaxFileSize))
+		}
+		if errors.Is(err, utils.ErrImageHeaderTooLarge) {
+			return nil, violation(ErrContentMismatch, "Image header exceeds the limit of %s", formatBytes(utils.MaxSniffSize))
+		}
+		if errors.Is(err, utils.ErrCorruptImage) {
+			return nil, violation(ErrContentMismatch, "File content is not a valid %s file", declaredType)
+		}
+		return nil, err
+	}
+	if contentType != declaredType {
+		return nil, violation(ErrContentMismatch, "Declared content type %s does not match detected type %s", declaredType, contentType)
+	}
+
+	isImage := imaging.Supports(contentType)
+	if isImage {
+		if err := checkImagePixels(policy, config); err != nil {
+			return nil, err
+		}
+	}
+
+	// Hash and scan the content on the way through
+	hasher := sha256.New()
+	scan := s.startScan(ctx)
+	filename := utils.GenerateUniqueFilename(req.Filename)
+	staged := &stagedContent{
+		backend:     s.storage.Primary(),
+		key:         stagingPrefix + filename,
+		filename:    filename,
+		contentType: contentType,
+	}
+	err = staged.backend.Put(ctx, staged.key, io.TeeReader(body, io.MultiWriter(hasher, scan)), req.Size, contentType)
+	result, scanErr := scan.finish(err)
+	if received.n > policy.MaxFileSize {
+		// The backend stops at the failed read and keeps nothing
+		return nil, violation(ErrFileTooLarge, "File size exceeds %s limit", formatBytes(policy.MaxFileSize))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("store object in %s: %w", staged.backend.Name(), err)
+	}
+	if scanErr != nil {
+		s.unstage(ctx, staged)
+		return nil, fmt.Errorf("%w: %v", ErrScanUnavailable, scanErr)
+	}
+
+	staged.scan = result
+	staged.size = received.n
+	staged.sum = hex.EncodeToString(hasher.Sum(nil))
+
+	// Infected images are quarantined as they were received
+	if isImage && !result.Infected {
+		if err := s.sanitizeImage(ctx, policy, staged, config); err != nil {
+			s.unstage(ctx, staged)
+			return nil, err
+		}
+	}
+	return staged, nil
+}
+
+// unstage deletes a staged object, which is either moved to its final key or redundant once the
+// upload is recorded
+func (s *Service) unstage(ctx context.Context, staged *stagedContent) {
+	if err := staged.backend.Delete(context.WithoutCancel(ctx), staged.key); err != nil {
+		s.logger.Errorf("Failed to remove staged object %s: %v", staged.key, err)
+	}
+}
+
+// newVersion describes staged content as a version of a file, with the scanner's verdict
+func newVersion(fileID uuid.UUID, number int, req Request, staged *stagedContent) *models.FileVersion {
+	version := &models.FileVersion{
+		ID:           uuid.New(),
+		FileID:       fileID,
+		Version:      number,
+		OriginalName: req.Filename,
+		ContentType:  staged.contentType,
+		Size:         staged.size,
+		Width:        staged.width,
+		Height:       staged.height,
+		UploadedBy:   &req.UserID,
+		CreatedAt:    time.Now(),
+	}
+	applyVerdict(version, staged.scan)
+	return version
+}
+
+// discardPlaced deletes the object moved to a version's location by a transaction that then failed
+// to commit. A blob registered again in the meantime keeps its object, and so does a quarantined
+// version whose commit went through even though it reported an error.
+func (s *Service) discardPlaced(ctx context.Context, version *models.FileVersion) {
+	if version.SHA256 == nil {
+		var recorded int64
+		if err := s.db.WithContext(context.WithoutCancel(ctx)).Model(&models.FileVersion{}).Where("id = ?", version.ID).Count(&recorded).Error; err != nil {
+			s.logger.Errorf("Failed to check version %s before removing its object: %v", version.ID, err)
+			return
+		}
+		if recorded > 0 {
+			return
+		}
+	}
+	s.deleteOrphans(ctx, []orphan{{backend: version.StorageBackend, key: version.StorageKey, sum: version.SHA256}})
+}
+
+// place gives a version its storage location. Infected content gets a quarantine key of its own,
+// as it must not be shared through deduplication; anything else takes a reference to the blob of
+// its hash. It reports whether the staged object has to be moved to the location, which must be
+// the last step of the transaction so that a committed blob always has its object.
+func place(tx *gorm.DB, staged *stagedContent, version *models.FileVersion) (bool, error) {
+	if version.ScanStatus == models.ScanStatusInfected {
+		version.SHA256 = nil
+		version.StorageBackend = staged.backend.Name()
+		version.StorageKey = quarantineKey(version.ID)
+		return true, nil
+	}
+
+	blob, err := acquireBlob(tx, staged.backend, staged.sum, staged.size)
+	if err != nil {
+		return false, err
+	}
+	sum := staged.sum
+	version.SHA256 = &sum
+	version.StorageBackend = blob.StorageBackend
+	version.StorageKey = blob.StorageKey
+	return blob.Created, nil
+}
+
+// Ingest checks an upload against the caller's policy, stages and scans it, and records it as a
+// new file with its first version. The quota is checked again under a per-user lock before the
+// rows are written, so concurrent uploads cannot overshoot it. Infected uploads are recorded in
+// quarantine and refused. Content is stored once per SHA-256: an upload of bytes that are already
+// stored only takes another reference to the existing blob.
+func (s *Service) Ingest(ctx context.Context, req Request) (*models.FileUpload, error) {
+	return s.ingest(ctx, req, nil)
+}
+
+// ingest is Ingest with a hook that runs in the transaction recording the file, once its rows are
+// created, so a caller can tie its own records to the file atomically. An error from the hook
+// rolls the file back.
+func (s *Service) ingest(ctx context.Context, req Request, recorded func(tx *gorm.DB, file *models.FileUpload) error) (*models.FileUpload, error) {
+	policy := s.policies.For(req.Role)
+	staged, err := s.stage(ctx, policy, req, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer s.unstage(ctx, staged)
+
+	file := &models.FileUpload{
+		ID:             uuid.New(),
+		UserID:         req.UserID,
+		OrganizationID: req.OrganizationID,
+		FolderID:       req.FolderID,
+		Filename:       staged.filename,
+		UserAgent:      req.UserAgent,
+		IPAddress:      req.IPAddress,
+		CreatedAt:      time.Now(),
+	}
+	version := newVersion(file.ID, 1, req, staged)
+
+	moved := false
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Serialize uploads of the same user so the quota check and insert are atomic
+		if err := lockUploader(tx, req.UserID); err != nil {
+			return err
+		}
+		current, err := usage(tx, req.UserID)
+		if err != nil {
+			return err
+		}
+		if err := checkUsage(policy, current, 1, version.Size); err != nil {
+			return err
+		}
+
+		move, err := place(tx, staged, version)
+		if err != nil {
+			return err
+		}
+		version.Promote(file)
+		if err := tx.Create(file).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+		if recorded != nil {
+			if err := recorded(tx, file); err != nil {
+				return err
+			}
+		}
+		if !move {
+			return nil
+		}
+		moved = true
+		return staged.backend.Move(ctx, staged.key, version.StorageKey)
+	})
+	if err != nil {
+		if moved {
+			s.discardPlaced(ctx, version)
+		}
+		return nil, err
+	}
+	if file.ScanStatus == models.ScanStatusInfected {
+		s.logger.Warnf("Quarantined upload %s of user %s: %s", file.ID, file.UserID, *file.ScanSignature)
+		return nil, violation(ErrInfected, "File is infected with %s and has been quarantined", *file.ScanSignature)
+	}
+
+	return file, nil
+}
+
+func lockUploader(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", "upload:"+userID.String()).Error
+}
+
+// usage counts the files a user owns and the bytes of every version they uploaded, including
+// trashed files and versions of files owned by others
+func usage(db *gorm.DB, userID uuid.UUID) (Usage, error) {
+	var current Usage
+	err := db.Raw(`SELECT
+			(SELECT COUNT(*) FROM "authentication-app"."file_uploads" WHERE user_id = ?) AS files,
+			(SELECT COALESCE(SUM(size), 0) FROM "authentication-app"."file_versions" WHERE uploaded_by = ?) AS bytes`,
+		userID, userID,
+	).Scan(&current).Error
+	return current, err
+}
+
+func checkUsage(policy Policy, current Usage, newFiles int64, size int64) error {
+	if policy.MaxFiles > 0 && newFiles > 0 && current.Files+newFiles > policy.MaxFiles {
+		return violation(ErrFileLimitReached, "File limit of %d files reached", policy.MaxFiles)
+	}
+	if policy.QuotaBytes > 0 && current.Bytes+size > policy.QuotaBytes {
+		return violation(ErrQuotaExceeded, "Storage quota of %s exceeded", formatBytes(policy.QuotaBytes))
+	}
+	return nil
+}
+
+func formatBytes(size int64) string {
+	if size%megabyte == 0 {
+		return fmt.Sprintf("%dMB", size/megabyte)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// cappedReader counts the bytes read through it and fails once they exceed limit, so oversized
+// content is refused as soon as the byte past the limit arrives rather than after it was stored
+type cappedReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (cr *cappedReader) Read(p []byte) (int, error) {
+	if cr.n > cr.limit {
+		return 0, ErrFileTooLarge
+	}
+	// Never read further than the first byte past the limit
+	if room := cr.limit - cr.n + 1; int64(len(p)) > room {
+		p = p[:room]
+	}
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	if cr.n > cr.limit {
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
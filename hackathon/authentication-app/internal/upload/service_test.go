@@ -0,0 +1,342 @@
+package upload
+
+import (
+	"authentication-app/pkg/scanner"
+	"authentication-app/pkg/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	golog "github.com/luongwnv/go-log"
+)
+
+func TestCappedReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		limit   int64
+		oneByte bool
+		wantN   int64
+		wantErr error
+	}{
+		{name: "under the limit", size: 5, limit: 10, wantN: 5},
+		{name: "at the limit", size: 10, limit: 10, wantN: 10},
+		{name: "one byte past the limit", size: 11, limit: 10, wantN: 11, wantErr: ErrFileTooLarge},
+		{name: "far past the limit", size: 1000, limit: 10, wantN: 11, wantErr: ErrFileTooLarge},
+		{name: "far past the limit in one-byte reads", size: 1000, limit: 10, oneByte: true, wantN: 11, wantErr: ErrFileTooLarge},
+		{name: "empty", size: 0, limit: 10, wantN: 0},
+		{name: "zero limit", size: 1, limit: 0, wantN: 1, wantErr: ErrFileTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &countingReader{r: strings.NewReader(strings.Repeat("x", tt.size))}
+			var r io.Reader = source
+			if tt.oneByte {
+				r = iotest.OneByteReader(r)
+			}
+			capped := &cappedReader{r: r, limit: tt.limit}
+
+			got, err := io.ReadAll(capped)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadAll error = %v, want %v", err, tt.wantErr)
+			}
+			if capped.n != tt.wantN || int64(len(got)) != tt.wantN {
+				t.Errorf("read %d bytes, counted %d, want %d", len(got), capped.n, tt.wantN)
+			}
+			// The byte past the limit is the last one taken from the source
+			if source.n > tt.limit+1 {
+				t.Errorf("source was read for %d bytes, want at most %d", source.n, tt.limit+1)
+			}
+
+			if tt.wantErr != nil {
+				if n, err := capped.Read(make([]byte, 8)); n != 0 || !errors.Is(err, ErrFileTooLarge) {
+					t.Errorf("Read after the limit = %d, %v, want 0, ErrFileTooLarge", n, err)
+				}
+			}
+		})
+	}
+}
+
+func TestStageContentSanitizesImages(t *testing.T) {
+	upright := testJPEG(t, 0.01, 1)
+	// Orientation 6 shows the image turned a quarter, so its displayed width is its stored height
+	turned := testJPEG(t, 0.01, 6)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(upright))
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict := Policy{MaxFileSize: megabyte, AllowedTypes: []string{"image/jpeg"}, StripMetadata: true}
+	keep := strict
+	keep.StripMetadata = false
+	narrow := strict
+	narrow.MaxImageWidth = config.Height
+
+	tests := []struct {
+		name       string
+		policy     Policy
+		content    []byte
+		wantWidth  int
+		wantHeight int
+		wantSize   int
+		wantErr    error
+	}{
+		{name: "metadata stripped", policy: strict, content: upright, wantWidth: config.Width, wantHeight: config.Height, wantSize: len(upright) - 36},
+		{name: "metadata kept", policy: keep, content: upright, wantWidth: config.Width, wantHeight: config.Height, wantSize: len(upright)},
+		{name: "turned upright", policy: strict, content: turned, wantWidth: config.Height, wantHeight: config.Width},
+		{name: "turned within the width limit", policy: narrow, content: turned, wantWidth: config.Height, wantHeight: config.Width},
+		{name: "beyond the width limit", policy: narrow, content: upright, wantErr: ErrImageTooLarge},
+		{name: "truncated image to turn", policy: strict, content: turned[:len(turned)/2], wantErr: ErrContentMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			backend, err := storage.NewLocalStorage(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &Service{logger: golog.NewLogger(golog.WithFormat("json"), golog.WithLevel("error")), storage: storage.NewRegistry(backend), scanner: scanner.Noop{}}
+			ctx := context.Background()
+
+			req := Request{Filename: "photo.jpg", Size: -1, Body: bytes.NewReader(tt.content)}
+			staged, err := s.stageContent(ctx, tt.policy, req, "image/jpeg")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("stageContent error = %v, want %v", err, tt.wantErr)
+				}
+				if keys := listKeys(t, backend); len(keys) != 0 {
+					t.Errorf("refused image left %v behind", keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stageContent: %v", err)
+			}
+
+			if *staged.width != tt.wantWidth || *staged.height != tt.wantHeight {
+				t.Errorf("staged %dx%d, want %dx%d", *staged.width, *staged.height, tt.wantWidth, tt.wantHeight)
+			}
+			if keys := listKeys(t, backend); len(keys) != 1 || keys[0] != staged.key {
+				t.Fatalf("staged objects = %v, want only %s", keys, staged.key)
+			}
+			src, err := backend.Get(ctx, staged.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, err := io.ReadAll(src)
+			src.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sum := sha256.Sum256(stored); hex.EncodeToString(sum[:]) != staged.sum || int64(len(stored)) != staged.size {
+				t.Errorf("staged sum and size do not describe the stored object")
+			}
+			if tt.wantSize != 0 && len(stored) != tt.wantSize {
+				t.Errorf("stored %d bytes, want %d", len(stored), tt.wantSize)
+			}
+			stripped := tt.policy.StripMetadata
+			if hasExif := bytes.Contains(stored, []byte("Exif\x00\x00")); hasExif == stripped {
+				t.Errorf("stored image has EXIF: %v, want %v", hasExif, !stripped)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(stored))
+			if err != nil {
+				t.Fatalf("decode the stored image: %v", err)
+			}
+			if stripped && (img.Bounds().Dx() != tt.wantWidth || img.Bounds().Dy() != tt.wantHeight) {
+				t.Errorf("stored image is %v, want %dx%d", img.Bounds().Size(), tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func listKeys(t *testing.T, backend storage.Storage) []string {
+	t.Helper()
+	var keys []string
+	if err := backend.List(context.Background(), "", func(info storage.ObjectInfo) error {
+		keys = append(keys, info.Key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// patternReader produces size bytes of binary content without holding them
+type patternReader struct {
+	size int64
+	off  int64
+}
+
+func (pr *patternReader) Read(p []byte) (int, error) {
+	if pr.off >= pr.size {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), pr.size-pr.off)]
+	for i := range p {
+		p[i] = byte((pr.off + int64(i)) * 131 % 251)
+	}
+	pr.off += int64(len(p))
+	return len(p), nil
+}
+
+// testJPEG encodes a 4:3 JPEG of about megapixels million random pixels, with an EXIF segment
+// holding an orientation so that staging it has metadata to strip
+func testJPEG(tb testing.TB, megapixels float64, orientation uint16) []byte {
+	tb.Helper()
+	width := int(math.Sqrt(megapixels * 1e6 * 4 / 3))
+	img := image.NewRGBA(image.Rect(0, 0, width, width*3/4))
+	random := rand.NewChaCha8([32]byte{})
+	random.Read(img.Pix)
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 90}); err != nil {
+		tb.Fatal(err)
+	}
+
+	// A little-endian TIFF block with one directory entry, the orientation
+	exif := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00")
+	exif = binary.LittleEndian.AppendUint16(exif, orientation)
+	exif = append(exif, 0, 0, 0, 0, 0, 0)
+	segment := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(exif)+2))
+
+	data := append([]byte{0xFF, 0xD8}, segment...)
+	data = append(data, exif...)
+	return append(data, encoded.Bytes()[2:]...)
+}
+
+// heapSampler records the peak of the live heap while uploads run
+type heapSampler struct {
+	peak atomic.Uint64
+	stop chan struct{}
+	done chan struct{}
+}
+
+func sampleHeap() *heapSampler {
+	hs := &heapSampler{stop: make(chan struct{}), done: make(chan struct{})}
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	go func() {
+		defer close(hs.done)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			metrics.Read(sample)
+			if v := sample[0].Value.Uint64(); v > hs.peak.Load() {
+				hs.peak.Store(v)
+			}
+			select {
+			case <-hs.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return hs
+}
+
+func (hs *heapSampler) finish() uint64 {
+	close(hs.stop)
+	<-hs.done
+	return hs.peak.Load()
+}
+
+// BenchmarkUpload stages concurrent uploads to local storage, the path every upload takes between
+// the request body and the database, and reports the peak heap they need beyond what the benchmark
+// holds itself. It should stay flat as the uploads grow: run it with -benchtime=3x to compare sizes.
+func BenchmarkUpload(b *testing.B) {
+	const concurrency = 8
+	policy := Policy{
+		MaxFileSize:    1024 * megabyte,
+		AllowedTypes:   []string{"application/octet-stream", "image/jpeg"},
+		MaxImagePixels: 50_000_000,
+		StripMetadata:  true,
+	}
+
+	cases := []struct {
+		name        string
+		contentType string
+		size        int64
+		content     func(b *testing.B) []byte
+	}{
+		{name: "stream_8MB", contentType: "application/octet-stream", size: 8 * megabyte},
+		{name: "stream_64MB", contentType: "application/octet-stream", size: 64 * megabyte},
+		{name: "image_4MP", contentType: "image/jpeg", content: func(b *testing.B) []byte { return testJPEG(b, 4, 1) }},
+		{name: "image_16MP", contentType: "image/jpeg", content: func(b *testing.B) []byte { return testJPEG(b, 16, 1) }},
+		// Turning an image upright decodes it, which is bounded by the pixel limit rather than flat
+		{name: "upright_4MP", contentType: "image/jpeg", content: func(b *testing.B) []byte { return testJPEG(b, 4, 6) }},
+	}
+
+	for _, bc := range cases {
+		b.Run(bc.name, func(b *testing.B) {
+			backend, err := storage.NewLocalStorage(b.TempDir())
+			if err != nil {
+				b.Fatal(err)
+			}
+			s := &Service{logger: golog.NewLogger(golog.WithFormat("json"), golog.WithLevel("error")), storage: storage.NewRegistry(backend), scanner: scanner.Noop{}}
+
+			var content []byte
+			size := bc.size
+			if bc.content != nil {
+				content = bc.content(b)
+				size = int64(len(content))
+			}
+			body := func() io.Reader {
+				if content != nil {
+					return bytes.NewReader(content)
+				}
+				return &patternReader{size: size}
+			}
+
+			b.SetBytes(size * concurrency)
+			b.ReportAllocs()
+			runtime.GC()
+			baseline := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+			metrics.Read(baseline)
+			sampler := sampleHeap()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				errs := make(chan error, concurrency)
+				for j := 0; j < concurrency; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						req := Request{Filename: "upload.bin", Size: size, Body: body()}
+						staged, err := s.stageContent(context.Background(), policy, req, bc.contentType)
+						if err != nil {
+							errs <- err
+							return
+						}
+						s.unstage(context.Background(), staged)
+					}()
+				}
+				wg.Wait()
+				close(errs)
+				for err := range errs {
+					b.Fatal(err)
+				}
+			}
+
+			b.StopTimer()
+			peak := sampler.finish()
+			b.ReportMetric(float64(peak-min(peak, baseline[0].Value.Uint64()))/megabyte, "peak-heap-MB")
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package upload
+
+import (
+	"authentication-app/internal/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IngestVersion records an upload as the next version of an existing file. It runs the checks of
+// Ingest, except that a version does not count as another file, and charges the uploader for its
+// bytes. A clean version becomes the file's current content and the variants of the content it
+// replaces are deleted; an infected one is kept in quarantine and refused. Versions beyond the
+// configured number are pruned afterwards.
+func (s *Service) IngestVersion(ctx context.Context, fileID uuid.UUID, req Request) (*models.FileUpload, *models.FileVersion, error) {
+	policy := s.policies.For(req.Role)
+	staged, err := s.stage(ctx, policy, req, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer s.unstage(ctx, staged)
+
+	var file models.FileUpload
+	var version *models.FileVersion
+	var variants []models.FileVariant
+	moved := false
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockUploader(tx, req.UserID); err != nil {
+			return err
+		}
+		current, err := usage(tx, req.UserID)
+		if err != nil {
+			return err
+		}
+		if err := checkUsage(policy, current, 0, staged.size); err != nil {
+			return err
+		}
+
+		// Locking the file serializes its versions and keeps the variant generator from recording
+		// variants of the content being replaced
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&file, "id = ?", fileID).Error; err != nil {
+			return err
+		}
+		var latest int
+		if err := tx.Model(&models.FileVersion{}).
+			Select("COALESCE(MAX(version), 0)").
+			Where("file_id = ?", fileID).
+			Scan(&latest).Error; err != nil {
+			return err
+		}
+
+		version = newVersion(file.ID, latest+1, req, staged)
+		move, err := place(tx, staged, version)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+		if version.ScanStatus != models.ScanStatusInfected {
+			if err := promote(tx, &file, version); err != nil {
+				return err
+			}
+			if variants, err = deleteVariants(tx, file.ID); err != nil {
+				return err
+			}
+		}
+		if !move {
+			return nil
+		}
+		moved = true
+		return staged.backend.Move(ctx, staged.key, version.StorageKey)
+	})
+	if err != nil {
+		if moved {
+			s.discardPlaced(ctx, version)
+		}
+		return nil, nil, err
+	}
+
+	orphans := make([]orphan, 0, len(variants))
+	for _, variant := range variants {
+		orphans = append(orphans, orphan{backend: variant.StorageBackend, key: variant.StorageKey})
+	}
+	s.deleteOrphans(ctx, orphans)
+	if version.ScanStatus == models.ScanStatusInfected {
+		s.logger.Warnf("Quarantined version %d of file %s uploaded by %s: %s", version.Version, file.ID, req.UserID, *version.ScanSignature)
+		return nil, nil, violation(ErrInfected, "File is infected with %s and has been quarantined", *version.ScanSignature)
+	}
+	if err := s.PruneVersions(ctx, file.ID); err != nil {
+		s.logger.Errorf("Failed to prune versions of file %s: %v", file.ID, err)
+	}
+
+	return &file, version, nil
+}
+
+// RestoreVersion rolls a file back to an earlier version by uploading its content again as the
+// next version, so the history is kept and the content goes through the current policy and
+// scanner. Quarantined versions cannot be restored.
+func (s *Service) RestoreVersion(ctx context.Context, fileID uuid.UUID, number int, req Request) (*models.FileUpload, *models.FileVersion, error) {
+	var old models.FileVersion
+	if err := s.db.WithContext(ctx).Where("file_id = ? AND version = ?", fileID, number).First(&old).Error; err != nil {
+		return nil, nil, err
+	}
+	if old.ScanStatus == models.ScanStatusInfected {
+		return nil, nil, violation(ErrInfected, "Version %d is quarantined and cannot be restored", number)
+	}
+
+	backend, err := s.storage.Backend(old.StorageBackend)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, err := backend.Get(ctx, old.StorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer src.Close()
+
+	req.Filename = old.OriginalName
+	req.DeclaredType = old.ContentType
+	req.Size = old.Size
+	req.Body = src
+	return s.IngestVersion(ctx, fileID, req)
+}
+
+// PruneVersions deletes the oldest versions of a file beyond the number to keep. The current
+// version always counts as one of them and is never pruned.
+func (s *Service) PruneVersions(ctx context.Context, fileID uuid.UUID) error {
+	if s.versionsKeep <= 0 {
+		return nil
+	}
+
+	var orphans []orphan
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		orphans = nil
+		var file models.FileUpload
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "version").
+			First(&file, "id = ?", fileID).Error; err != nil {
+			return err
+		}
+
+		var versions []models.FileVersion
+		if err := tx.Where("file_id = ? AND version <> ?", fileID, file.Version).
+			Order("version DESC").
+			Offset(s.versionsKeep - 1).
+			Find(&versions).Error; err != nil {
+			return err
+		}
+		for _, version := range versions {
+			released, err := releaseVersion(tx, version)
+			if err != nil {
+				return err
+			}
+			orphans = append(orphans, released...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.deleteOrphans(ctx, orphans)
+	return nil
+}
+
+// promote makes a version the current content of a locked file
+func promote(tx *gorm.DB, file *models.FileUpload, version *models.FileVersion) error {
+	version.Promote(file)
+	now := time.Now()
+	file.UpdatedAt = &now
+	return tx.Model(file).Updates(map[string]interface{}{
+		"version":         file.Version,
+		"original_name":   file.OriginalName,
+		"content_type":    file.ContentType,
+		"size":            file.Size,
+		"width":           file.Width,
+		"height":          file.Height,
+		"storage_backend": file.StorageBackend,
+		"storage_key":     file.StorageKey,
+		"sha256":          file.SHA256,
+		"scan_status":     file.ScanStatus,
+		"scan_signature":  file.ScanSignature,
+		"scanned_at":      file.ScannedAt,
+		"updated_at":      file.UpdatedAt,
+	}).Error
+}
@@ -0,0 +1,50 @@
+package workers
+
+import (
+	"authentication-app/config"
+	"authentication-app/internal/upload"
+	"context"
+	"time"
+
+	golog "github.com/luongwnv/go-log"
+)
+
+// Rescanner scans files that have no malware verdict yet and retries failed scans
+type Rescanner struct {
+	logger   golog.Logger
+	uploads  *upload.Service
+	interval time.Duration
+}
+
+func NewRescanner(cfg *config.Config, logger golog.Logger, uploads *upload.Service) *Rescanner {
+	return &Rescanner{
+		logger:   logger,
+		uploads:  uploads,
+		interval: time.Duration(cfg.ScanRetryIntervalMinutes) * time.Minute,
+	}
+}
+
+// Run scans once at startup and then on every interval until the context is cancelled
+func (r *Rescanner) Run(ctx context.Context) {
+	if r.interval <= 0 {
+		r.logger.Warn("Rescanner disabled, SCAN_RETRY_INTERVAL_MINUTES must be positive")
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if scanned, err := r.uploads.ScanPending(ctx); err != nil && ctx.Err() == nil {
+			r.logger.Errorf("Malware rescan failed: %v", err)
+		} else if scanned > 0 {
+			r.logger.Infof("Scanned %d files for malware", scanned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
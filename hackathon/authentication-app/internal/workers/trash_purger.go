@@ -0,0 +1,103 @@
+package workers
+
+import (
+	"authentication-app/config"
+	"authentication-app/internal/models"
+	"authentication-app/internal/upload"
+	"context"
+	"time"
+
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+)
+
+const trashPurgeBatchSize = 100
+
+// TrashPurger permanently removes files and folders that have been in the trash longer than the
+// retention period
+type TrashPurger struct {
+	logger    golog.Logger
+	db        *gorm.DB
+	uploads   *upload.Service
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewTrashPurger(cfg *config.Config, logger golog.Logger, db *gorm.DB, uploads *upload.Service) *TrashPurger {
+	return &TrashPurger{
+		logger:    logger,
+		db:        db,
+		uploads:   uploads,
+		retention: time.Duration(cfg.TrashRetentionHours) * time.Hour,
+		interval:  time.Duration(cfg.TrashPurgeIntervalMinutes) * time.Minute,
+	}
+}
+
+// Run purges once at startup and then on every interval until the context is cancelled
+func (p *TrashPurger) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		p.logger.Warn("Trash purger disabled, TRASH_PURGE_INTERVAL_MINUTES must be positive")
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := p.PurgeExpired(ctx); err != nil {
+			p.logger.Errorf("Trash purge failed: %v", err)
+		} else if purged > 0 {
+			p.logger.Infof("Purged %d files from the trash", purged)
+		}
+		if purged, err := p.PurgeExpiredFolders(ctx); err != nil {
+			p.logger.Errorf("Folder trash purge failed: %v", err)
+		} else if purged > 0 {
+			p.logger.Infof("Purged %d folders from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired deletes every file trashed before the retention cutoff, along with its bytes once no
+// other file shares them
+func (p *TrashPurger) PurgeExpired(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-p.retention)
+	purged := 0
+
+	for {
+		var files []models.FileUpload
+		if err := p.db.WithContext(ctx).Unscoped().
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Order("deleted_at").
+			Limit(trashPurgeBatchSize).
+			Find(&files).Error; err != nil {
+			return purged, err
+		}
+
+		for _, file := range files {
+			if err := p.uploads.Release(ctx, file); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(files) < trashPurgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// PurgeExpiredFolders deletes every folder trashed before the retention cutoff. It runs after
+// PurgeExpired: the files trashed with a folder share its deletion time, so they are gone by then.
+func (p *TrashPurger) PurgeExpiredFolders(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-p.retention)
+	result := p.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Delete(&models.Folder{})
+	return result.RowsAffected, result.Error
+}
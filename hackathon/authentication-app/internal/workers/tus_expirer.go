@@ -0,0 +1,50 @@
+package workers
+
+import (
+	"authentication-app/config"
+	"authentication-app/internal/upload"
+	"context"
+	"time"
+
+	golog "github.com/luongwnv/go-log"
+)
+
+// TusExpirer removes resumable uploads, and their stored chunks, once they have expired
+type TusExpirer struct {
+	logger   golog.Logger
+	uploads  *upload.Service
+	interval time.Duration
+}
+
+func NewTusExpirer(cfg *config.Config, logger golog.Logger, uploads *upload.Service) *TusExpirer {
+	return &TusExpirer{
+		logger:   logger,
+		uploads:  uploads,
+		interval: time.Duration(cfg.TusCleanupIntervalMinutes) * time.Minute,
+	}
+}
+
+// Run cleans up once at startup and then on every interval until the context is cancelled
+func (e *TusExpirer) Run(ctx context.Context) {
+	if e.interval <= 0 {
+		e.logger.Warn("Tus expirer disabled, TUS_CLEANUP_INTERVAL_MINUTES must be positive")
+		return
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := e.uploads.PurgeExpiredResumable(ctx); err != nil {
+			e.logger.Errorf("Expired upload cleanup failed: %v", err)
+		} else if purged > 0 {
+			e.logger.Infof("Removed %d expired resumable uploads", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
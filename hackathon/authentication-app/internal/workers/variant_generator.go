@@ -0,0 +1,246 @@
+package workers
+
+import (
+	"authentication-app/config"
+	"authentication-app/internal/models"
+	"authentication-app/pkg/imaging"
+	"authentication-app/pkg/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	golog "github.com/luongwnv/go-log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const variantBackfillBatchSize = 100
+
+// VariantGenerator renders the configured image variants of uploads on a pool of workers. Uploads
+// are queued as they arrive; files that were missed, because the queue was full or the server
+// stopped, are picked up by a backfill at startup.
+type VariantGenerator struct {
+	logger    golog.Logger
+	db        *gorm.DB
+	storage   *storage.Registry
+	variants  []imaging.Variant
+	workers   int
+	maxPixels int64
+	jobs      chan uuid.UUID
+}
+
+func NewVariantGenerator(cfg *config.Config, logger golog.Logger, db *gorm.DB, storage *storage.Registry) (*VariantGenerator, error) {
+	variants, err := imaging.ParseVariants(cfg.ImageVariants)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VariantGenerator{
+		logger:    logger,
+		db:        db,
+		storage:   storage,
+		variants:  variants,
+		workers:   cfg.ImageWorkers,
+		maxPixels: cfg.ImageMaxPixels,
+		jobs:      make(chan uuid.UUID, max(cfg.ImageQueueSize, 1)),
+	}, nil
+}
+
+// Enqueue schedules variant generation for a file without blocking. When the queue is full the
+// file is left to the next backfill.
+func (g *VariantGenerator) Enqueue(fileID uuid.UUID) {
+	if len(g.variants) == 0 {
+		return
+	}
+
+	select {
+	case g.jobs <- fileID:
+	default:
+		g.logger.Warnf("Variant queue full, file %s is left to the next backfill", fileID)
+	}
+}
+
+// Run starts the workers, backfills missing variants and blocks until the context is cancelled
+func (g *VariantGenerator) Run(ctx context.Context) {
+	if len(g.variants) == 0 {
+		return
+	}
+	if g.workers <= 0 {
+		g.logger.Warn("Variant generator disabled, IMAGE_WORKERS must be positive")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < g.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.work(ctx)
+		}()
+	}
+
+	if err := g.Backfill(ctx); err != nil && ctx.Err() == nil {
+		g.logger.Errorf("Variant backfill failed: %v", err)
+	}
+	wg.Wait()
+}
+
+func (g *VariantGenerator) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case fileID := <-g.jobs:
+			if err := g.Generate(ctx, fileID); err != nil {
+				g.logger.Errorf("Failed to generate variants of file %s: %v", fileID, err)
+			}
+		}
+	}
+}
+
+// Backfill queues every image that is missing one of the configured variants
+func (g *VariantGenerator) Backfill(ctx context.Context) error {
+	names := make([]string, len(g.variants))
+	for i, variant := range g.variants {
+		names[i] = variant.Name
+	}
+
+	lastID := uuid.Nil
+	for {
+		var fileIDs []uuid.UUID
+		if err := g.db.WithContext(ctx).Model(&models.FileUpload{}).
+			Where("content_type IN ?", imaging.ContentTypes).
+			Where("scan_status <> ?", models.ScanStatusInfected).
+			Where(`(SELECT COUNT(*) FROM "authentication-app"."file_variants" v WHERE v.file_id = file_uploads.id AND v.name IN ?) < ?`, names, len(names)).
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(variantBackfillBatchSize).
+			Pluck("id", &fileIDs).Error; err != nil {
+			return err
+		}
+
+		for _, fileID := range fileIDs {
+			select {
+			case g.jobs <- fileID:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if len(fileIDs) < variantBackfillBatchSize {
+			return nil
+		}
+		lastID = fileIDs[len(fileIDs)-1]
+	}
+}
+
+// Generate renders the variants a file does not have yet. Trashed, purged and quarantined files
+// are skipped.
+func (g *VariantGenerator) Generate(ctx context.Context, fileID uuid.UUID) error {
+	var file models.FileUpload
+	if err := g.db.WithContext(ctx).Preload("Variants").First(&file, "id = ?", fileID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if !imaging.Supports(file.ContentType) || file.ScanStatus == models.ScanStatusInfected {
+		return nil
+	}
+
+	existing := make(map[string]bool, len(file.Variants))
+	for _, variant := range file.Variants {
+		existing[variant.Name] = true
+	}
+	var missing []imaging.Variant
+	for _, variant := range g.variants {
+		if !existing[variant.Name] {
+			missing = append(missing, variant)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	source, err := g.storage.Backend(file.StorageBackend)
+	if err != nil {
+		return err
+	}
+	src, err := source.Get(ctx, file.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	img, format, err := imaging.Decode(src, g.maxPixels)
+	if err != nil {
+		return fmt.Errorf("decode image: %w", err)
+	}
+
+	for _, variant := range missing {
+		if err := g.render(ctx, &file, img, format, variant); err != nil {
+			return fmt.Errorf("render variant %s: %w", variant.Name, err)
+		}
+	}
+	return nil
+}
+
+func (g *VariantGenerator) render(ctx context.Context, file *models.FileUpload, img image.Image, sourceFormat string, variant imaging.Variant) error {
+	resized := imaging.Fit(img, variant.Size)
+	format := imaging.OutputFormat(variant, sourceFormat)
+
+	var buf bytes.Buffer
+	contentType, err := imaging.Encode(&buf, resized, format)
+	if err != nil {
+		return err
+	}
+
+	backend := g.storage.Primary()
+	// Keys are per version, so variants of replaced content never overwrite those of the current one
+	key := fmt.Sprintf("variants/%s/%d/%s%s", file.ID, file.Version, variant.Name, imaging.Extension(format))
+	size := int64(buf.Len())
+	if err := backend.Put(ctx, key, &buf, size, contentType); err != nil {
+		return err
+	}
+
+	bounds := resized.Bounds()
+	fileVariant := models.FileVariant{
+		ID:             uuid.New(),
+		FileID:         file.ID,
+		Name:           variant.Name,
+		ContentType:    contentType,
+		Width:          bounds.Dx(),
+		Height:         bounds.Dy(),
+		Size:           size,
+		StorageBackend: backend.Name(),
+		StorageKey:     key,
+		CreatedAt:      time.Now(),
+	}
+	err = g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The shared lock keeps a new version from replacing the content until the variant is recorded
+		var current models.FileUpload
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "SHARE"}).
+			Select("id").
+			First(&current, "id = ? AND version = ?", file.ID, file.Version).Error; err != nil {
+			return err
+		}
+		// A concurrent run may have recorded the same variant already; it wrote the same key
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&fileVariant).Error
+	})
+	if err != nil {
+		// The file was purged or got a new version while rendering
+		if deleteErr := backend.Delete(context.WithoutCancel(ctx), key); deleteErr != nil {
+			g.logger.Errorf("Failed to remove orphaned variant %s: %v", key, deleteErr)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+-- Track which authentication backend owns each user
+ALTER TABLE "authentication-app"."users"
+    ADD COLUMN IF NOT EXISTS auth_source VARCHAR(32) NOT NULL DEFAULT 'local',
+    ADD COLUMN IF NOT EXISTS role VARCHAR(64) NOT NULL DEFAULT 'user';
+
+-- Create index on auth_source
+CREATE INDEX IF NOT EXISTS idx_users_auth_source ON "authentication-app"."users" (auth_source);
@@ -0,0 +1,38 @@
+-- Create webauthn_credentials table
+CREATE TABLE IF NOT EXISTS "authentication-app"."webauthn_credentials" (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    attestation_type VARCHAR(64) NOT NULL DEFAULT '',
+    transports VARCHAR(255) NOT NULL DEFAULT '',
+    aaguid BYTEA NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    clone_warning BOOLEAN NOT NULL DEFAULT FALSE,
+    user_present BOOLEAN NOT NULL DEFAULT FALSE,
+    user_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES "authentication-app"."users" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for webauthn_credentials
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON "authentication-app"."webauthn_credentials" (user_id);
+
+-- Create webauthn_sessions table holding in-flight registration and login ceremonies
+CREATE TABLE IF NOT EXISTS "authentication-app"."webauthn_sessions" (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NULL,
+    ceremony VARCHAR(32) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    data JSONB NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES "authentication-app"."users" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for webauthn_sessions
+CREATE INDEX IF NOT EXISTS idx_webauthn_sessions_expires_at ON "authentication-app"."webauthn_sessions" (expires_at);
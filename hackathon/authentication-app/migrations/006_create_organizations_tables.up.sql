@@ -0,0 +1,50 @@
+-- Create organizations table
+CREATE TABLE IF NOT EXISTS "authentication-app"."organizations" (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    created_by UUID NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NULL,
+    FOREIGN KEY (created_by) REFERENCES "authentication-app"."users" (id) ON DELETE SET NULL
+);
+
+-- Create organization_memberships table
+CREATE TABLE IF NOT EXISTS "authentication-app"."organization_memberships" (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NULL,
+    FOREIGN KEY (organization_id) REFERENCES "authentication-app"."organizations" (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES "authentication-app"."users" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for organization_memberships
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organization_memberships_org_user ON "authentication-app"."organization_memberships" (organization_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_organization_memberships_user_id ON "authentication-app"."organization_memberships" (user_id);
+
+-- Create organization_invitations table
+CREATE TABLE IF NOT EXISTS "authentication-app"."organization_invitations" (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    invited_by UUID NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    responded_at TIMESTAMP NULL,
+    FOREIGN KEY (organization_id) REFERENCES "authentication-app"."organizations" (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES "authentication-app"."users" (id) ON DELETE CASCADE,
+    FOREIGN KEY (invited_by) REFERENCES "authentication-app"."users" (id) ON DELETE SET NULL
+);
+
+-- Only one pending invitation per user and organization
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organization_invitations_pending ON "authentication-app"."organization_invitations" (organization_id, user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_organization_invitations_user_id ON "authentication-app"."organization_invitations" (user_id);
+
+-- Let uploads belong to an organization
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS organization_id UUID NULL REFERENCES "authentication-app"."organizations" (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_file_uploads_organization_id ON "authentication-app"."file_uploads" (organization_id);
@@ -0,0 +1,35 @@
+-- Attributes managed by SCIM provisioning
+ALTER TABLE "authentication-app"."users"
+    ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN IF NOT EXISTS external_id VARCHAR(255) NULL,
+    ADD COLUMN IF NOT EXISTS display_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS email VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMPTZ NULL;
+
+-- Create index on external_id
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id ON "authentication-app"."users" (external_id) WHERE external_id IS NOT NULL;
+
+-- Create groups table
+CREATE TABLE IF NOT EXISTS "authentication-app"."groups" (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    display_name VARCHAR(255) NOT NULL UNIQUE,
+    external_id VARCHAR(255) NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NULL
+);
+
+-- Create index on external_id
+CREATE UNIQUE INDEX IF NOT EXISTS idx_groups_external_id ON "authentication-app"."groups" (external_id) WHERE external_id IS NOT NULL;
+
+-- Create group_members table
+CREATE TABLE IF NOT EXISTS "authentication-app"."group_members" (
+    group_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES "authentication-app"."groups" (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES "authentication-app"."users" (id) ON DELETE CASCADE
+);
+
+-- Create index on user_id
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON "authentication-app"."group_members" (user_id);
@@ -0,0 +1,6 @@
+-- Deleted files stay in the trash until the purger removes them
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+
+-- Create index on deleted_at
+CREATE INDEX IF NOT EXISTS idx_file_uploads_deleted_at ON "authentication-app"."file_uploads" (deleted_at);
@@ -0,0 +1,16 @@
+-- Record which storage backend and key hold each upload
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS storage_backend VARCHAR(32) NOT NULL DEFAULT 'local',
+    ADD COLUMN IF NOT EXISTS storage_key VARCHAR(500) NULL;
+
+-- Existing uploads were written by the local backend directly below its root
+UPDATE "authentication-app"."file_uploads"
+SET storage_key = filename
+WHERE storage_key IS NULL;
+
+ALTER TABLE "authentication-app"."file_uploads"
+    ALTER COLUMN storage_key SET NOT NULL,
+    DROP COLUMN IF EXISTS file_path;
+
+-- Create index on the storage location
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_uploads_storage_location ON "authentication-app"."file_uploads" (storage_backend, storage_key);
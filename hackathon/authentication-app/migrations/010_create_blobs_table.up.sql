@@ -0,0 +1,20 @@
+-- Content-addressed objects shared by every upload with the same bytes
+CREATE TABLE IF NOT EXISTS "authentication-app"."blobs" (
+    sha256 CHAR(64) PRIMARY KEY,
+    storage_backend VARCHAR(32) NOT NULL,
+    storage_key VARCHAR(500) NOT NULL,
+    size BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0 CHECK (ref_count >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Uploads made before deduplication keep their own object and have no hash
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS sha256 CHAR(64) NULL REFERENCES "authentication-app"."blobs"(sha256);
+
+-- Several uploads now share one storage location
+DROP INDEX IF EXISTS "authentication-app"."idx_file_uploads_storage_location";
+CREATE INDEX IF NOT EXISTS idx_file_uploads_storage_location ON "authentication-app"."file_uploads" (storage_backend, storage_key);
+
+-- Create index on the content hash
+CREATE INDEX IF NOT EXISTS idx_file_uploads_sha256 ON "authentication-app"."file_uploads" (sha256);
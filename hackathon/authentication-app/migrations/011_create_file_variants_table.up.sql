@@ -0,0 +1,14 @@
+-- Create file_variants table for derived images such as thumbnails
+CREATE TABLE IF NOT EXISTS "authentication-app"."file_variants" (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL REFERENCES "authentication-app"."file_uploads"(id) ON DELETE CASCADE,
+    name VARCHAR(32) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size BIGINT NOT NULL,
+    storage_backend VARCHAR(32) NOT NULL,
+    storage_key VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (file_id, name)
+);
@@ -0,0 +1,4 @@
+-- Displayed width and height of uploaded images, NULL for other files
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS width INTEGER NULL,
+    ADD COLUMN IF NOT EXISTS height INTEGER NULL;
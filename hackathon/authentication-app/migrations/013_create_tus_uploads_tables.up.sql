@@ -0,0 +1,34 @@
+-- Create tus_uploads table for resumable uploads in progress
+CREATE TABLE IF NOT EXISTS "authentication-app"."tus_uploads" (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    organization_id UUID NULL,
+    length BIGINT NOT NULL CHECK (length > 0),
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    metadata TEXT NOT NULL DEFAULT '',
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    file_id UUID NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES "authentication-app"."users" (id) ON DELETE CASCADE,
+    FOREIGN KEY (organization_id) REFERENCES "authentication-app"."organizations" (id) ON DELETE CASCADE,
+    FOREIGN KEY (file_id) REFERENCES "authentication-app"."file_uploads" (id) ON DELETE SET NULL
+);
+
+-- Create indexes for tus_uploads
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_user_id ON "authentication-app"."tus_uploads" (user_id);
+CREATE INDEX IF NOT EXISTS idx_tus_uploads_expires_at ON "authentication-app"."tus_uploads" (expires_at);
+
+-- Create tus_upload_parts table, one row per stored chunk
+CREATE TABLE IF NOT EXISTS "authentication-app"."tus_upload_parts" (
+    upload_id UUID NOT NULL,
+    upload_offset BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    storage_backend VARCHAR(32) NOT NULL,
+    storage_key VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (upload_id, upload_offset),
+    FOREIGN KEY (upload_id) REFERENCES "authentication-app"."tus_uploads" (id) ON DELETE CASCADE
+);
@@ -0,0 +1,20 @@
+-- Create file_shares table for public share links
+CREATE TABLE IF NOT EXISTS "authentication-app"."file_shares" (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL,
+    created_by UUID NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    password_hash VARCHAR(255) NULL,
+    expires_at TIMESTAMP NULL,
+    max_downloads INTEGER NULL CHECK (max_downloads > 0),
+    download_count INTEGER NOT NULL DEFAULT 0,
+    last_downloaded_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (file_id) REFERENCES "authentication-app"."file_uploads" (id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES "authentication-app"."users" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for file_shares
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_shares_token_hash ON "authentication-app"."file_shares" (token_hash);
+CREATE INDEX IF NOT EXISTS idx_file_shares_file_id ON "authentication-app"."file_shares" (file_id);
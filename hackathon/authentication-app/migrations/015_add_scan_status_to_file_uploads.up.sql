@@ -0,0 +1,8 @@
+-- Malware scan verdict of each file: pending, clean, infected or error
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS scan_status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    ADD COLUMN IF NOT EXISTS scan_signature VARCHAR(255) NULL,
+    ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMP NULL;
+
+-- Files awaiting a scan, or a retry after a failed one, are looked up by status
+CREATE INDEX IF NOT EXISTS idx_file_uploads_scan_status ON "authentication-app"."file_uploads" (scan_status) WHERE scan_status IN ('pending', 'error');
@@ -0,0 +1,38 @@
+-- Create folders table for organising uploads into a hierarchy
+CREATE TABLE IF NOT EXISTS "authentication-app"."folders" (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    organization_id UUID NULL,
+    parent_id UUID NULL,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NULL,
+    deleted_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES "authentication-app"."users" (id) ON DELETE CASCADE,
+    FOREIGN KEY (organization_id) REFERENCES "authentication-app"."organizations" (id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES "authentication-app"."folders" (id) ON DELETE CASCADE
+);
+
+-- Create indexes for folders
+CREATE INDEX IF NOT EXISTS idx_folders_user_id ON "authentication-app"."folders" (user_id);
+CREATE INDEX IF NOT EXISTS idx_folders_organization_id ON "authentication-app"."folders" (organization_id);
+CREATE INDEX IF NOT EXISTS idx_folders_parent_id ON "authentication-app"."folders" (parent_id);
+CREATE INDEX IF NOT EXISTS idx_folders_deleted_at ON "authentication-app"."folders" (deleted_at);
+
+-- Sibling names are unique per tenant, ignoring case; the tenant is the organization, or the user
+-- for personal folders. Trashed folders do not count.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_sibling_name ON "authentication-app"."folders" (
+    COALESCE(organization_id, user_id),
+    COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'),
+    LOWER(name)
+) WHERE deleted_at IS NULL;
+
+-- Files live in a folder, or at the top level when folder_id is NULL
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS folder_id UUID NULL REFERENCES "authentication-app"."folders" (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_file_uploads_folder_id ON "authentication-app"."file_uploads" (folder_id);
+
+-- Resumable uploads remember the folder they were started in
+ALTER TABLE "authentication-app"."tus_uploads"
+    ADD COLUMN IF NOT EXISTS folder_id UUID NULL REFERENCES "authentication-app"."folders" (id) ON DELETE SET NULL;
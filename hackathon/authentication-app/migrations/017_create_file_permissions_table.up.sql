@@ -0,0 +1,17 @@
+-- Create file_permissions table for granting other users access to single files
+CREATE TABLE IF NOT EXISTS "authentication-app"."file_permissions" (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    permission VARCHAR(16) NOT NULL CHECK (permission IN ('read', 'write')),
+    granted_by UUID NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NULL,
+    FOREIGN KEY (file_id) REFERENCES "authentication-app"."file_uploads" (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES "authentication-app"."users" (id) ON DELETE CASCADE,
+    FOREIGN KEY (granted_by) REFERENCES "authentication-app"."users" (id) ON DELETE SET NULL
+);
+
+-- Create indexes for file_permissions
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_permissions_file_user ON "authentication-app"."file_permissions" (file_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_file_permissions_user_id ON "authentication-app"."file_permissions" (user_id, created_at DESC);
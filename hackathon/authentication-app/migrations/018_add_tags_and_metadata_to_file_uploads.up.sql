@@ -0,0 +1,18 @@
+-- User-defined tags, as a JSON array of strings, and free-form key/value metadata of each file
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+-- Full-text search document: the original name, split on punctuation so that "IMG_0042.jpg" matches
+-- "img" and "0042", weighted above the tags. The simple configuration neither stems nor drops
+-- stop words, which suits file names.
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', regexp_replace(original_name, '[^[:alnum:]]+', ' ', 'g')), 'A') ||
+        setweight(jsonb_to_tsvector('simple', tags, '["string"]'), 'B')
+    ) STORED;
+
+-- Create indexes for search and for tag and metadata containment filters
+CREATE INDEX IF NOT EXISTS idx_file_uploads_search_vector ON "authentication-app"."file_uploads" USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_file_uploads_tags ON "authentication-app"."file_uploads" USING GIN (tags jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_file_uploads_metadata ON "authentication-app"."file_uploads" USING GIN (metadata jsonb_path_ops);
@@ -0,0 +1,42 @@
+-- Create file_versions table for the content history of each file. The file row mirrors its
+-- current version; every version holds one reference to its blob.
+CREATE TABLE IF NOT EXISTS "authentication-app"."file_versions" (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    file_id UUID NOT NULL,
+    version INTEGER NOT NULL,
+    original_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    width INTEGER NULL,
+    height INTEGER NULL,
+    storage_backend VARCHAR(32) NOT NULL,
+    storage_key VARCHAR(500) NOT NULL,
+    sha256 CHAR(64) NULL REFERENCES "authentication-app"."blobs" (sha256),
+    scan_status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    scan_signature VARCHAR(255) NULL,
+    scanned_at TIMESTAMP NULL,
+    uploaded_by UUID NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (file_id) REFERENCES "authentication-app"."file_uploads" (id) ON DELETE CASCADE,
+    FOREIGN KEY (uploaded_by) REFERENCES "authentication-app"."users" (id) ON DELETE SET NULL
+);
+
+-- Create indexes for file_versions
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_versions_file_version ON "authentication-app"."file_versions" (file_id, version);
+CREATE INDEX IF NOT EXISTS idx_file_versions_uploaded_by ON "authentication-app"."file_versions" (uploaded_by);
+CREATE INDEX IF NOT EXISTS idx_file_versions_storage ON "authentication-app"."file_versions" (storage_backend, storage_key);
+CREATE INDEX IF NOT EXISTS idx_file_versions_scan_status ON "authentication-app"."file_versions" (scan_status) WHERE scan_status IN ('pending', 'error');
+
+-- The number of the version a file currently serves
+ALTER TABLE "authentication-app"."file_uploads"
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- Existing files become their own first version, which takes over their blob reference
+INSERT INTO "authentication-app"."file_versions" (
+    id, file_id, version, original_name, content_type, size, width, height, storage_backend,
+    storage_key, sha256, scan_status, scan_signature, scanned_at, uploaded_by, created_at
+)
+SELECT uuid_generate_v4(), id, 1, original_name, content_type, size, width, height, storage_backend,
+    storage_key, sha256, scan_status, scan_signature, scanned_at, user_id, created_at
+FROM "authentication-app"."file_uploads"
+ON CONFLICT DO NOTHING;
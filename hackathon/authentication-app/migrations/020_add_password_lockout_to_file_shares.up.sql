@@ -0,0 +1,4 @@
+-- Failed password attempts on a share link, which lock it for a while once too many pile up
+ALTER TABLE "authentication-app"."file_shares"
+    ADD COLUMN IF NOT EXISTS failed_password_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS password_locked_until TIMESTAMP NULL;
@@ -0,0 +1,178 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+	FormatWebP = "webp"
+
+	jpegQuality = 85
+)
+
+// ContentTypes lists the image types that can be decoded
+var ContentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// ErrTooLarge is returned for images whose pixel count exceeds the decoding limit
+var ErrTooLarge = errors.New("imaging: image exceeds the pixel limit")
+
+var variantNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Variant describes a derived image that fits within Size x Size pixels. An empty Format keeps
+// the format of the original.
+type Variant struct {
+	Name   string
+	Size   int
+	Format string
+}
+
+// ParseVariants reads "name:size[:format]" entries separated by commas, for example
+// "thumb:128,thumb_webp:128:webp"
+func ParseVariants(value string) ([]Variant, error) {
+	var variants []Variant
+	seen := make(map[string]bool)
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid image variant %q, expected name:size[:format]", entry)
+		}
+
+		variant := Variant{Name: strings.TrimSpace(parts[0])}
+		if !variantNamePattern.MatchString(variant.Name) {
+			return nil, fmt.Errorf("invalid image variant name %q", variant.Name)
+		}
+		if seen[variant.Name] {
+			return nil, fmt.Errorf("duplicate image variant %q", variant.Name)
+		}
+		seen[variant.Name] = true
+
+		size, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid size for image variant %q", variant.Name)
+		}
+		variant.Size = size
+
+		if len(parts) == 3 {
+			variant.Format = strings.ToLower(strings.TrimSpace(parts[2]))
+			if variant.Format != FormatJPEG && variant.Format != FormatPNG && variant.Format != FormatWebP {
+				return nil, fmt.Errorf("unsupported format %q for image variant %q", parts[2], variant.Name)
+			}
+		}
+
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+// Decode reads an image, refusing to allocate anything larger than maxPixels. It returns the
+// image, turned upright according to its EXIF orientation, and its format name.
+func Decode(r io.Reader, maxPixels int64) (image.Image, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if maxPixels > 0 && int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	return Orient(img, Orientation(data, format)), format, nil
+}
+
+// Fit scales img down to fit within size x size, keeping its aspect ratio. Smaller images are
+// returned unchanged.
+func Fit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// OutputFormat resolves the format a variant is encoded in. GIF sources become PNG, as only the
+// first frame survives resizing anyway.
+func OutputFormat(variant Variant, sourceFormat string) string {
+	format := variant.Format
+	if format == "" {
+		format = sourceFormat
+	}
+	if format == FormatGIF {
+		return FormatPNG
+	}
+	return format
+}
+
+// Encode writes img in the given format and returns its content type
+func Encode(w io.Writer, img image.Image, format string) (string, error) {
+	switch format {
+	case FormatJPEG:
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case FormatPNG:
+		return "image/png", png.Encode(w, img)
+	case FormatWebP:
+		return "image/webp", nativewebp.Encode(w, img, nil)
+	default:
+		return "", fmt.Errorf("imaging: unsupported format %q", format)
+	}
+}
+
+// Extension returns the file name extension for a format
+func Extension(format string) string {
+	if format == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// Supports reports whether variants can be rendered from content of the given type
+func Supports(contentType string) bool {
+	for _, supported := range ContentTypes {
+		if supported == contentType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,481 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// ErrMalformed is returned when the container structure of an image cannot be parsed
+var ErrMalformed = errors.New("imaging: malformed image structure")
+
+var (
+	exifHeader   = []byte("Exif\x00\x00")
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// PNG chunks carrying metadata rather than pixels
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"iCCP": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// WebP chunks carrying metadata, and the VP8X flags announcing them
+var webpMetadataChunks = map[string]bool{
+	"ICCP": true,
+	"EXIF": true,
+	"XMP ": true,
+}
+
+const webpMetadataFlags = 0x20 | 0x08 | 0x04
+
+// FormatOf maps a supported image content type to its format name
+func FormatOf(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return FormatJPEG
+	case "image/png":
+		return FormatPNG
+	case "image/gif":
+		return FormatGIF
+	case "image/webp":
+		return FormatWebP
+	default:
+		return ""
+	}
+}
+
+// maxExifSize bounds the bytes of an EXIF block Inspect reads. The orientation sits in its first
+// directory, and a JPEG segment cannot be larger anyway.
+const maxExifSize = 64 * 1024
+
+// Inspection is what Inspect learns from the structure of an encoded image
+type Inspection struct {
+	// Orientation is the EXIF orientation, 1 when the image has none
+	Orientation int
+	// Metadata is the number of bytes Strip removes from the image
+	Metadata int64
+}
+
+// Inspect reads the structure of an encoded image without decoding its pixels: its EXIF
+// orientation and how much of it is metadata. Only the start of the EXIF block is held in memory,
+// however large the image. A JPEG is read up to its image data, other formats to their end. With
+// ErrMalformed it returns what it found before the structure broke.
+func Inspect(r io.Reader, format string) (Inspection, error) {
+	inspection := Inspection{Orientation: 1}
+	var exif []byte
+	readExif := func(payload io.Reader, prefix []byte) error {
+		data, err := io.ReadAll(io.LimitReader(payload, maxExifSize))
+		if err != nil {
+			return err
+		}
+		exif = bytes.TrimPrefix(data, prefix)
+		return nil
+	}
+
+	var err error
+	switch format {
+	case FormatJPEG:
+		_, err = readJPEG(bufio.NewReader(r), func(marker byte, payload *io.LimitedReader) error {
+			if jpegMetadataMarker(marker) {
+				inspection.Metadata += 4 + payload.N
+			}
+			if marker != 0xE1 || exif != nil {
+				return nil
+			}
+			// Only an APP1 segment starting with the EXIF header holds EXIF
+			header := make([]byte, len(exifHeader))
+			n, err := io.ReadFull(payload, header)
+			if err != nil || !bytes.Equal(header[:n], exifHeader) {
+				return nil
+			}
+			return readExif(payload, nil)
+		})
+	case FormatPNG:
+		err = readPNG(r, func(chunkType string, length int64, chunk *io.LimitedReader) error {
+			if pngMetadataChunks[chunkType] {
+				inspection.Metadata += 12 + length
+			}
+			if chunkType != "eXIf" {
+				return nil
+			}
+			return readExif(io.LimitReader(chunk, length), nil)
+		})
+	case FormatWebP:
+		err = readWebP(r, func(fourCC string, payload *io.LimitedReader) error {
+			if webpMetadataChunks[fourCC] {
+				inspection.Metadata += 8 + payload.N + payload.N%2
+			}
+			if fourCC != "EXIF" {
+				return nil
+			}
+			return readExif(payload, exifHeader)
+		})
+	}
+	inspection.Orientation = exifOrientation(exif)
+	return inspection, err
+}
+
+// Strip copies an encoded image from r to w without its EXIF, XMP, ICC and comment metadata,
+// leaving its pixels untouched, and holds no more than a chunk header in memory. size is the
+// length of the result, the image's length less the Metadata Inspect reports, which a WebP
+// records in its header. GIF images are copied as they are.
+func Strip(w io.Writer, r io.Reader, format string, size int64) error {
+	switch format {
+	case FormatJPEG:
+		return stripJPEG(w, r)
+	case FormatPNG:
+		return stripPNG(w, r)
+	case FormatWebP:
+		return stripWebP(w, r, size)
+	default:
+		_, err := io.Copy(w, r)
+		return err
+	}
+}
+
+// Upright decodes an image stored with an EXIF orientation, turns it upright and encodes it again
+// without metadata, since dropping the tag alone would display it rotated. Like Decode it refuses
+// an image of more than maxPixels before decoding its pixels, which are then held in memory.
+func Upright(w io.Writer, r io.Reader, format string, orientation int, maxPixels int64) error {
+	// Only the header is buffered, to be decoded again with the pixels
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return err
+	}
+	if maxPixels > 0 && int64(config.Width)*int64(config.Height) > maxPixels {
+		return ErrTooLarge
+	}
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return err
+	}
+
+	// The encoders write no metadata of their own
+	_, err = Encode(w, Orient(img, orientation), format)
+	return err
+}
+
+// Orientation returns the EXIF orientation (1 to 8) of an encoded image, 1 when it has none
+func Orientation(data []byte, format string) int {
+	inspection, _ := Inspect(bytes.NewReader(data), format)
+	return inspection.Orientation
+}
+
+// OrientedSize returns the displayed size of an image with the given orientation
+func OrientedSize(width, height, orientation int) (int, int) {
+	if orientation >= 5 && orientation <= 8 {
+		return height, width
+	}
+	return width, height
+}
+
+// Orient turns an image stored with an EXIF orientation upright
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := OrientedSize(w, h, orientation)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs a 90 degree clockwise turn
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs a 90 degree counter-clockwise turn
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// exifOrientation reads the orientation tag from IFD0 of a TIFF-structured EXIF block
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// Tag 0x0112 is the orientation, stored as a SHORT in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// readJPEG calls fn with every marker segment before the image data and a reader of its payload;
+// what fn leaves of a payload is skipped. It returns the marker that ends the walk, start of scan
+// or end of image, which has been read from r.
+func readJPEG(r *bufio.Reader, fn func(marker byte, payload *io.LimitedReader) error) (byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return 0, malformed(err)
+	}
+	if soi[0] != 0xFF || soi[1] != 0xD8 {
+		return 0, ErrMalformed
+	}
+
+	for {
+		prefix, err := r.ReadByte()
+		if err != nil {
+			return 0, malformed(err)
+		}
+		if prefix != 0xFF {
+			return 0, ErrMalformed
+		}
+		marker, err := r.ReadByte()
+		if err != nil {
+			return 0, malformed(err)
+		}
+		switch {
+		case marker == 0xFF: // fill byte
+			r.UnreadByte()
+			continue
+		case marker == 0xDA || marker == 0xD9: // start of scan, end of image
+			return marker, nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // no length
+			continue
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return 0, malformed(err)
+		}
+		size := int64(binary.BigEndian.Uint16(length[:]))
+		if size < 2 {
+			return 0, ErrMalformed
+		}
+		payload := &io.LimitedReader{R: r, N: size - 2}
+		if err := fn(marker, payload); err != nil {
+			return 0, err
+		}
+		if _, err := io.Copy(io.Discard, payload); err != nil {
+			return 0, err
+		}
+		if payload.N > 0 {
+			return 0, ErrMalformed
+		}
+	}
+}
+
+// jpegMetadataMarker reports whether a JPEG segment is metadata. The JFIF (APP0) and Adobe (APP14)
+// segments affect decoding and are kept; every other application segment (EXIF, XMP, ICC, IPTC,
+// ...) and comments are not.
+func jpegMetadataMarker(marker byte) bool {
+	isApp := marker >= 0xE0 && marker <= 0xEF
+	return (isApp && marker != 0xE0 && marker != 0xEE) || marker == 0xFE
+}
+
+func stripJPEG(w io.Writer, r io.Reader) error {
+	if _, err := w.Write([]byte{0xFF, 0xD8}); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	end, err := readJPEG(br, func(marker byte, payload *io.LimitedReader) error {
+		if jpegMetadataMarker(marker) {
+			return nil
+		}
+		header := binary.BigEndian.AppendUint16([]byte{0xFF, marker}, uint16(payload.N+2))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, payload)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// The image data is copied as it is
+	if _, err := w.Write([]byte{0xFF, end}); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, br)
+	return err
+}
+
+// readPNG calls fn with every chunk, its data length and a reader of its data and CRC; what fn
+// leaves of a chunk is skipped
+func readPNG(r io.Reader, fn func(chunkType string, length int64, chunk *io.LimitedReader) error) error {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return malformed(err)
+	}
+	if !bytes.Equal(signature, pngSignature) {
+		return ErrMalformed
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return malformed(err)
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		chunk := &io.LimitedReader{R: r, N: length + 4}
+		if err := fn(string(header[4:]), length, chunk); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, chunk); err != nil {
+			return err
+		}
+		if chunk.N > 0 {
+			return ErrMalformed
+		}
+	}
+}
+
+func stripPNG(w io.Writer, r io.Reader) error {
+	if _, err := w.Write(pngSignature); err != nil {
+		return err
+	}
+	return readPNG(r, func(chunkType string, length int64, chunk *io.LimitedReader) error {
+		if pngMetadataChunks[chunkType] {
+			return nil
+		}
+		// Chunks are copied whole, CRC included
+		header := binary.BigEndian.AppendUint32(nil, uint32(length))
+		if _, err := w.Write(append(header, chunkType...)); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, chunk)
+		return err
+	})
+}
+
+// readWebP calls fn with every chunk of a RIFF WebP file and a reader of its payload; what fn leaves
+// of a payload is skipped. Chunks of odd size must be followed by their padding byte.
+func readWebP(r io.Reader, fn func(fourCC string, payload *io.LimitedReader) error) error {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return malformed(err)
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return ErrMalformed
+	}
+
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return malformed(err)
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		payload := &io.LimitedReader{R: r, N: size + size%2}
+		if err := fn(string(chunk[:4]), &io.LimitedReader{R: payload, N: size}); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, payload); err != nil {
+			return err
+		}
+		if payload.N > 0 {
+			return ErrMalformed
+		}
+	}
+}
+
+func stripWebP(w io.Writer, r io.Reader, size int64) error {
+	header := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(size-8))...)
+	if _, err := w.Write(append(header, "WEBP"...)); err != nil {
+		return err
+	}
+
+	return readWebP(r, func(fourCC string, payload *io.LimitedReader) error {
+		if webpMetadataChunks[fourCC] {
+			return nil
+		}
+		padding := payload.N % 2
+		header := binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(payload.N))
+		if fourCC != "VP8X" || payload.N == 0 {
+			if _, err := w.Write(header); err != nil {
+				return err
+			}
+		} else {
+			// The flags announcing the metadata are cleared
+			flags, err := io.ReadAll(io.LimitReader(payload, 1))
+			if err != nil {
+				return err
+			}
+			if len(flags) == 0 {
+				return ErrMalformed
+			}
+			if _, err := w.Write(append(header, flags[0]&^webpMetadataFlags)); err != nil {
+				return err
+			}
+		}
+		if _, err := io.Copy(w, payload); err != nil {
+			return err
+		}
+		if padding == 1 {
+			_, err := w.Write([]byte{0})
+			return err
+		}
+		return nil
+	})
+}
+
+// malformed reports a read that ended early as ErrMalformed, and passes other errors through
+func malformed(err error) error {
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrMalformed
+	}
+	return err
+}
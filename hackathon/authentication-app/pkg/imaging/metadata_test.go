@@ -0,0 +1,299 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// exifWithOrientation builds a little-endian TIFF block whose first directory holds an orientation
+func exifWithOrientation(orientation uint16) []byte {
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)
+	return binary.LittleEndian.AppendUint32(tiff, 0)
+}
+
+// testImage is 4x2 pixels, red on the left half and blue on the right
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := binary.BigEndian.AppendUint16([]byte{0xFF, marker}, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testJPEG returns a JPEG with EXIF, XMP and comment segments inserted after its SOI, and the
+// number of bytes they take
+func testJPEG(t *testing.T, orientation uint16) ([]byte, int64) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	var metadata []byte
+	metadata = append(metadata, jpegSegment(0xE1, append(append([]byte(nil), exifHeader...), exifWithOrientation(orientation)...))...)
+	metadata = append(metadata, jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))...)
+	metadata = append(metadata, jpegSegment(0xFE, []byte("a comment"))...)
+
+	data := append([]byte{0xFF, 0xD8}, metadata...)
+	return append(data, encoded[2:]...), int64(len(metadata))
+}
+
+func pngChunk(chunkType string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// testPNG returns a PNG with eXIf and tEXt chunks inserted after its IHDR, and the number of bytes
+// they take
+func testPNG(t *testing.T, orientation uint16) ([]byte, int64) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	// The signature and the 25 bytes of IHDR
+	ihdrEnd := len(pngSignature) + 25
+
+	var metadata []byte
+	metadata = append(metadata, pngChunk("eXIf", exifWithOrientation(orientation))...)
+	metadata = append(metadata, pngChunk("tEXt", []byte("Comment\x00hello"))...)
+
+	data := append([]byte(nil), encoded[:ihdrEnd]...)
+	data = append(data, metadata...)
+	return append(data, encoded[ihdrEnd:]...), int64(len(metadata))
+}
+
+func webpChunk(fourCC string, payload []byte) []byte {
+	chunk := binary.LittleEndian.AppendUint32([]byte(fourCC), uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// testWebP returns the structure of an extended WebP, with made-up image data, whose VP8X flags
+// announce the EXIF and XMP chunks it carries, and the number of bytes those take
+func testWebP(orientation uint16) ([]byte, int64) {
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x08 | 0x04
+	exif := webpChunk("EXIF", append(append([]byte(nil), exifHeader...), exifWithOrientation(orientation)...))
+	xmp := webpChunk("XMP ", []byte("<x:xmpmeta/>x"))
+
+	body := []byte("WEBP")
+	body = append(body, webpChunk("VP8X", vp8x)...)
+	body = append(body, webpChunk("VP8L", []byte{1, 2, 3})...)
+	body = append(body, exif...)
+	body = append(body, xmp...)
+	data := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body)))
+	return append(data, body...), int64(len(exif) + len(xmp))
+}
+
+func TestInspect(t *testing.T) {
+	jpegData, jpegMetadata := testJPEG(t, 6)
+	pngData, pngMetadata := testPNG(t, 3)
+	webpData, webpMetadata := testWebP(8)
+	var plain bytes.Buffer
+	if err := png.Encode(&plain, testImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		format          string
+		data            []byte
+		wantOrientation int
+		wantMetadata    int64
+	}{
+		{name: "jpeg", format: FormatJPEG, data: jpegData, wantOrientation: 6, wantMetadata: jpegMetadata},
+		{name: "png", format: FormatPNG, data: pngData, wantOrientation: 3, wantMetadata: pngMetadata},
+		{name: "webp", format: FormatWebP, data: webpData, wantOrientation: 8, wantMetadata: webpMetadata},
+		{name: "without metadata", format: FormatPNG, data: plain.Bytes(), wantOrientation: 1},
+		{name: "gif", format: FormatGIF, data: []byte("GIF89a"), wantOrientation: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Inspect(bytes.NewReader(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("Inspect: %v", err)
+			}
+			if got.Orientation != tt.wantOrientation || got.Metadata != tt.wantMetadata {
+				t.Errorf("Inspect = %+v, want orientation %d and %d bytes of metadata", got, tt.wantOrientation, tt.wantMetadata)
+			}
+			if orientation := Orientation(tt.data, tt.format); orientation != tt.wantOrientation {
+				t.Errorf("Orientation = %d, want %d", orientation, tt.wantOrientation)
+			}
+		})
+	}
+}
+
+func TestStrip(t *testing.T) {
+	jpegData, _ := testJPEG(t, 1)
+	pngData, _ := testPNG(t, 1)
+	webpData, _ := testWebP(1)
+
+	tests := []struct {
+		name   string
+		format string
+		data   []byte
+		decode bool
+	}{
+		{name: "jpeg", format: FormatJPEG, data: jpegData, decode: true},
+		{name: "png", format: FormatPNG, data: pngData, decode: true},
+		{name: "webp", format: FormatWebP, data: webpData},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspection, err := Inspect(bytes.NewReader(tt.data), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := int64(len(tt.data)) - inspection.Metadata
+
+			var out bytes.Buffer
+			// A reader returning one byte at a time catches a parser that expects full reads
+			if err := Strip(&out, iotest.OneByteReader(bytes.NewReader(tt.data)), tt.format, size); err != nil {
+				t.Fatalf("Strip: %v", err)
+			}
+			if int64(out.Len()) != size {
+				t.Errorf("Strip wrote %d bytes, want %d", out.Len(), size)
+			}
+
+			stripped, err := Inspect(bytes.NewReader(out.Bytes()), tt.format)
+			if err != nil {
+				t.Fatalf("Inspect of the stripped image: %v", err)
+			}
+			if stripped.Metadata != 0 || stripped.Orientation != 1 {
+				t.Errorf("stripped image still has metadata: %+v", stripped)
+			}
+
+			if tt.decode {
+				img, _, err := image.Decode(bytes.NewReader(out.Bytes()))
+				if err != nil {
+					t.Fatalf("decode the stripped image: %v", err)
+				}
+				if img.Bounds() != testImage().Bounds() {
+					t.Errorf("stripped image is %v, want %v", img.Bounds(), testImage().Bounds())
+				}
+			}
+		})
+	}
+}
+
+func TestStripWebPHeader(t *testing.T) {
+	data, metadata := testWebP(1)
+	size := int64(len(data)) - metadata
+
+	var out bytes.Buffer
+	if err := Strip(&out, bytes.NewReader(data), FormatWebP, size); err != nil {
+		t.Fatal(err)
+	}
+	stripped := out.Bytes()
+	if riff := binary.LittleEndian.Uint32(stripped[4:8]); int64(riff) != size-8 {
+		t.Errorf("RIFF size = %d, want %d", riff, size-8)
+	}
+	// The VP8X flags follow the 12 bytes of the RIFF header and the 8 of the chunk header
+	if flags := stripped[20]; flags&webpMetadataFlags != 0 {
+		t.Errorf("VP8X flags = %#x, still announcing metadata", flags)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	jpegData, _ := testJPEG(t, 6)
+	pngData, _ := testPNG(t, 6)
+	webpData, _ := testWebP(6)
+
+	tests := []struct {
+		name   string
+		format string
+		data   []byte
+	}{
+		{name: "jpeg without SOI", format: FormatJPEG, data: jpegData[2:]},
+		{name: "jpeg cut in a segment", format: FormatJPEG, data: jpegData[:30]},
+		{name: "jpeg cut before the image data", format: FormatJPEG, data: jpegData[:2+4]},
+		{name: "png without signature", format: FormatPNG, data: pngData[1:]},
+		{name: "png cut in a chunk", format: FormatPNG, data: pngData[:len(pngData)-3]},
+		{name: "webp without RIFF header", format: FormatWebP, data: webpData[12:]},
+		{name: "webp without its last padding", format: FormatWebP, data: webpData[:len(webpData)-1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Inspect(bytes.NewReader(tt.data), tt.format); !errors.Is(err, ErrMalformed) {
+				t.Errorf("Inspect error = %v, want ErrMalformed", err)
+			}
+			if err := Strip(io.Discard, bytes.NewReader(tt.data), tt.format, int64(len(tt.data))); !errors.Is(err, ErrMalformed) {
+				t.Errorf("Strip error = %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
+
+func TestStripReadError(t *testing.T) {
+	data, _ := testPNG(t, 1)
+	failure := errors.New("connection reset")
+	r := io.MultiReader(bytes.NewReader(data[:40]), iotest.ErrReader(failure))
+	if err := Strip(io.Discard, r, FormatPNG, int64(len(data))); !errors.Is(err, failure) {
+		t.Errorf("Strip error = %v, want the read error", err)
+	}
+}
+
+func TestUpright(t *testing.T) {
+	data, _ := testJPEG(t, 6)
+
+	var out bytes.Buffer
+	if err := Upright(&out, bytes.NewReader(data), FormatJPEG, 6, 0); err != nil {
+		t.Fatalf("Upright: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(2, 4) {
+		t.Fatalf("upright image is %v, want 2x4", got)
+	}
+	// Turned clockwise, the red left half ends up on top
+	if r, _, b, _ := img.At(1, 0).RGBA(); r < b {
+		t.Errorf("top of the upright image is not red")
+	}
+	if inspection, err := Inspect(bytes.NewReader(out.Bytes()), FormatJPEG); err != nil || inspection.Metadata != 0 {
+		t.Errorf("upright image keeps metadata: %+v, %v", inspection, err)
+	}
+
+	if err := Upright(io.Discard, bytes.NewReader(data), FormatJPEG, 6, 4); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Upright beyond the pixel limit = %v, want ErrTooLarge", err)
+	}
+}
@@ -0,0 +1,75 @@
+package imaging
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// How Resize fits an image into a box
+const (
+	// FitContain scales the image down to fit within the box, keeping its aspect ratio
+	FitContain = "contain"
+	// FitCover scales the image to cover the box and crops what sticks out, keeping the centre
+	FitCover = "cover"
+	// FitFill stretches the image to the box, ignoring its aspect ratio
+	FitFill = "fill"
+)
+
+// Resize fits img into a width x height box. A zero width or height follows from the other and
+// the aspect ratio, which only contain allows. Contain never enlarges an image.
+func Resize(img image.Image, width, height int, fit string) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	if width == 0 {
+		width = max(1, srcWidth*height/srcHeight)
+	}
+	if height == 0 {
+		height = max(1, srcHeight*width/srcWidth)
+	}
+
+	switch fit {
+	case FitCover:
+		// Crop the source to the box's aspect ratio around its centre, then scale
+		crop := bounds
+		if srcWidth*height > srcHeight*width {
+			cropWidth := max(1, srcHeight*width/height)
+			crop.Min.X += (srcWidth - cropWidth) / 2
+			crop.Max.X = crop.Min.X + cropWidth
+		} else {
+			cropHeight := max(1, srcWidth*height/width)
+			crop.Min.Y += (srcHeight - cropHeight) / 2
+			crop.Max.Y = crop.Min.Y + cropHeight
+		}
+		return scale(img, crop, width, height)
+	case FitFill:
+		return scale(img, bounds, width, height)
+	default:
+		if srcWidth <= width && srcHeight <= height {
+			return img
+		}
+		if srcWidth*height > srcHeight*width {
+			height = max(1, srcHeight*width/srcWidth)
+		} else {
+			width = max(1, srcWidth*height/srcHeight)
+		}
+		return scale(img, bounds, width, height)
+	}
+}
+
+func scale(img image.Image, src image.Rectangle, width, height int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
+
+// EncodeQuality is Encode with the given JPEG quality, or the default one when it is zero. Other
+// formats are lossless and ignore it.
+func EncodeQuality(w io.Writer, img image.Image, format string, quality int) (string, error) {
+	if format == FormatJPEG && quality > 0 {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	return Encode(w, img, format)
+}
@@ -0,0 +1,89 @@
+package presign
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	signer := NewSigner("secret")
+	now := time.Now()
+	expires := now.Add(time.Hour)
+	params := url.Values{"filename": {"photo.png"}, "size": {"1024"}}
+	signed := signer.Sign("GET", "/files/1/content", params, expires)
+
+	if params.Get(SignatureParam) != "" || params.Get(ExpiresParam) != "" {
+		t.Fatal("Sign modified the parameters it was given")
+	}
+	if err := signer.Verify("GET", "/files/1/content", signed, now); err != nil {
+		t.Fatalf("Verify of a freshly signed query = %v", err)
+	}
+	if got := Expires(signed); got.Unix() != expires.Unix() {
+		t.Errorf("Expires = %v, want %v", got, expires.Truncate(time.Second))
+	}
+
+	// The query survives being sent as a URL
+	parsed, err := url.ParseQuery(signed.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Verify("get", "/files/1/content", parsed, now); err != nil {
+		t.Errorf("Verify of the encoded query with a lower-case method = %v", err)
+	}
+
+	tamper := func(change func(url.Values)) url.Values {
+		query := url.Values{}
+		for key, values := range signed {
+			query[key] = append([]string(nil), values...)
+		}
+		change(query)
+		return query
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		query  url.Values
+		now    time.Time
+		want   error
+	}{
+		{name: "other method", method: "POST", path: "/files/1/content", query: signed, now: now, want: ErrInvalidSignature},
+		{name: "other path", method: "GET", path: "/files/2/content", query: signed, now: now, want: ErrInvalidSignature},
+		{name: "changed parameter", method: "GET", path: "/files/1/content", query: tamper(func(q url.Values) { q.Set("size", "2048") }), now: now, want: ErrInvalidSignature},
+		{name: "added parameter", method: "GET", path: "/files/1/content", query: tamper(func(q url.Values) { q.Add("folder_id", "x") }), now: now, want: ErrInvalidSignature},
+		{name: "removed parameter", method: "GET", path: "/files/1/content", query: tamper(func(q url.Values) { q.Del("filename") }), now: now, want: ErrInvalidSignature},
+		{name: "extended expiry", method: "GET", path: "/files/1/content", query: tamper(func(q url.Values) { q.Set(ExpiresParam, "99999999999") }), now: now, want: ErrInvalidSignature},
+		{name: "no signature", method: "GET", path: "/files/1/content", query: tamper(func(q url.Values) { q.Del(SignatureParam) }), now: now, want: ErrUnsigned},
+		{name: "expired", method: "GET", path: "/files/1/content", query: signed, now: expires, want: ErrExpired},
+		{name: "long expired", method: "GET", path: "/files/1/content", query: signed, now: expires.Add(24 * time.Hour), want: ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := signer.Verify(tt.method, tt.path, tt.query, tt.now); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyWithAnotherKey(t *testing.T) {
+	now := time.Now()
+	signed := NewSigner("secret").Sign("GET", "/files/1/content", nil, now.Add(time.Hour))
+	if err := NewSigner("other").Verify("GET", "/files/1/content", signed, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify with another key = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyMalformedExpiry(t *testing.T) {
+	signer := NewSigner("secret")
+	now := time.Now()
+	// A signature over a non-numeric expiry is still refused
+	query := url.Values{ExpiresParam: {"soon"}}
+	query.Set(SignatureParam, signer.signature("GET", "/files/1/content", query))
+	if err := signer.Verify("GET", "/files/1/content", query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify with a malformed expiry = %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,138 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the INSTREAM chunks sent to clamd
+const clamdChunkSize = 64 * 1024
+
+// Clamd scans content with a ClamAV daemon over its INSTREAM command. clamd rejects streams
+// larger than its StreamMaxLength (25MB by default), which surfaces as a scan error.
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd connects to clamd at tcp://host:port, unix:///path/to/clamd.sock or a bare host:port.
+// The timeout bounds every read and write, not the whole scan, so large files are not cut off.
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	network, addr := "tcp", address
+	if scheme, rest, ok := strings.Cut(address, "://"); ok {
+		network, addr = scheme, rest
+	}
+	if network != "tcp" && network != "unix" {
+		return nil, fmt.Errorf("clamd address %q must use tcp:// or unix://", address)
+	}
+	if addr == "" {
+		return nil, errors.New("CLAMD_ADDRESS is required for the clamd scanner")
+	}
+	if timeout <= 0 {
+		return nil, errors.New("CLAMD_TIMEOUT_SECONDS must be positive")
+	}
+
+	return &Clamd{
+		network: network,
+		address: addr,
+		timeout: timeout,
+	}, nil
+}
+
+func (c *Clamd) Name() string {
+	return BackendClamd
+}
+
+// Scan streams r to clamd: the zINSTREAM command, then chunks each prefixed with their length
+// as a 4-byte big-endian integer, then a zero-length chunk. clamd answers with a single
+// NUL-terminated line such as "stream: OK" or "stream: Eicar-Signature FOUND".
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	// Unblock reads and writes when the request goes away
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := c.send(conn, r); err != nil {
+		// clamd closes the connection when the stream exceeds its limit; its reply says why
+		if reply, replyErr := c.readReply(conn); replyErr == nil {
+			return parseClamdReply(reply)
+		}
+		return Result{}, err
+	}
+
+	reply, err := c.readReply(conn)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseClamdReply(reply)
+}
+
+func (c *Clamd) send(conn net.Conn, r io.Reader) error {
+	conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("send INSTREAM: %w", err)
+	}
+
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			conn.SetWriteDeadline(time.Now().Add(c.timeout))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return fmt.Errorf("send chunk: %w", err)
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("send end of stream: %w", err)
+	}
+	return nil
+}
+
+// readReply reads the NUL-terminated reply, tolerating a connection closed right after it
+func (c *Clamd) readReply(conn net.Conn) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(c.timeout))
+	line, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", fmt.Errorf("read clamd reply: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimRight(line, "\x00")), nil
+}
+
+func parseClamdReply(reply string) (Result, error) {
+	status := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case status == "OK":
+		return Result{Scanned: true}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return Result{
+			Scanned:   true,
+			Infected:  true,
+			Signature: strings.TrimSuffix(status, " FOUND"),
+		}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd: %s", reply)
+	}
+}
@@ -0,0 +1,357 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClamd is a clamd stand-in listening on a local socket. serve handles each connection.
+type fakeClamd struct {
+	address string
+	wg      sync.WaitGroup
+}
+
+func startFakeClamd(t *testing.T, network string, serve func(conn net.Conn)) *fakeClamd {
+	t.Helper()
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "clamd.sock")
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	fake := &fakeClamd{address: network + "://" + listener.Addr().String()}
+	fake.wg.Add(1)
+	go func() {
+		defer fake.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			fake.wg.Add(1)
+			go func() {
+				defer fake.wg.Done()
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				serve(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		fake.wg.Wait()
+	})
+	return fake
+}
+
+// stream is what a fake clamd received: the command and the INSTREAM chunks up to the terminator
+type stream struct {
+	command    string
+	chunks     []int
+	content    []byte
+	terminated bool
+}
+
+// readStream reads the zINSTREAM command and its chunks, stopping after limit bytes of content
+// like clamd does at its StreamMaxLength
+func readStream(conn net.Conn, limit int) (stream, error) {
+	var s stream
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	s.command = command
+	if err != nil {
+		return s, err
+	}
+
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return s, err
+		}
+		size := int(binary.BigEndian.Uint32(header[:]))
+		if size == 0 {
+			s.terminated = true
+			return s, nil
+		}
+		s.chunks = append(s.chunks, size)
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return s, err
+		}
+		s.content = append(s.content, chunk...)
+		if limit > 0 && len(s.content) > limit {
+			return s, errSizeLimit
+		}
+	}
+}
+
+var errSizeLimit = errors.New("size limit exceeded")
+
+// replyAfterStream reads a whole stream and answers with reply
+func replyAfterStream(reply string, received chan<- stream) func(net.Conn) {
+	return func(conn net.Conn) {
+		s, err := readStream(conn, 0)
+		if received != nil {
+			received <- s
+		}
+		if err != nil {
+			return
+		}
+		conn.Write([]byte(reply + "\x00"))
+	}
+}
+
+func newTestClamd(t *testing.T, address string, timeout time.Duration) *Clamd {
+	t.Helper()
+	clamd, err := NewClamd(address, timeout)
+	if err != nil {
+		t.Fatalf("NewClamd(%q): %v", address, err)
+	}
+	return clamd
+}
+
+func TestClamdScanVerdicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		reply  string
+		want   Result
+		errMsg string
+	}{
+		{name: "clean", reply: "stream: OK", want: Result{Scanned: true}},
+		{name: "infected", reply: "stream: Eicar-Test-Signature FOUND", want: Result{Scanned: true, Infected: true, Signature: "Eicar-Test-Signature"}},
+		{name: "signature with spaces", reply: "stream: Win.Test.EICAR_HDB-1 (heuristic) FOUND", want: Result{Scanned: true, Infected: true, Signature: "Win.Test.EICAR_HDB-1 (heuristic)"}},
+		{name: "error", reply: "stream: Can't allocate memory ERROR", errMsg: "clamd: stream: Can't allocate memory ERROR"},
+		{name: "unknown reply", reply: "UNKNOWN COMMAND", errMsg: "clamd: UNKNOWN COMMAND"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := startFakeClamd(t, "tcp", replyAfterStream(tt.reply, nil))
+			result, err := newTestClamd(t, fake.address, 5*time.Second).Scan(context.Background(), strings.NewReader("content"))
+			if tt.errMsg != "" {
+				if err == nil || err.Error() != tt.errMsg {
+					t.Fatalf("Scan error = %v, want %q", err, tt.errMsg)
+				}
+				if result.Scanned {
+					t.Errorf("Scan with an error returned a verdict: %+v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			if result != tt.want {
+				t.Errorf("Scan = %+v, want %+v", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestClamdChunkFraming(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		chunks []int
+	}{
+		{name: "empty", size: 0, chunks: nil},
+		{name: "one byte", size: 1, chunks: []int{1}},
+		{name: "exactly one chunk", size: clamdChunkSize, chunks: []int{clamdChunkSize}},
+		{name: "several chunks", size: 2*clamdChunkSize + 100, chunks: []int{clamdChunkSize, clamdChunkSize, 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan stream, 1)
+			fake := startFakeClamd(t, "tcp", replyAfterStream("stream: OK", received))
+			content := bytes.Repeat([]byte("abcdefghij"), tt.size/10+1)[:tt.size]
+
+			// A reader returning a few bytes at a time must still be sent in full chunks
+			if _, err := newTestClamd(t, fake.address, 5*time.Second).Scan(context.Background(), &trickleReader{r: bytes.NewReader(content)}); err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+
+			s := <-received
+			if s.command != "zINSTREAM\x00" {
+				t.Errorf("command = %q, want %q", s.command, "zINSTREAM\x00")
+			}
+			if !s.terminated {
+				t.Error("stream was not terminated with a zero-length chunk")
+			}
+			if len(s.chunks) != len(tt.chunks) {
+				t.Fatalf("chunks = %v, want %v", s.chunks, tt.chunks)
+			}
+			for i := range s.chunks {
+				if s.chunks[i] != tt.chunks[i] {
+					t.Fatalf("chunks = %v, want %v", s.chunks, tt.chunks)
+				}
+			}
+			if !bytes.Equal(s.content, content) {
+				t.Errorf("clamd received %d bytes that differ from the %d scanned", len(s.content), len(content))
+			}
+		})
+	}
+}
+
+// trickleReader returns at most 1000 bytes per read
+type trickleReader struct {
+	r io.Reader
+}
+
+func (tr *trickleReader) Read(p []byte) (int, error) {
+	if len(p) > 1000 {
+		p = p[:1000]
+	}
+	return tr.r.Read(p)
+}
+
+func TestClamdSizeLimit(t *testing.T) {
+	// clamd stops reading at StreamMaxLength, answers and closes the connection
+	fake := startFakeClamd(t, "tcp", func(conn net.Conn) {
+		if _, err := readStream(conn, 100*1024); !errors.Is(err, errSizeLimit) {
+			return
+		}
+		conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+		// Drain what the client still sends, so closing does not reset the connection
+		// before the reply has been read
+		conn.(*net.TCPConn).CloseWrite()
+		io.Copy(io.Discard, conn)
+	})
+
+	content := bytes.NewReader(make([]byte, 4*1024*1024))
+	result, err := newTestClamd(t, fake.address, 5*time.Second).Scan(context.Background(), content)
+	if err == nil || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Fatalf("Scan error = %v, want the size limit reply", err)
+	}
+	if result.Scanned {
+		t.Errorf("Scan past the size limit returned a verdict: %+v", result)
+	}
+}
+
+func TestClamdConnectionDropped(t *testing.T) {
+	tests := []struct {
+		name  string
+		serve func(conn net.Conn)
+	}{
+		{name: "mid-stream", serve: func(conn net.Conn) {
+			r := bufio.NewReader(conn)
+			r.ReadString(0)
+			io.CopyN(io.Discard, r, 3*clamdChunkSize)
+		}},
+		{name: "before the reply", serve: func(conn net.Conn) {
+			readStream(conn, 0)
+		}},
+		{name: "in the middle of the reply", serve: func(conn net.Conn) {
+			readStream(conn, 0)
+			conn.Write([]byte("stream: O"))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := startFakeClamd(t, "tcp", tt.serve)
+			content := bytes.NewReader(make([]byte, 8*1024*1024))
+			result, err := newTestClamd(t, fake.address, 5*time.Second).Scan(context.Background(), content)
+			if err == nil {
+				t.Fatalf("Scan = %+v, want an error", result)
+			}
+			if result.Scanned {
+				t.Errorf("Scan of a dropped connection returned a verdict: %+v", result)
+			}
+		})
+	}
+}
+
+func TestClamdTimeoutAndCancel(t *testing.T) {
+	// Reads the stream and never answers, until the client hangs up
+	silent := func(conn net.Conn) {
+		readStream(conn, 0)
+		io.Copy(io.Discard, conn)
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		fake := startFakeClamd(t, "tcp", silent)
+		start := time.Now()
+		if _, err := newTestClamd(t, fake.address, 200*time.Millisecond).Scan(context.Background(), strings.NewReader("content")); err == nil {
+			t.Fatal("Scan without a reply succeeded")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Scan took %s to time out", elapsed)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		fake := startFakeClamd(t, "tcp", silent)
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, err := newTestClamd(t, fake.address, time.Minute).Scan(ctx, strings.NewReader("content")); err == nil {
+			t.Fatal("Scan of a cancelled request succeeded")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Scan took %s to notice the cancellation", elapsed)
+		}
+	})
+}
+
+func TestClamdUnixSocket(t *testing.T) {
+	fake := startFakeClamd(t, "unix", replyAfterStream("stream: OK", nil))
+	result, err := newTestClamd(t, fake.address, 5*time.Second).Scan(context.Background(), strings.NewReader("content"))
+	if err != nil || !result.Scanned {
+		t.Fatalf("Scan over a unix socket = %+v, %v", result, err)
+	}
+}
+
+func TestClamdUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	if _, err := newTestClamd(t, address, time.Second).Scan(context.Background(), strings.NewReader("content")); err == nil {
+		t.Fatal("Scan against a closed port succeeded")
+	}
+}
+
+func TestNewClamd(t *testing.T) {
+	tests := []struct {
+		address string
+		timeout time.Duration
+		network string
+		addr    string
+		wantErr bool
+	}{
+		{address: "localhost:3310", timeout: time.Second, network: "tcp", addr: "localhost:3310"},
+		{address: "tcp://clamav:3310", timeout: time.Second, network: "tcp", addr: "clamav:3310"},
+		{address: "unix:///run/clamd.sock", timeout: time.Second, network: "unix", addr: "/run/clamd.sock"},
+		{address: "udp://clamav:3310", timeout: time.Second, wantErr: true},
+		{address: "", timeout: time.Second, wantErr: true},
+		{address: "tcp://", timeout: time.Second, wantErr: true},
+		{address: "localhost:3310", timeout: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		clamd, err := NewClamd(tt.address, tt.timeout)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewClamd(%q, %s) error = %v, wantErr %v", tt.address, tt.timeout, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (clamd.network != tt.network || clamd.address != tt.addr) {
+			t.Errorf("NewClamd(%q) = %s %s, want %s %s", tt.address, clamd.network, clamd.address, tt.network, tt.addr)
+		}
+	}
+}
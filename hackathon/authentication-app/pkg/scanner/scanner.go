@@ -0,0 +1,53 @@
+package scanner
+
+import (
+	"authentication-app/config"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	BackendNone  = "none"
+	BackendClamd = "clamd"
+)
+
+// Result is the verdict on scanned content. Scanned is false when no scanner looked at it.
+type Result struct {
+	Scanned   bool
+	Infected  bool
+	Signature string
+}
+
+// Scanner checks content for malware
+type Scanner interface {
+	// Name identifies the scanner in logs
+	Name() string
+	// Scan reads r to the end and reports whether it is infected. An error means no verdict was
+	// reached, not that the content is bad.
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Noop accepts everything without looking at it; its results are never Scanned
+type Noop struct{}
+
+func (Noop) Name() string {
+	return BackendNone
+}
+
+func (Noop) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+// New builds the scanner selected by SCANNER_BACKEND
+func New(cfg *config.Config) (Scanner, error) {
+	switch cfg.ScannerBackend {
+	case "", BackendNone:
+		return Noop{}, nil
+	case BackendClamd:
+		return NewClamd(cfg.ClamdAddress, time.Duration(cfg.ClamdTimeoutSeconds)*time.Second)
+	default:
+		return nil, fmt.Errorf("unknown SCANNER_BACKEND %q, expected none or clamd", cfg.ScannerBackend)
+	}
+}
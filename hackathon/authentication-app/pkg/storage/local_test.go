@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLocalStorage(t *testing.T) (*LocalStorage, string) {
+	t.Helper()
+	root := t.TempDir()
+	s, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	return s, root
+}
+
+func TestLocalStorage(t *testing.T) {
+	s, _ := newTestLocalStorage(t)
+	testBackend(t, s, "conformance/")
+}
+
+// failingReader returns some content and then fails, like a client that drops mid-upload
+type failingReader struct {
+	content io.Reader
+}
+
+var errDropped = errors.New("connection dropped")
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	n, err := fr.content.Read(p)
+	if err == io.EOF {
+		return n, errDropped
+	}
+	return n, err
+}
+
+func TestLocalStoragePutIsAtomic(t *testing.T) {
+	s, root := newTestLocalStorage(t)
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "a/object", strings.NewReader("original"), 8, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// A failed write neither replaces the object nor leaves its temp file behind
+	err := s.Put(ctx, "a/object", &failingReader{content: strings.NewReader("partial")}, -1, "")
+	if !errors.Is(err, errDropped) {
+		t.Fatalf("Put with a failing reader = %v, want %v", err, errDropped)
+	}
+	if got := readObject(t, s, "a/object"); string(got) != "original" {
+		t.Errorf("object after a failed Put = %q, want %q", got, "original")
+	}
+	if err := s.Put(ctx, "a/new", &failingReader{content: strings.NewReader("partial")}, -1, ""); err == nil {
+		t.Fatal("Put with a failing reader succeeded")
+	}
+	if _, err := s.Stat(ctx, "a/new"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of an object whose Put failed = %v, want ErrNotFound", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "object" {
+			t.Errorf("unexpected file %q left in the storage root", entry.Name())
+		}
+	}
+}
+
+func TestLocalStoragePutStopsOnCancel(t *testing.T) {
+	s, _ := newTestLocalStorage(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.Put(ctx, "object", strings.NewReader("content"), 7, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Put with a cancelled context = %v, want context.Canceled", err)
+	}
+	if _, err := s.Stat(context.Background(), "object"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after a cancelled Put = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalStorageListSkipsTempFiles(t *testing.T) {
+	s, root := newTestLocalStorage(t)
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "object", strings.NewReader("content"), 7, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, localTempPrefix+"123"), []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := listKeys(t, s, ""); len(keys) != 1 || keys[0] != "object" {
+		t.Errorf("List = %v, want [object]", keys)
+	}
+}
+
+func TestLocalStorageMove(t *testing.T) {
+	s, root := newTestLocalStorage(t)
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "staging/object", strings.NewReader("content"), 7, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put(ctx, "final/object", strings.NewReader("old"), 3, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// Moving replaces the destination
+	if err := s.Move(ctx, "staging/object", "final/object"); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if got := readObject(t, s, "final/object"); string(got) != "content" {
+		t.Errorf("destination after Move = %q, want %q", got, "content")
+	}
+	if _, err := os.Stat(filepath.Join(root, "staging", "object")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("source still exists after Move: %v", err)
+	}
+
+	// Directories of the destination are created
+	if err := s.Move(ctx, "final/object", "deep/er/object"); err != nil {
+		t.Fatalf("Move into a new directory: %v", err)
+	}
+	if got := readObject(t, s, "deep/er/object"); string(got) != "content" {
+		t.Errorf("destination after Move = %q, want %q", got, "content")
+	}
+}
+
+func TestLocalStorageRejectsEscapingKeys(t *testing.T) {
+	s, _ := newTestLocalStorage(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"", "../outside", "a/../../outside", "/absolute"} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if err := s.Move(ctx, "object", key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Move to %q = %v, want an invalid key error", key, err)
+		}
+	}
+}
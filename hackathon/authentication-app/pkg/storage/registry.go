@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"authentication-app/config"
+	"context"
+	"fmt"
+)
+
+// Registry holds every configured backend. New objects go to the primary backend; existing
+// objects are read from whichever backend their row records, so switching STORAGE_BACKEND
+// does not strand files written before the switch.
+type Registry struct {
+	primary  Storage
+	backends map[string]Storage
+}
+
+func NewRegistry(primary Storage, others ...Storage) *Registry {
+	r := &Registry{
+		primary:  primary,
+		backends: map[string]Storage{primary.Name(): primary},
+	}
+	for _, backend := range others {
+		r.backends[backend.Name()] = backend
+	}
+	return r
+}
+
+// Primary is the backend new objects are written to
+func (r *Registry) Primary() Storage {
+	return r.primary
+}
+
+// Backend looks up a backend by the name recorded on a row
+func (r *Registry) Backend(name string) (Storage, error) {
+	backend, ok := r.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("storage: backend %q is not configured", name)
+	}
+	return backend, nil
+}
+
+// New builds the registry from the configuration. The local backend is always available; the
+// S3 backend is added when it is selected or a bucket is configured.
+func New(ctx context.Context, cfg *config.Config) (*Registry, error) {
+	local, err := NewLocalStorage(cfg.StorageLocalRoot)
+	if err != nil {
+		return nil, err
+	}
+	backends := []Storage{local}
+
+	if cfg.StorageBackend == BackendS3 || cfg.S3Bucket != "" {
+		s3, err := NewS3Storage(ctx, S3Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			UseSSL:          cfg.S3UseSSL,
+			ForcePathStyle:  cfg.S3ForcePathStyle,
+			CreateBucket:    cfg.S3CreateBucket,
+		})
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, s3)
+	}
+
+	for i, backend := range backends {
+		if backend.Name() == cfg.StorageBackend {
+			backends[0], backends[i] = backends[i], backends[0]
+			return NewRegistry(backends[0], backends[1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("storage: unknown STORAGE_BACKEND %q", cfg.StorageBackend)
+}
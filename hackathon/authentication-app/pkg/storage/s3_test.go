@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestS3Storage runs against a real S3-compatible service, such as the MinIO of docker-compose:
+//
+//	S3_TEST_ENDPOINT=localhost:9000 S3_TEST_ACCESS_KEY_ID=minioadmin S3_TEST_SECRET_ACCESS_KEY=minioadmin go test ./pkg/storage
+//
+// The bucket, S3_TEST_BUCKET or storage-test, is created when missing.
+func TestS3Storage(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	bucket := os.Getenv("S3_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "storage-test"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	s, err := NewS3Storage(ctx, S3Config{
+		Endpoint:        endpoint,
+		Region:          os.Getenv("S3_TEST_REGION"),
+		Bucket:          bucket,
+		AccessKeyID:     os.Getenv("S3_TEST_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_TEST_SECRET_ACCESS_KEY"),
+		UseSSL:          os.Getenv("S3_TEST_USE_SSL") == "true",
+		ForcePathStyle:  true,
+		CreateBucket:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+
+	// Every run works below a prefix of its own, so runs against a shared bucket do not collide
+	testBackend(t, s, fmt.Sprintf("storage-test-%d/", time.Now().UnixNano()))
+}
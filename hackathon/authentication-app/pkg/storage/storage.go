@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist in a backend
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Storage is a flat object store addressed by slash-separated keys
+type Storage interface {
+	// Name identifies the backend and is recorded on every row that points at one of its objects
+	Name() string
+	// Put streams r into the object at key, replacing it. size is -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object for streaming; the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange opens length bytes of the object starting at offset; the caller must close it
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete removes the object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Move renames the object at src to dst, replacing dst
+	Move(ctx context.Context, src, dst string) error
+	// List calls fn for every object whose key starts with prefix, stopping at the first error
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+}
+
+// rangeReader reads part of an object and closes the whole of it
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testBackend runs the behaviour every Storage must share against s, with all keys below prefix
+func testBackend(t *testing.T, s Storage, prefix string) {
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	key := prefix + "dir/object.bin"
+
+	// Unknown size, as streamed uploads are stored
+	if err := s.Put(ctx, key, bytes.NewReader(content), -1, "application/octet-stream"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Key != key || info.Size != int64(len(content)) {
+		t.Errorf("Stat = %+v, want key %q and size %d", info, key, len(content))
+	}
+
+	if got := readObject(t, s, key); !bytes.Equal(got, content) {
+		t.Errorf("Get returned %d bytes that differ from the %d put", len(got), len(content))
+	}
+
+	part, err := s.GetRange(ctx, key, 15, 10)
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	got, err := io.ReadAll(part)
+	part.Close()
+	if err != nil || string(got) != "5678901234" {
+		t.Errorf("GetRange(15, 10) = %q, %v, want %q", got, err, "5678901234")
+	}
+
+	// Replacing an object keeps only the new content
+	if err := s.Put(ctx, key, strings.NewReader("replaced"), int64(len("replaced")), "text/plain"); err != nil {
+		t.Fatalf("Put over an existing object: %v", err)
+	}
+	if got := readObject(t, s, key); string(got) != "replaced" {
+		t.Errorf("Get after replacing = %q, want %q", got, "replaced")
+	}
+
+	other := prefix + "other.bin"
+	if err := s.Put(ctx, other, strings.NewReader("other"), 5, "application/octet-stream"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if keys := listKeys(t, s, prefix); strings.Join(keys, ",") != key+","+other {
+		t.Errorf("List(%q) = %v, want [%s %s]", prefix, keys, key, other)
+	}
+	if keys := listKeys(t, s, prefix+"dir/"); strings.Join(keys, ",") != key {
+		t.Errorf("List(%q) = %v, want [%s]", prefix+"dir/", keys, key)
+	}
+
+	moved := prefix + "moved/object.bin"
+	if err := s.Move(ctx, key, moved); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if got := readObject(t, s, moved); string(got) != "replaced" {
+		t.Errorf("Get after Move = %q, want %q", got, "replaced")
+	}
+	if _, err := s.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of the moved source = %v, want ErrNotFound", err)
+	}
+	if err := s.Move(ctx, key, moved); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Move of a missing object = %v, want ErrNotFound", err)
+	}
+
+	for _, k := range []string{moved, other} {
+		if err := s.Delete(ctx, k); err != nil {
+			t.Fatalf("Delete(%q): %v", k, err)
+		}
+	}
+	if err := s.Delete(ctx, moved); err != nil {
+		t.Errorf("Delete of a missing object = %v, want nil", err)
+	}
+	if _, err := s.Get(ctx, moved); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted object = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Stat(ctx, moved); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a deleted object = %v, want ErrNotFound", err)
+	}
+	if keys := listKeys(t, s, prefix); len(keys) != 0 {
+		t.Errorf("List(%q) after deleting everything = %v", prefix, keys)
+	}
+}
+
+func readObject(t *testing.T, s Storage, key string) []byte {
+	t.Helper()
+	r, err := s.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read %q: %v", key, err)
+	}
+	return data
+}
+
+func listKeys(t *testing.T, s Storage, prefix string) []string {
+	t.Helper()
+	var keys []string
+	err := s.List(context.Background(), prefix, func(info ObjectInfo) error {
+		keys = append(keys, info.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List(%q): %v", prefix, err)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,22 +1,29 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-// GenerateJWTToken creates a new JWT token for the given user
-func GenerateJWTToken(userID uuid.UUID, username string, jwtSecret string, jwtExpireMinutes int) (string, time.Time, error) {
+// GenerateJWTToken creates a new JWT token for the given user, scoped to orgID unless it is uuid.Nil
+func GenerateJWTToken(userID uuid.UUID, username string, role string, orgID uuid.UUID, jwtSecret string, jwtExpireMinutes int) (string, time.Time, error) {
 	expiresAt := time.Now().Add(time.Duration(jwtExpireMinutes) * time.Minute)
 	claims := jwt.MapClaims{
 		"user_id":  userID,
 		"username": username,
+		"role":     role,
 		"exp":      expiresAt.Unix(),
 		"iat":      time.Now().Unix(),
 		"jti":      GenerateTokenID(),
 	}
+	if orgID != uuid.Nil {
+		claims["org_id"] = orgID
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(jwtSecret))
@@ -26,3 +33,24 @@ func GenerateJWTToken(userID uuid.UUID, username string, jwtSecret string, jwtEx
 
 	return tokenString, expiresAt, nil
 }
+
+// GenerateCSRFToken derives the CSRF token bound to a session token
+func GenerateCSRFToken(sessionToken string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf:" + sessionToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateCSRFToken checks a CSRF token against the session token it was issued for
+func ValidateCSRFToken(sessionToken string, secret string, csrfToken string) bool {
+	expected := GenerateCSRFToken(sessionToken, secret)
+	return hmac.Equal([]byte(expected), []byte(csrfToken))
+}
+
+// DeriveKey derives a purpose-specific key from a secret, so one secret can key several HMACs
+// without their signatures being interchangeable
+func DeriveKey(secret string, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("key:" + purpose))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -1,29 +1,102 @@
 package utils
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
 	"path/filepath"
 	"strings"
 	"time"
+
+	_ "golang.org/x/image/webp"
 )
 
-// IsImageContentType checks if the given content type is an image type
-func IsImageContentType(contentType string) bool {
-	imageTypes := []string{
-		"image/jpeg",
-		"image/jpg",
-		"image/png",
-		"image/gif",
-		"image/webp",
+// ErrCorruptImage means the bytes carry an image signature but the image header could not be decoded
+var ErrCorruptImage = errors.New("image header could not be decoded")
+
+// ErrImageHeaderTooLarge means an image header did not end within MaxSniffSize bytes
+var ErrImageHeaderTooLarge = errors.New("image header is too large")
+
+// MaxSniffSize bounds the bytes SniffContent holds to replay. Image headers end within a few
+// kilobytes, except when padded, as with the repeated comment segments JPEG allows.
+const MaxSniffSize = 1024 * 1024
+
+// imageSignatures maps the magic bytes of each supported format to its content type
+var imageSignatures = []struct {
+	contentType string
+	format      string
+	matches     func(header []byte) bool
+}{
+	{"image/jpeg", "jpeg", func(h []byte) bool { return bytes.HasPrefix(h, []byte{0xFF, 0xD8, 0xFF}) }},
+	{"image/png", "png", func(h []byte) bool { return bytes.HasPrefix(h, []byte("\x89PNG\r\n\x1a\n")) }},
+	{"image/gif", "gif", func(h []byte) bool {
+		return bytes.HasPrefix(h, []byte("GIF87a")) || bytes.HasPrefix(h, []byte("GIF89a"))
+	}},
+	{"image/webp", "webp", func(h []byte) bool {
+		return len(h) >= 12 && bytes.Equal(h[0:4], []byte("RIFF")) && bytes.Equal(h[8:12], []byte("WEBP"))
+	}},
+}
+
+// NormalizeContentType lower-cases a content type, drops its parameters and maps the
+// non-standard image/jpg alias to image/jpeg
+func NormalizeContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if mediaType == "image/jpg" {
+		return "image/jpeg"
+	}
+	return mediaType
+}
+
+// SniffContent detects the content type of r from its bytes. Images are identified by their magic
+// bytes and then their header is decoded, so a signature glued onto something else is rejected
+// with ErrCorruptImage; the returned config is only set for images. Other content falls back to
+// http.DetectContentType. Only the bytes needed for that are read; the returned reader replays
+// them followed by the rest of r, so the upload can still be streamed to storage in one pass. An
+// image header running past MaxSniffSize is rejected with ErrImageHeaderTooLarge.
+func SniffContent(r io.Reader) (string, image.Config, io.Reader, error) {
+	var consumed bytes.Buffer
+	// One byte past the limit tells a header that is too long from one that ends right at it
+	limited := &io.LimitedReader{R: r, N: MaxSniffSize + 1}
+	tee := io.TeeReader(limited, &consumed)
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(tee, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", image.Config{}, nil, err
 	}
+	header = header[:n]
 
-	contentType = strings.ToLower(contentType)
-	for _, imageType := range imageTypes {
-		if contentType == imageType {
-			return true
+	contentType, format := "", ""
+	for _, signature := range imageSignatures {
+		if signature.matches(header) {
+			contentType, format = signature.contentType, signature.format
+			break
 		}
 	}
-	return false
+	if contentType == "" {
+		return NormalizeContentType(http.DetectContentType(header)), image.Config{}, io.MultiReader(bytes.NewReader(consumed.Bytes()), r), nil
+	}
+
+	// DecodeConfig continues from the header already read and stops at the end of the image header
+	config, decodedFormat, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(header), tee))
+	if err != nil && limited.N == 0 {
+		return "", image.Config{}, nil, ErrImageHeaderTooLarge
+	}
+	if err != nil || decodedFormat != format || config.Width <= 0 || config.Height <= 0 {
+		return "", image.Config{}, nil, ErrCorruptImage
+	}
+
+	return contentType, config, io.MultiReader(bytes.NewReader(consumed.Bytes()), r), nil
 }
 
 // GenerateUniqueFilename generates a unique filename based on the original name and current timestamp
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+func encodeImage(t *testing.T, encode func(io.Writer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, 3, 2), color.Palette{color.Black, color.White})
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// webpLossless is the smallest VP8L header of a 3x2 image, enough for DecodeConfig
+var webpLossless = []byte("RIFF\x12\x00\x00\x00WEBPVP8L\x05\x00\x00\x00\x2f\x02\x40\x00\x00\x00")
+
+// paddedJPEG inserts comment segments after the start of image marker until the header reaches size
+func paddedJPEG(t *testing.T, size int) []byte {
+	t.Helper()
+	plain := encodeImage(t, func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) })
+	var buf bytes.Buffer
+	buf.Write(plain[:2])
+	segment := append([]byte{0xFF, 0xFE, 0xFF, 0xFF}, make([]byte, 0xFFFD)...)
+	for buf.Len()+len(segment) < size {
+		buf.Write(segment)
+	}
+	buf.Write(plain[2:])
+	return buf.Bytes()
+}
+
+func TestSniffContent(t *testing.T) {
+	jpegData := encodeImage(t, func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) })
+	pngData := encodeImage(t, png.Encode)
+	gifData := encodeImage(t, func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) })
+	// More than the 512 bytes sniffed, so the replay has to join what was read with the rest
+	longText := strings.Repeat("plain text ", 200)
+
+	tests := []struct {
+		name        string
+		content     []byte
+		contentType string
+		width       int
+		height      int
+		err         error
+	}{
+		{name: "jpeg", content: jpegData, contentType: "image/jpeg", width: 3, height: 2},
+		{name: "png", content: pngData, contentType: "image/png", width: 3, height: 2},
+		{name: "gif", content: gifData, contentType: "image/gif", width: 3, height: 2},
+		{name: "webp", content: webpLossless, contentType: "image/webp", width: 3, height: 2},
+		{name: "jpeg padded below the limit", content: paddedJPEG(t, MaxSniffSize/2), contentType: "image/jpeg", width: 3, height: 2},
+		{name: "text", content: []byte(longText), contentType: "text/plain"},
+		{name: "html", content: []byte("<!DOCTYPE html><html><body>hi</body></html>"), contentType: "text/html"},
+		{name: "binary", content: []byte{0x00, 0x01, 0x02, 0x03}, contentType: "application/octet-stream"},
+		{name: "empty", content: nil, contentType: "text/plain"},
+		{name: "png signature on text", content: append([]byte("\x89PNG\r\n\x1a\n"), longText...), err: ErrCorruptImage},
+		{name: "truncated jpeg", content: jpegData[:20], err: ErrCorruptImage},
+		{name: "webp signature with a png inside", content: append([]byte("RIFF\x00\x00\x00\x00WEBP"), pngData...), err: ErrCorruptImage},
+		{name: "jpeg padded past the limit", content: paddedJPEG(t, 2*MaxSniffSize), err: ErrImageHeaderTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, config, body, err := SniffContent(bytes.NewReader(tt.content))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("SniffContent error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SniffContent: %v", err)
+			}
+			if contentType != tt.contentType {
+				t.Errorf("content type = %q, want %q", contentType, tt.contentType)
+			}
+			if config.Width != tt.width || config.Height != tt.height {
+				t.Errorf("config = %dx%d, want %dx%d", config.Width, config.Height, tt.width, tt.height)
+			}
+
+			// The returned reader must replay the sniffed bytes followed by the rest
+			replayed, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("read replay: %v", err)
+			}
+			if !bytes.Equal(replayed, tt.content) {
+				t.Errorf("replay returned %d bytes that differ from the %d sniffed", len(replayed), len(tt.content))
+			}
+		})
+	}
+}
+
+// countingReader records how much of its content was read
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += n
+	return n, err
+}
+
+func TestSniffContentReadsOnlyTheHeader(t *testing.T) {
+	pngData := encodeImage(t, png.Encode)
+	tail := bytes.Repeat([]byte{0xAB}, 4*MaxSniffSize)
+	source := &countingReader{r: io.MultiReader(bytes.NewReader(pngData), bytes.NewReader(tail))}
+
+	if _, _, _, err := SniffContent(source); err != nil {
+		t.Fatalf("SniffContent: %v", err)
+	}
+	if source.n > MaxSniffSize+1 {
+		t.Errorf("SniffContent read %d bytes, want at most %d", source.n, MaxSniffSize+1)
+	}
+}
+
+func TestNormalizeContentType(t *testing.T) {
+	tests := map[string]string{
+		"image/jpeg":                "image/jpeg",
+		"IMAGE/PNG":                 "image/png",
+		"image/jpg":                 "image/jpeg",
+		"text/plain; charset=utf-8": "text/plain",
+		" Image/WebP ":              "image/webp",
+		"not a type;;":              "not a type;;",
+	}
+	for raw, want := range tests {
+		if got := NormalizeContentType(raw); got != want {
+			t.Errorf("NormalizeContentType(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package utils
+
+import "strings"
+
+// SplitAndTrim splits a separated list and drops empty items
+func SplitAndTrim(value string, sep string) []string {
+	parts := strings.Split(value, sep)
+	items := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}